@@ -2,235 +2,7896 @@ package main
 
 /*
 #include <stdlib.h>
+
+typedef void (*progress_callback)(long long transferred, long long total);
+
+static inline void invokeProgressCallback(progress_callback callback, long long transferred, long long total) {
+	callback(transferred, total);
+}
+
+typedef int (*chunk_callback)(long long stream_id, const char *data, long long length);
+
+static inline int invokeChunkCallback(chunk_callback callback, long long streamID, const char *data, long long length) {
+	return callback(streamID, data, length);
+}
+
+typedef void (*completion_callback)(long long operation_id, char *result);
+
+static inline void invokeCompletionCallback(completion_callback callback, long long operationID, char *result) {
+	callback(operationID, result);
+}
+
+typedef void (*credentials_callback)(long long handle, long long request_id);
+
+static inline void invokeCredentialsCallback(credentials_callback callback, long long handle, long long requestID) {
+	callback(handle, requestID);
+}
+
+typedef void (*log_callback)(int level, char *message);
+
+static inline void invokeLogCallback(log_callback callback, int level, char *message) {
+	callback(level, message);
+}
+
+typedef struct {
+	char *data;
+	long long length;
+	char *error;
+} bytes_result;
 */
 import "C"
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
 	"io"
-	"log"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/aws/smithy-go/tracing"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/klauspost/compress/zstd"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Buckets are registered under the handle initBucket returns so a process can
+// talk to several buckets, or several accounts, at once.
+var (
+	buckets    sync.Map // int64 handle -> *S3Bucket
+	bucketsMu  sync.Mutex
+	nextHandle atomic.Int64
+)
+
+// errInvalidHandle is returned when a handle was never issued by initBucket or
+// was closed with closeBucket.
+var errInvalidHandle = errors.New("invalid bucket handle")
+
+// registerBucket publishes bucket and returns its handle. Handles start at 1,
+// so 0 is never a valid handle.
+func registerBucket(bucket *S3Bucket) C.longlong {
+	bucket.baseContext, bucket.close = context.WithCancel(context.Background())
+	handle := nextHandle.Add(1)
+	buckets.Store(handle, bucket)
+	return C.longlong(handle)
+}
+
+// closeBucket tears down a bucket: operations in flight on it, including async
+// ones, are canceled and complete with code Canceled, idle connections are
+// closed, and the handle becomes invalid. Handles are never reused.
+//
+//export closeBucket
+func closeBucket(handle C.longlong) *C.char {
+	bucketsMu.Lock()
+	value, ok := buckets.LoadAndDelete(int64(handle))
+	bucketsMu.Unlock()
+	if !ok {
+		return errorResult("Error closing bucket", errInvalidHandle)
+	}
+
+	bucket := value.(*S3Bucket)
+	bucket.close()
+	if bucket.transport != nil {
+		bucket.transport.CloseIdleConnections()
+	}
+	if bucket.tracerProvider != nil {
+		// Export the spans still batched
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := bucket.tracerProvider.Shutdown(ctx); err != nil {
+			logger.Warn("Couldn't export the remaining spans", "bucket", bucket.BucketName, "error", err)
+		}
+	}
+	logger.Info("S3 bucket closed", "bucket", bucket.BucketName)
+	return okResult(nil)
+}
+
+// lookupBucket returns the bucket registered under handle, or nil. A published
+// S3Bucket is never modified, so callers use it without locking and the SDK
+// client serves requests concurrently.
+func lookupBucket(handle C.longlong) *S3Bucket {
+	bucket, ok := buckets.Load(int64(handle))
+	if !ok {
+		return nil
+	}
+	return bucket.(*S3Bucket)
+}
+
+// updateBucket replaces the bucket registered under handle with a modified
+// copy. bucketsMu serializes updates so concurrent setters don't lose changes.
+func updateBucket(handle C.longlong, update func(*S3Bucket)) error {
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+
+	current := lookupBucket(handle)
+	if current == nil {
+		return errInvalidHandle
+	}
+	updated := *current
+	update(&updated)
+	buckets.Store(int64(handle), &updated)
+	return nil
+}
+
+// progressInterval throttles progress callbacks so fast transfers don't
+// flood the FFI boundary.
+const progressInterval = 100 * time.Millisecond
+
+var (
+	progressCallback   C.progress_callback
+	progressCallbackMu sync.Mutex
+)
+
+// setProgressCallback registers the function called with bytes transferred and
+// total bytes (-1 when unknown) while uploads and downloads run. Pass NULL to
+// stop receiving progress.
+//
+//export setProgressCallback
+func setProgressCallback(callback C.progress_callback) {
+	progressCallbackMu.Lock()
+	defer progressCallbackMu.Unlock()
+
+	progressCallback = callback
+}
+
+// progressReader counts the bytes read through it and reports them to the
+// registered progress callback at most once per progressInterval.
+type progressReader struct {
+	reader   io.Reader
+	callback C.progress_callback
+	// mu guards the counters against the concurrent calls of ReadAt
+	mu          sync.Mutex
+	transferred int64
+	total       int64
+	lastReport  time.Time
+}
+
+// newProgressReader wraps reader, or returns it unchanged when no progress callback is registered.
+func newProgressReader(reader io.Reader, total int64) io.Reader {
+	progressCallbackMu.Lock()
+	callback := progressCallback
+	progressCallbackMu.Unlock()
+
+	if callback == nil {
+		return reader
+	}
+	return &progressReader{reader: reader, callback: callback, total: total}
+}
+
+// lengthOrUnknown returns the content length reported by S3, or -1 when absent.
+func lengthOrUnknown(contentLength *int64) int64 {
+	if contentLength == nil {
+		return -1
+	}
+	return *contentLength
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.reader.Read(buf)
+	p.transferred += int64(n)
+	if err == io.EOF || p.transferred == p.total || time.Since(p.lastReport) >= progressInterval {
+		p.report()
+	}
+	return n, err
+}
+
+// Seek lets the SDK rewind seekable bodies (for signing or retries); progress
+// restarts from the new position.
+func (p *progressReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := p.reader.(io.Seeker)
+	if !ok {
+		return 0, errors.New("progressReader: underlying reader is not seekable")
+	}
+	position, err := seeker.Seek(offset, whence)
+	if err == nil {
+		p.transferred = position
+	}
+	return position, err
+}
+
+// ReadAt lets the uploader read the parts of a multipart upload concurrently
+// as they are sent, instead of copying the body into part buffers first which
+// would report progress ahead of the network.
+func (p *progressReader) ReadAt(buf []byte, offset int64) (int, error) {
+	readerAt, ok := p.reader.(io.ReaderAt)
+	if !ok {
+		return 0, errors.New("progressReader: underlying reader doesn't support ReadAt")
+	}
+	n, err := readerAt.ReadAt(buf, offset)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.transferred += int64(n)
+	if p.total >= 0 {
+		// Parts read twice, to checksum them over plain HTTP or on a retry,
+		// must not report past the end
+		p.transferred = min(p.transferred, p.total)
+	}
+	if p.transferred == p.total || time.Since(p.lastReport) >= progressInterval {
+		p.report()
+	}
+	return n, err
+}
+
+func (p *progressReader) report() {
+	p.lastReport = time.Now()
+	C.invokeProgressCallback(p.callback, C.longlong(p.transferred), C.longlong(p.total))
+}
+
+// progressWriterAt is the io.WriterAt counterpart of progressReader, for the
+// downloader which writes parts concurrently.
+type progressWriterAt struct {
+	writer      io.WriterAt
+	callback    C.progress_callback
+	mu          sync.Mutex
+	transferred int64
+	total       int64
+	lastReport  time.Time
+}
+
+// newProgressWriterAt wraps writer, or returns it unchanged when no progress callback is registered.
+func newProgressWriterAt(writer io.WriterAt, total int64) io.WriterAt {
+	progressCallbackMu.Lock()
+	callback := progressCallback
+	progressCallbackMu.Unlock()
+
+	if callback == nil {
+		return writer
+	}
+	return &progressWriterAt{writer: writer, callback: callback, total: total}
+}
+
+func (p *progressWriterAt) WriteAt(buf []byte, offset int64) (int, error) {
+	n, err := p.writer.WriteAt(buf, offset)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.transferred += int64(n)
+	if p.transferred == p.total || time.Since(p.lastReport) >= progressInterval {
+		p.lastReport = time.Now()
+		C.invokeProgressCallback(p.callback, C.longlong(p.transferred), C.longlong(p.total))
+	}
+	return n, err
+}
+
+// globalBandwidth caps the traffic of every bucket together, nil when
+// unlimited, see setBandwidthLimit.
+var globalBandwidth atomic.Pointer[rateLimiter]
+
+// setBandwidthLimit caps the combined throughput of all transfers at
+// bytesPerSecond, in each direction, so background syncs don't saturate the
+// user's connection. Zero removes the cap.
+//
+//export setBandwidthLimit
+func setBandwidthLimit(bytesPerSecond C.longlong) *C.char {
+	if bytesPerSecond < 0 {
+		return errorResult("Error setting bandwidth limit", invalidArgument("bytesPerSecond must not be negative"))
+	}
+	if bytesPerSecond == 0 {
+		globalBandwidth.Store(nil)
+	} else {
+		globalBandwidth.Store(newRateLimiter(int64(bytesPerSecond)))
+	}
+	return okResult(nil)
+}
+
+// rateLimiter is a token bucket refilled at bytesPerSecond and holding at
+// most one second worth of tokens, shared by the readers it throttles.
+type rateLimiter struct {
+	bytesPerSecond float64
+	mu             sync.Mutex
+	tokens         float64
+	last           time.Time
+}
+
+// throttleChunk is the most bytes a throttled reader hands out between two
+// waits, so the throughput stays smooth instead of bursting.
+const throttleChunk = 32 * 1024
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	return &rateLimiter{bytesPerSecond: float64(bytesPerSecond), tokens: float64(bytesPerSecond), last: time.Now()}
+}
+
+// chunk returns the size reads are split into, never more than the bucket holds.
+func (l *rateLimiter) chunk() int {
+	return int(max(1, min(throttleChunk, l.bytesPerSecond)))
+}
+
+// wait takes n tokens, blocking until the bucket has refilled enough or ctx
+// is done. Tokens are taken up front, so concurrent callers queue up.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.bytesPerSecond, l.tokens+now.Sub(l.last).Seconds()*l.bytesPerSecond)
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.bytesPerSecond * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledReader reads at most as fast as every one of its limiters allows.
+type throttledReader struct {
+	ctx      context.Context
+	reader   io.ReadCloser
+	limiters []*rateLimiter
+	chunk    int
+}
+
+func newThrottledReader(ctx context.Context, reader io.ReadCloser, limiters []*rateLimiter) *throttledReader {
+	chunk := throttleChunk
+	for _, limiter := range limiters {
+		chunk = min(chunk, limiter.chunk())
+	}
+	return &throttledReader{ctx: ctx, reader: reader, limiters: limiters, chunk: chunk}
+}
+
+func (r *throttledReader) Read(buf []byte) (int, error) {
+	if len(buf) > r.chunk {
+		buf = buf[:r.chunk]
+	}
+	n, err := r.reader.Read(buf)
+	for _, limiter := range r.limiters {
+		if waitErr := limiter.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *throttledReader) Close() error {
+	return r.reader.Close()
+}
+
+// transferBandwidthKey is the context key of the rate limiter of a single
+// transfer, see S3Bucket.withBandwidthLimit.
+type transferBandwidthKey struct{}
+
+// throttlingTransport throttles the request and response bodies of the
+// bucket's HTTP client with the global limiter and the limiter of the
+// transfer the request belongs to, and counts them in the bucket's metrics.
+// Throttling bodies on the wire rather than the file being transferred covers
+// every part and retry of the transfer manager alike.
+type throttlingTransport struct {
+	base    http.RoundTripper
+	metrics *transferMetrics
+}
+
+func (t *throttlingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var limiters []*rateLimiter
+	if limiter := globalBandwidth.Load(); limiter != nil {
+		limiters = append(limiters, limiter)
+	}
+	if limiter, ok := req.Context().Value(transferBandwidthKey{}).(*rateLimiter); ok {
+		limiters = append(limiters, limiter)
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		if len(limiters) > 0 {
+			req.Body = newThrottledReader(req.Context(), req.Body, limiters)
+		}
+		req.Body = &countingReader{reader: req.Body, count: &t.metrics.bytesUploaded}
+	}
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	t.metrics.observe(time.Since(start), resp, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(limiters) > 0 {
+		resp.Body = newThrottledReader(req.Context(), resp.Body, limiters)
+	}
+	resp.Body = &countingReader{reader: resp.Body, count: &t.metrics.bytesDownloaded}
+	return resp, nil
+}
+
+// transferMetrics counts the HTTP traffic of a bucket, see getMetrics.
+type transferMetrics struct {
+	bytesUploaded   atomic.Int64
+	bytesDownloaded atomic.Int64
+	requests        atomic.Int64
+	errors          atomic.Int64
+	// latency is the total time waited for response headers.
+	latency atomic.Int64
+}
+
+// observe counts a request, and an error when it failed without a response
+// or with an error status.
+func (m *transferMetrics) observe(latency time.Duration, resp *http.Response, err error) {
+	m.requests.Add(1)
+	m.latency.Add(int64(latency))
+	if err != nil || resp.StatusCode >= http.StatusBadRequest {
+		m.errors.Add(1)
+	}
+}
+
+// metricsReport is the data of getMetrics.
+type metricsReport struct {
+	BytesUploaded   int64 `json:"bytesUploaded"`
+	BytesDownloaded int64 `json:"bytesDownloaded"`
+	Requests        int64 `json:"requests"`
+	Errors          int64 `json:"errors"`
+	// AverageLatencyMs is the average time to the response headers, zero
+	// without requests.
+	AverageLatencyMs float64 `json:"averageLatencyMs"`
+}
+
+// report returns the counters, and zeroes them when reset is set.
+func (m *transferMetrics) report(reset bool) metricsReport {
+	load := (*atomic.Int64).Load
+	if reset {
+		load = func(counter *atomic.Int64) int64 { return counter.Swap(0) }
+	}
+	report := metricsReport{
+		BytesUploaded:   load(&m.bytesUploaded),
+		BytesDownloaded: load(&m.bytesDownloaded),
+		Requests:        load(&m.requests),
+		Errors:          load(&m.errors),
+	}
+	if latency := load(&m.latency); report.Requests > 0 {
+		report.AverageLatencyMs = float64(latency) / float64(report.Requests) / float64(time.Millisecond)
+	}
+	return report
+}
+
+// countingReader adds the bytes read through it to count.
+type countingReader struct {
+	reader io.ReadCloser
+	count  *atomic.Int64
+}
+
+func (r *countingReader) Read(buf []byte) (int, error) {
+	n, err := r.reader.Read(buf)
+	r.count.Add(int64(n))
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	return r.reader.Close()
+}
+
+// getMetrics returns the bytes uploaded and downloaded, request and error
+// counts and average latency of a bucket's HTTP requests since initBucket,
+// or since the last reset. A non-zero reset zeroes them once returned.
+//
+//export getMetrics
+func getMetrics(handle C.longlong, reset C.int) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error getting metrics", errInvalidHandle)
+	}
+	return okResult(bucket.metrics.report(reset != 0))
+}
+
+// S3Bucket holds the S3 client and bucket name.
+type S3Bucket struct {
+	BucketName string
+	client     *s3.Client
+	// operationTimeout bounds every S3 call; zero means no timeout.
+	operationTimeout time.Duration
+	// masterKey enables client-side encryption when set, see encryptObject.
+	masterKey []byte
+	// baseContext, when set, is the parent of every operation context so
+	// closeBucket cancels every operation on the bucket. Async operations run
+	// on a copy with a child context, canceled by cancelOperation.
+	baseContext context.Context
+	// close cancels the bucket's baseContext, see closeBucket.
+	close context.CancelFunc
+	// transport carries the bucket's connections, nil when the client uses
+	// another HTTP client.
+	transport *http.Transport
+	// accountID is the account ID passed to initBucket, kept across
+	// updateCredentials.
+	accountID string
+	// roleProvider exchanges the static credentials for those of the role in
+	// the assumeRole option of initBucket, nil without one.
+	roleProvider func(source aws.CredentialsProvider) aws.CredentialsProvider
+	// fromCallback provides the credentials of the callback source, nil with
+	// another source.
+	fromCallback *callbackCredentials
+	// partSize and concurrency configure the uploader and downloader, the
+	// transfer manager's defaults apply when zero.
+	partSize    int64
+	concurrency int
+	// bandwidth caps the throughput of a single transfer, nil when
+	// unlimited, see withBandwidthLimit.
+	bandwidth *rateLimiter
+	// compression is the algorithm uploads are compressed with, none when
+	// empty, see withCompression.
+	compression string
+	// requestPayer is sent as x-amz-request-payer with every request, none
+	// when empty, see withRequestPayer.
+	requestPayer string
+	// diagnostics records the bucket's requests, nil unless the
+	// enableDiagnostics option was set.
+	diagnostics *diagnosticsLog
+	// metrics counts the traffic of the bucket's transport, see getMetrics.
+	metrics *transferMetrics
+	// retry is the retry option of initBucket, whose mode and retryable
+	// error codes configureRetries keeps.
+	retry retryOptions
+	// tracerProvider exports the spans of the bucket's operations, nil
+	// without the tracing option.
+	tracerProvider *sdktrace.TracerProvider
+}
+
+// operationContext returns the context passed to a single S3 call, bounded by
+// the configured operation timeout so a dead connection can't block the FFI call forever.
+func (b *S3Bucket) operationContext() (context.Context, context.CancelFunc) {
+	parent := b.baseContext
+	if parent == nil {
+		parent = context.Background()
+	}
+	if b.bandwidth != nil {
+		parent = context.WithValue(parent, transferBandwidthKey{}, b.bandwidth)
+	}
+	if b.operationTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, b.operationTimeout)
+}
+
+// withTimeout returns b itself when seconds is zero, otherwise a copy of b
+// whose operations are bounded by seconds instead of the bucket's timeout.
+func (b *S3Bucket) withTimeout(seconds int) *S3Bucket {
+	if seconds == 0 {
+		return b
+	}
+	bucket := *b
+	bucket.operationTimeout = time.Duration(seconds) * time.Second
+	return &bucket
+}
+
+// withBandwidthLimit returns b itself when bytesPerSecond is zero, otherwise
+// a copy of b whose operations share a cap of bytesPerSecond, on top of the
+// global one. Each transfer takes its own copy so the cap is per transfer.
+func (b *S3Bucket) withBandwidthLimit(bytesPerSecond int64) *S3Bucket {
+	if bytesPerSecond == 0 {
+		return b
+	}
+	bucket := *b
+	bucket.bandwidth = newRateLimiter(bytesPerSecond)
+	return &bucket
+}
+
+// withCompression returns b itself when algorithm is empty, otherwise a copy
+// of b whose uploads are compressed with algorithm, see compressionMetadata.
+func (b *S3Bucket) withCompression(algorithm string) *S3Bucket {
+	if algorithm == "" {
+		return b
+	}
+	bucket := *b
+	bucket.compression = algorithm
+	return &bucket
+}
+
+// withHeaders returns b itself when headers is empty, otherwise a copy of b
+// whose client adds headers to every request, e.g. x-amz-expected-bucket-owner
+// or a provider-specific header. Presigned requests get them signed.
+func (b *S3Bucket) withHeaders(headers map[string]string) *S3Bucket {
+	if len(headers) == 0 {
+		return b
+	}
+	bucket := *b
+	bucket.client = s3.New(b.client.Options(), func(o *s3.Options) {
+		// Clip so the copy never appends into the original client's options
+		o.APIOptions = append(slices.Clip(o.APIOptions), addHeaders(headers))
+	})
+	return &bucket
+}
+
+// addHeadersIDs numbers the middlewares of addHeaders, since a stack rejects
+// two middlewares with the same ID and a bucket copy can stack several, e.g.
+// the headers option of a call and x-amz-request-payer.
+var addHeadersIDs atomic.Int64
+
+// addHeaders returns a middleware setting headers on the HTTP request, before
+// it is signed.
+func addHeaders(headers map[string]string) func(*middleware.Stack) error {
+	id := fmt.Sprintf("AddHeaders%d", addHeadersIDs.Add(1))
+	return func(stack *middleware.Stack) error {
+		return stack.Build.Add(middleware.BuildMiddlewareFunc(id, func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+			if request, ok := in.Request.(*smithyhttp.Request); ok {
+				for name, value := range headers {
+					request.Header.Set(name, value)
+				}
+			}
+			return next.HandleBuild(ctx, in)
+		}), middleware.After)
+	}
+}
+
+// requestPayerRequester is the only x-amz-request-payer value, accepting the
+// charges of a requester pays bucket.
+const requestPayerRequester = string(types.RequestPayerRequester)
+
+// withRequestPayer returns b itself when payer is empty or already sent,
+// otherwise a copy of b sending x-amz-request-payer with every request, as
+// requester pays buckets require.
+func (b *S3Bucket) withRequestPayer(payer string) *S3Bucket {
+	if payer == "" || b.requestPayer != "" {
+		return b
+	}
+	bucket := b.withHeaders(map[string]string{"x-amz-request-payer": payer})
+	bucket.requestPayer = payer
+	return bucket
+}
+
+// explainRequesterPays adds a hint to access denied errors of a bucket not
+// sending x-amz-request-payer, which is how S3 rejects requests to requester
+// pays buckets, returning other errors unchanged.
+func (b *S3Bucket) explainRequesterPays(err error) error {
+	if b.requestPayer == "" && isForbidden(err) {
+		return fmt.Errorf("access denied, set the requestPayer option to requester if the bucket is requester pays: %w", err)
+	}
+	return err
+}
+
+// requestPayerOptions let a read charge the requester of a requester pays
+// bucket.
+type requestPayerOptions struct {
+	// RequestPayer is "requester" to accept the charges, empty otherwise.
+	RequestPayer string `json:"requestPayer"`
+}
+
+func (o requestPayerOptions) checkRequestPayer() error {
+	return checkRequestPayer(o.RequestPayer)
+}
+
+// checkRequestPayer rejects request payers other than requester. Empty means
+// none.
+func checkRequestPayer(payer string) error {
+	if payer != "" && payer != requestPayerRequester {
+		return invalidArgument("unsupported requestPayer %q, expected requester", payer)
+	}
+	return nil
+}
+
+// headerOptions add HTTP headers to the requests of a single transfer in the
+// options JSON of upload, download and presign, see S3Bucket.withHeaders.
+type headerOptions struct {
+	Headers map[string]string `json:"headers"`
+}
+
+// reservedHeaders are set by the SDK, overriding them would break signing.
+var reservedHeaders = []string{"Authorization", "Host", "Content-Length", "X-Amz-Date", "X-Amz-Content-Sha256", "X-Amz-Security-Token"}
+
+// checkHeaders rejects malformed and reserved header names, and values that
+// would split the request.
+func (o headerOptions) checkHeaders() error {
+	for name, value := range o.Headers {
+		if name == "" || strings.ContainsFunc(name, func(r rune) bool {
+			return r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r)
+		}) {
+			return invalidArgument("invalid header name %q", name)
+		}
+		if slices.Contains(reservedHeaders, http.CanonicalHeaderKey(name)) {
+			return invalidArgument("header %q is set by the client and can't be overridden", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return invalidArgument("header %q must not contain line breaks", name)
+		}
+	}
+	return nil
+}
+
+// canceled returns the error of a canceled async operation or closed bucket,
+// nil otherwise.
+// Operations spanning many requests check it to stop queueing work.
+func (b *S3Bucket) canceled() error {
+	if b.baseContext == nil {
+		return nil
+	}
+	return b.baseContext.Err()
+}
+
+// describeError turns an SDK error into the message returned to the caller,
+// calling out timeouts explicitly instead of surfacing a bare context error.
+func describeError(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Sprintf("operation timed out: %v", err)
+	}
+	return err.Error()
+}
+
+// result is the JSON envelope returned by every operation:
+// {"ok":true,"code":"","message":"","data":...} on success and
+// {"ok":false,"code":"NoSuchKey","message":"...","data":null} on failure.
+type result struct {
+	OK      bool   `json:"ok"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data"`
+}
+
+// invalidArgumentError marks a request rejected before reaching S3.
+type invalidArgumentError struct {
+	message string
+}
+
+func (e *invalidArgumentError) Error() string {
+	return e.message
+}
+
+func invalidArgument(format string, args ...any) error {
+	return &invalidArgumentError{message: fmt.Sprintf(format, args...)}
+}
+
+// errorCode extracts a machine-readable code from err: the S3 error code when
+// the service returned one, otherwise a code describing the local failure.
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	var argErr *invalidArgumentError
+	var notDeletedErr *sourceNotDeletedError
+	var decryptErr *decryptionError
+	var integrityErr *integrityError
+	switch {
+	case errors.Is(err, errInvalidHandle):
+		return "InvalidHandle"
+	case errors.Is(err, errMasterKeyMissing):
+		return "ClientEncryptionKeyMissing"
+	case errors.As(err, &decryptErr):
+		return "DecryptionFailed"
+	case errors.As(err, &integrityErr):
+		return "IntegrityCheckFailed"
+	case errors.As(err, &notDeletedErr):
+		return "SourceNotDeleted"
+	case errors.Is(err, errNoDeleteMarker):
+		return "NoDeleteMarker"
+	case errors.As(err, &apiErr):
+		return apiErr.ErrorCode()
+	case errors.As(err, &argErr):
+		return "InvalidArgument"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "Timeout"
+	case errors.Is(err, context.Canceled):
+		return "Canceled"
+	case isNotFound(err):
+		return "NotFound"
+	}
+	return ""
+}
+
+func marshalResult(envelope result) *C.char {
+	jsonResult, err := json.Marshal(envelope)
+	if err != nil {
+		logger.Error("Couldn't encode result", "error", err)
+		jsonResult, _ = json.Marshal(result{Code: "InternalError", Message: fmt.Sprintf("couldn't encode result: %v", err)})
+	}
+	return C.CString(string(jsonResult))
+}
+
+// okResult returns the success envelope wrapping value.
+func okResult(value any) *C.char {
+	return marshalResult(result{OK: true, Data: value})
+}
+
+// errorResult logs the failure and returns the error envelope. action
+// describes what was being done, e.g. "Error deleting object".
+func errorResult(action string, err error) *C.char {
+	message := fmt.Sprintf("%s: %s", action, describeError(err))
+	logger.Error(action, "code", errorCode(err), "error", describeError(err))
+	return marshalResult(result{OK: false, Code: errorCode(err), Message: message})
+}
+
+// logLevelOff is above every level, so nothing is logged.
+const logLevelOff = slog.Level(1 << 10)
+
+var (
+	// logLevel is the minimum level of logged records, info by default, see
+	// setLogLevel.
+	logLevel = new(slog.LevelVar)
+
+	logCallback C.log_callback
+	logFile     *os.File
+	logMu       sync.Mutex
+
+	// logger is the library's leveled logger. Records are written as text
+	// lines to the log callback and the log file when set, to stderr
+	// otherwise, see writeLog.
+	logger = slog.New(logHandler{})
+)
+
+// logHandler formats records with a slog.TextHandler and hands the line to
+// writeLog with the record's level.
+type logHandler struct {
+	// with replays the WithAttrs and WithGroup calls of the logger on the text
+	// handler of each record.
+	with []func(slog.Handler) slog.Handler
+}
+
+func (h logHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= logLevel.Level()
+}
+
+func (h logHandler) Handle(ctx context.Context, record slog.Record) error {
+	var line bytes.Buffer
+	var text slog.Handler = slog.NewTextHandler(&line, &slog.HandlerOptions{Level: slog.LevelDebug})
+	for _, with := range h.with {
+		text = with(text)
+	}
+	if err := text.Handle(ctx, record); err != nil {
+		return err
+	}
+	writeLog(record.Level, line.Bytes())
+	return nil
+}
+
+func (h logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return logHandler{with: append(slices.Clip(h.with), func(text slog.Handler) slog.Handler {
+		return text.WithAttrs(attrs)
+	})}
+}
+
+func (h logHandler) WithGroup(name string) slog.Handler {
+	return logHandler{with: append(slices.Clip(h.with), func(text slog.Handler) slog.Handler {
+		return text.WithGroup(name)
+	})}
+}
+
+// writeLog delivers a formatted line to the log callback and the log file,
+// or to stderr when neither is set.
+func writeLog(level slog.Level, line []byte) {
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	if logCallback != nil {
+		// The callback owns the message and releases it with freeCString
+		C.invokeLogCallback(logCallback, C.int(level), C.CString(string(bytes.TrimSuffix(line, []byte("\n")))))
+	}
+	if logFile != nil {
+		// A log that can't be written can't be reported either
+		_, _ = logFile.Write(line)
+	}
+	if logCallback == nil && logFile == nil {
+		_, _ = os.Stderr.Write(line)
+	}
+}
+
+// setLogLevel sets the minimum level of logged records: debug, info (the
+// default), warn, error or off.
+//
+//export setLogLevel
+func setLogLevel(level *C.char) *C.char {
+	switch levelStr := C.GoString(level); levelStr {
+	case "debug":
+		logLevel.Set(slog.LevelDebug)
+	case "info":
+		logLevel.Set(slog.LevelInfo)
+	case "warn":
+		logLevel.Set(slog.LevelWarn)
+	case "error":
+		logLevel.Set(slog.LevelError)
+	case "off":
+		logLevel.Set(logLevelOff)
+	default:
+		return errorResult("Error setting log level", invalidArgument("unsupported log level %q, expected debug, info, warn, error or off", levelStr))
+	}
+	return okResult(nil)
+}
+
+// setLogCallback registers the function log records are delivered to, with
+// their level (-4 debug, 0 info, 4 warn, 8 error) and the record formatted
+// as a logfmt line, which the callback must release with freeCString. It is
+// called from Go threads, so Dart must register a NativeCallable.listener.
+// A NULL callback unregisters it.
+//
+//export setLogCallback
+func setLogCallback(callback C.log_callback) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	logCallback = callback
+}
+
+// maxDiagnosticEntries is the number of requests a diagnostics log keeps, the
+// oldest are dropped first.
+const maxDiagnosticEntries = 200
+
+// diagnosticEntry summarizes an HTTP request, retries included. Headers,
+// query values and bodies are left out so it never carries credentials,
+// signatures or content.
+type diagnosticEntry struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Method    string    `json:"method"`
+	Host      string    `json:"host"`
+	Path      string    `json:"path"`
+	// Query lists the names of the query parameters, e.g. partNumber.
+	Query      []string `json:"query,omitempty"`
+	StatusCode int      `json:"statusCode,omitempty"`
+	// RequestID and ExtendedRequestID are the x-amz-request-id and
+	// x-amz-id-2 response headers providers ask for in support requests.
+	RequestID         string `json:"requestId,omitempty"`
+	ExtendedRequestID string `json:"extendedRequestId,omitempty"`
+	LatencyMs         int64  `json:"latencyMs"`
+	// Error is set when no response was received.
+	Error string `json:"error,omitempty"`
+}
+
+// diagnosticsReport is the data of getDiagnostics.
+type diagnosticsReport struct {
+	Entries []diagnosticEntry `json:"entries"`
+	// Dropped counts the entries dropped to keep maxDiagnosticEntries.
+	Dropped int `json:"dropped"`
+}
+
+// diagnosticsLog keeps the latest requests of a bucket.
+type diagnosticsLog struct {
+	mu      sync.Mutex
+	entries []diagnosticEntry
+	dropped int
+}
+
+// record is an API option adding every request sent over the wire to l.
+func (l *diagnosticsLog) record(stack *middleware.Stack) error {
+	// Innermost, so every attempt is timed alone with its raw response
+	return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc("Diagnostics", func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+		request, ok := in.Request.(*smithyhttp.Request)
+		if !ok {
+			return next.HandleDeserialize(ctx, in)
+		}
+		entry := diagnosticEntry{
+			Time:      time.Now().UTC(),
+			Operation: awsmiddleware.GetOperationName(ctx),
+			Method:    request.Method,
+			Host:      request.URL.Host,
+			Path:      request.URL.Path,
+		}
+		for name := range request.URL.Query() {
+			entry.Query = append(entry.Query, name)
+		}
+		slices.Sort(entry.Query)
+
+		out, metadata, err := next.HandleDeserialize(ctx, in)
+		entry.LatencyMs = time.Since(entry.Time).Milliseconds()
+		if response, ok := out.RawResponse.(*smithyhttp.Response); ok {
+			entry.StatusCode = response.StatusCode
+			entry.RequestID = response.Header.Get("X-Amz-Request-Id")
+			entry.ExtendedRequestID = response.Header.Get("X-Amz-Id-2")
+		}
+		if err != nil {
+			entry.Error = describeError(err)
+		}
+		l.add(entry)
+		return out, metadata, err
+	}), middleware.After)
+}
+
+func (l *diagnosticsLog) add(entry diagnosticEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) == maxDiagnosticEntries {
+		l.entries = slices.Delete(l.entries, 0, 1)
+		l.dropped++
+	}
+	l.entries = append(l.entries, entry)
+}
+
+// report returns the recorded entries, oldest first, and forgets them when
+// clear is set.
+func (l *diagnosticsLog) report(clear bool) diagnosticsReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	report := diagnosticsReport{Entries: slices.Clone(l.entries), Dropped: l.dropped}
+	if report.Entries == nil {
+		report.Entries = []diagnosticEntry{}
+	}
+	if clear {
+		l.entries, l.dropped = nil, 0
+	}
+	return report
+}
+
+// getDiagnostics returns the summaries of the latest requests of a bucket
+// initialized with the enableDiagnostics option, oldest first. A non-zero
+// clear forgets them once returned.
+//
+//export getDiagnostics
+func getDiagnostics(handle C.longlong, clear C.int) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error getting diagnostics", errInvalidHandle)
+	}
+	if bucket.diagnostics == nil {
+		return errorResult("Error getting diagnostics", invalidArgument("diagnostics are disabled, initialize the bucket with the enableDiagnostics option"))
+	}
+	return okResult(bucket.diagnostics.report(clear != 0))
+}
+
+// setLogFile appends log records to the file at path, created if needed. An
+// empty path closes the current log file.
+//
+//export setLogFile
+func setLogFile(path *C.char) *C.char {
+	var file *os.File
+	if pathStr := C.GoString(path); pathStr != "" {
+		var err error
+		file, err = os.OpenFile(pathStr, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return errorResult("Error opening log file", err)
+		}
+	}
+
+	logMu.Lock()
+	previous := logFile
+	logFile = file
+	logMu.Unlock()
+	if previous != nil {
+		if err := previous.Close(); err != nil {
+			return errorResult("Error closing log file", err)
+		}
+	}
+	return okResult(nil)
+}
+
+// setOperationTimeout bounds every subsequent call on the bucket with a
+// timeout of timeoutSeconds, 0 disabling it. Calls taking a timeoutSeconds
+// option override it for a single call.
+//
+//export setOperationTimeout
+func setOperationTimeout(handle C.longlong, timeoutSeconds C.int) *C.char {
+	if timeoutSeconds < 0 {
+		return errorResult("Error setting operation timeout", invalidArgument("timeoutSeconds must not be negative"))
+	}
+
+	err := updateBucket(handle, func(b *S3Bucket) {
+		b.operationTimeout = time.Duration(timeoutSeconds) * time.Second
+	})
+	if err != nil {
+		return errorResult("Error setting operation timeout", err)
+	}
+	return okResult(nil)
+}
+
+// retryOptions select the retry policy in the options JSON of initBucket.
+// Zero values keep the SDK defaults: 3 attempts, a jittered exponential
+// backoff capped at 20 seconds, retrying throttling, 5xx and connection errors.
+type retryOptions struct {
+	// MaxAttempts counts the first try, so 1 disables retries. 0 keeps the
+	// SDK default of 3 attempts, unlike the maxAttempts of configureRetries.
+	MaxAttempts int `json:"maxAttempts"`
+	// MaxBackoffSeconds caps the delay between attempts.
+	MaxBackoffSeconds int `json:"maxBackoffSeconds"`
+	// Mode is "standard" or "adaptive", which also rate limits requests on
+	// the client while the service is throttling.
+	Mode aws.RetryMode `json:"mode"`
+	// RetryableErrorCodes are S3 error codes retried on top of the defaults,
+	// e.g. "RequestTimeout".
+	RetryableErrorCodes []string `json:"retryableErrorCodes"`
+}
+
+func (o retryOptions) check() error {
+	if o.MaxAttempts < 0 || o.MaxBackoffSeconds < 0 {
+		return invalidArgument("maxAttempts and maxBackoffSeconds must not be negative")
+	}
+	switch o.Mode {
+	case "", aws.RetryModeStandard, aws.RetryModeAdaptive:
+		return nil
+	}
+	return invalidArgument("unsupported retry mode %q, expected standard or adaptive", o.Mode)
+}
+
+// newRetryer builds the SDK retryer implementing the policy.
+func (o retryOptions) newRetryer() aws.Retryer {
+	standardOptions := func(so *retry.StandardOptions) {
+		if o.MaxAttempts > 0 {
+			so.MaxAttempts = o.MaxAttempts
+		}
+		if o.MaxBackoffSeconds > 0 {
+			so.MaxBackoff = time.Duration(o.MaxBackoffSeconds) * time.Second
+		}
+		if len(o.RetryableErrorCodes) > 0 {
+			// First, so the codes are retried even where a default check says otherwise
+			so.Retryables = append([]retry.IsErrorRetryable{retry.RetryableErrorCode{Codes: retryableCodes(o.RetryableErrorCodes)}}, so.Retryables...)
+		}
+	}
+
+	if o.Mode == aws.RetryModeAdaptive {
+		return retry.NewAdaptiveMode(func(ao *retry.AdaptiveModeOptions) {
+			ao.StandardOptions = append(ao.StandardOptions, standardOptions)
+		})
+	}
+	return retry.NewStandard(standardOptions)
+}
+
+func retryableCodes(codes []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(codes))
+	for _, code := range codes {
+		set[code] = struct{}{}
+	}
+	return set
+}
+
+// configureRetries replaces the client's retry behaviour. maxAttempts counts
+// the first try, so 0 or 1 make a single attempt; unlike the maxAttempts of
+// the retry option of initBucket, 0 doesn't keep the SDK default of 3.
+// maxBackoffSeconds caps the delay between attempts, 0 keeps the SDK default.
+// The retry mode and retryable error codes set in the options of initBucket
+// are kept.
+//
+//export configureRetries
+func configureRetries(handle C.longlong, maxAttempts C.int, maxBackoffSeconds C.int) *C.char {
+	if err := (retryOptions{MaxAttempts: int(maxAttempts), MaxBackoffSeconds: int(maxBackoffSeconds)}).check(); err != nil {
+		return errorResult("Error configuring retries", err)
+	}
+
+	err := updateBucket(handle, func(b *S3Bucket) {
+		b.retry.MaxAttempts = int(maxAttempts)
+		b.retry.MaxBackoffSeconds = int(maxBackoffSeconds)
+
+		var retryer aws.Retryer = aws.NopRetryer{}
+		if maxAttempts > 0 {
+			retryer = b.retry.newRetryer()
+		}
+		b.client = s3.New(b.client.Options(), func(o *s3.Options) {
+			o.Retryer = retryer
+		})
+	})
+	if err != nil {
+		return errorResult("Error configuring retries", err)
+	}
+	return okResult(nil)
+}
+
+// bucketOptions are the optional settings of initBucket, decoded from its
+// optionsJson argument.
+type bucketOptions struct {
+	// TimeoutSeconds is the default operation timeout, see setOperationTimeout.
+	TimeoutSeconds int `json:"timeoutSeconds"`
+	// Retry replaces the SDK's default retry policy when set.
+	Retry *retryOptions `json:"retry"`
+	// CredentialSource is where credentials come from, see credentialSource*.
+	CredentialSource string `json:"credentialSource"`
+	// Profile selects the shared config profile of the default and sso
+	// sources instead of AWS_PROFILE or "default".
+	Profile string `json:"profile"`
+	// AssumeRole, when set, makes the bucket use temporary credentials of a
+	// role assumed with the source credentials.
+	AssumeRole *assumeRoleOptions `json:"assumeRole"`
+	// WebIdentity configures the webIdentity source.
+	WebIdentity *webIdentityOptions `json:"webIdentity"`
+	// CredentialsExpiration is when the keys passed to initBucket expire with
+	// the callback source. It is required with keys, which are then used until
+	// the app provides fresh ones.
+	CredentialsExpiration *time.Time `json:"credentialsExpiration"`
+	// PartSizeMB is the part size of multipart uploads and ranged downloads,
+	// 5 MB by default.
+	PartSizeMB int `json:"partSizeMB"`
+	// Concurrency is the number of parts transferred at once, 5 by default.
+	Concurrency int `json:"concurrency"`
+	// AddressingStyle overrides the usePathStyle argument of initBucket when
+	// set, see addressingStyle*.
+	AddressingStyle string `json:"addressingStyle"`
+	// AppID is appended to the User-Agent of every request as app/<AppID>,
+	// so server logs can attribute the traffic to the calling app.
+	AppID string `json:"appId"`
+	// Proxy routes every request of the bucket, STS and SSO calls included,
+	// through an HTTP or HTTPS proxy instead of HTTP_PROXY and HTTPS_PROXY.
+	Proxy *proxyOptions `json:"proxy"`
+	// TLS trusts extra certificate authorities and presents a client
+	// certificate, for endpoints behind an internal PKI.
+	TLS *tlsOptions `json:"tls"`
+	// AllowInsecure permits plain http:// endpoints and skips TLS certificate
+	// verification, like the insecureSkipVerify argument of initBucket, for
+	// local MinIO or localstack containers.
+	AllowInsecure bool `json:"allowInsecure"`
+	// DualStack sends requests to the IPv6 capable dual-stack endpoints of
+	// AWS.
+	DualStack bool `json:"dualStack"`
+	// Accelerate sends requests through S3 Transfer Acceleration, which must
+	// be enabled on the bucket.
+	Accelerate bool `json:"accelerate"`
+	// Provider applies the settings of a known S3-compatible provider, see
+	// provider*.
+	Provider string `json:"provider"`
+	// Jurisdiction selects the data location of R2 buckets, "eu" or
+	// "fedramp", the default location when empty.
+	Jurisdiction string `json:"jurisdiction"`
+	// RequestPayer is "requester" to accept the charges of every request to
+	// a requester pays bucket, see withRequestPayer.
+	RequestPayer string `json:"requestPayer"`
+	// EnableDiagnostics records a summary of the bucket's requests, see
+	// getDiagnostics.
+	EnableDiagnostics bool `json:"enableDiagnostics"`
+	// Tracing exports a span per S3 operation to an OpenTelemetry collector.
+	Tracing *tracingOptions `json:"tracing"`
+}
+
+// Providers of initBucket.
+const (
+	// providerR2 is Cloudflare R2: the endpoint is built from the account ID
+	// and jurisdiction, the region defaults to "auto", addressing to path
+	// style, and checksums are only computed when an operation requires
+	// them, as R2 rejects the SDK's default checksum trailers.
+	providerR2 = "r2"
+)
+
+// r2Endpoint builds the S3 API endpoint of a Cloudflare account.
+func r2Endpoint(accountID string, jurisdiction string) string {
+	if jurisdiction != "" {
+		return fmt.Sprintf("https://%s.%s.r2.cloudflarestorage.com", accountID, jurisdiction)
+	}
+	return fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID)
+}
+
+// maxAppIDLength is the longest application identifier the SDK accepts
+// without warning.
+const maxAppIDLength = 50
+
+// Addressing styles of initBucket.
+const (
+	// addressingStylePath puts the bucket in the path, endpoint/bucket/key.
+	addressingStylePath = "path"
+	// addressingStyleVirtual puts the bucket in the host name,
+	// bucket.endpoint/key.
+	addressingStyleVirtual = "virtual"
+	// addressingStyleAuto picks virtual-hosted addressing for AWS and path
+	// style for other providers such as MinIO and R2, see usesPathStyle.
+	addressingStyleAuto = "auto"
+)
+
+// usesPathStyle resolves the addressing of a bucket from its addressingStyle
+// option, falling back to the usePathStyle argument of initBucket.
+func usesPathStyle(style string, endpoint string, usePathStyle bool) bool {
+	switch style {
+	case addressingStylePath:
+		return true
+	case addressingStyleVirtual:
+		return false
+	case addressingStyleAuto:
+		return !isAWSEndpoint(endpoint)
+	}
+	return usePathStyle
+}
+
+// isAWSEndpoint reports whether endpoint is one of AWS S3, including the
+// SDK's default used when it is empty.
+func isAWSEndpoint(endpoint string) bool {
+	if endpoint == "" {
+		return true
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	return strings.HasSuffix(host, ".amazonaws.com") || strings.HasSuffix(host, ".amazonaws.com.cn") || strings.HasSuffix(host, ".api.aws")
+}
+
+// isPlainHTTP reports whether endpoint is an unencrypted http:// URL.
+func isPlainHTTP(endpoint string) bool {
+	parsed, err := url.Parse(endpoint)
+	return err == nil && strings.EqualFold(parsed.Scheme, "http")
+}
+
+// maxPartSizeMB is the largest part S3 accepts, 5 GB.
+const maxPartSizeMB = 5 * 1024
+
+// Credential sources of initBucket.
+const (
+	// credentialSourceStatic uses the keys passed to initBucket, the default.
+	credentialSourceStatic = "static"
+	// credentialSourceDefault ignores them and lets the SDK's default chain
+	// resolve credentials: environment variables, ~/.aws/credentials and
+	// ~/.aws/config, then container or EC2 instance metadata.
+	credentialSourceDefault = "default"
+	// credentialSourceSSO resolves credentials of an IAM Identity Center
+	// (SSO) profile from the token cached by "aws sso login".
+	credentialSourceSSO = "sso"
+	// credentialSourceWebIdentity exchanges an OIDC token, e.g. from Firebase
+	// or Cognito, for credentials of a role, see webIdentityOptions.
+	credentialSourceWebIdentity = "webIdentity"
+	// credentialSourceCallback asks the app for credentials through the
+	// credentials callback, see callbackCredentials.
+	credentialSourceCallback = "callback"
+	// credentialSourceAnonymous sends unsigned requests, for public buckets
+	// read without any credentials.
+	credentialSourceAnonymous = "anonymous"
+)
+
+// webIdentityOptions select the role assumed with AssumeRoleWithWebIdentity
+// and the OIDC token (JWT) proving the caller's identity. Exactly one of
+// Token and TokenFile is set.
+type webIdentityOptions struct {
+	RoleARN string `json:"roleArn"`
+	// Token is the JWT itself.
+	Token string `json:"token"`
+	// TokenFile is read again on every refresh, so an external process may
+	// rotate the token.
+	TokenFile string `json:"tokenFile"`
+	// SessionName identifies the session in CloudTrail, generated when empty.
+	SessionName string `json:"sessionName"`
+	// DurationSeconds is the lifetime of the credentials, 1 hour when zero.
+	DurationSeconds int `json:"durationSeconds"`
+}
+
+func (o webIdentityOptions) check() error {
+	if o.RoleARN == "" {
+		return invalidArgument("webIdentity requires a roleArn")
+	}
+	if (o.Token == "") == (o.TokenFile == "") {
+		return invalidArgument("webIdentity requires exactly one of token and tokenFile")
+	}
+	if o.DurationSeconds < 0 {
+		return invalidArgument("durationSeconds must not be negative")
+	}
+	return nil
+}
+
+// staticToken is an identity token passed inline instead of in a file.
+type staticToken string
+
+func (t staticToken) GetIdentityToken() ([]byte, error) {
+	return []byte(t), nil
+}
+
+// provider returns the credentials of the role, calling STS with the region
+// and HTTP client of cfg.
+func (o webIdentityOptions) provider(cfg aws.Config) aws.CredentialsProvider {
+	var token stscreds.IdentityTokenRetriever = staticToken(o.Token)
+	if o.TokenFile != "" {
+		token = stscreds.IdentityTokenFile(o.TokenFile)
+	}
+	return aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(sts.NewFromConfig(cfg), o.RoleARN, token, func(wo *stscreds.WebIdentityRoleOptions) {
+		wo.RoleSessionName = o.SessionName
+		wo.Duration = time.Duration(o.DurationSeconds) * time.Second
+	}))
+}
+
+// assumeRoleOptions select the IAM role assumed through STS, for backends
+// that hand out role-based access instead of long-lived keys.
+type assumeRoleOptions struct {
+	RoleARN string `json:"roleArn"`
+	// ExternalID is the external ID the role's trust policy may require.
+	ExternalID string `json:"externalId"`
+	// SessionName identifies the session in CloudTrail, generated when empty.
+	SessionName string `json:"sessionName"`
+	// DurationSeconds is the lifetime of the credentials, 15 minutes when zero.
+	// They are refreshed automatically before they expire.
+	DurationSeconds int `json:"durationSeconds"`
+}
+
+func (o assumeRoleOptions) check() error {
+	if o.RoleARN == "" {
+		return invalidArgument("assumeRole requires a roleArn")
+	}
+	if o.DurationSeconds < 0 {
+		return invalidArgument("durationSeconds must not be negative")
+	}
+	return nil
+}
+
+// roleProvider returns a function exchanging source credentials for those of
+// the role, calling STS with the region and HTTP client of cfg.
+func (o assumeRoleOptions) roleProvider(cfg aws.Config) func(source aws.CredentialsProvider) aws.CredentialsProvider {
+	return func(source aws.CredentialsProvider) aws.CredentialsProvider {
+		stsClient := sts.NewFromConfig(cfg, func(so *sts.Options) {
+			so.Credentials = source
+		})
+		return aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(stsClient, o.RoleARN, func(ro *stscreds.AssumeRoleOptions) {
+			if o.ExternalID != "" {
+				ro.ExternalID = aws.String(o.ExternalID)
+			}
+			ro.RoleSessionName = o.SessionName
+			ro.Duration = time.Duration(o.DurationSeconds) * time.Second
+		}))
+	}
+}
+
+// proxyOptions are the proxy settings of initBucket.
+type proxyOptions struct {
+	// URL is the proxy's http:// or https:// URL, e.g. http://proxy:3128.
+	URL string `json:"url"`
+	// Username and Password authenticate to the proxy with Basic auth,
+	// overriding credentials embedded in URL.
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// proxyURL parses and validates the proxy URL, with its credentials.
+func (o proxyOptions) proxyURL() (*url.URL, error) {
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return nil, invalidArgument("invalid proxy url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, invalidArgument("unsupported proxy url scheme %q, expected http or https", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, invalidArgument("proxy url %q has no host", u.Redacted())
+	}
+	if o.Password != "" && o.Username == "" {
+		return nil, invalidArgument("proxy password requires a username")
+	}
+	if o.Username != "" {
+		u.User = url.UserPassword(o.Username, o.Password)
+	}
+	return u, nil
+}
+
+// tlsOptions are the TLS settings of initBucket, PEM encoded.
+type tlsOptions struct {
+	// CABundle holds certificate authorities trusted on top of the system
+	// ones.
+	CABundle string `json:"caBundle"`
+	// ClientCertificate and ClientKey are presented to endpoints requiring
+	// mutual TLS, both or neither must be set.
+	ClientCertificate string `json:"clientCertificate"`
+	ClientKey         string `json:"clientKey"`
+}
+
+func (o tlsOptions) check() error {
+	if (o.ClientCertificate == "") != (o.ClientKey == "") {
+		return invalidArgument("tls clientCertificate and clientKey must be set together")
+	}
+	return nil
+}
+
+// apply adds the certificates to config, failing on PEM data that can't be
+// parsed.
+func (o tlsOptions) apply(config *tls.Config) error {
+	if o.CABundle != "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			// No system pool on this platform, only trust the bundle
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM([]byte(o.CABundle)) {
+			return invalidArgument("tls caBundle holds no valid PEM certificate")
+		}
+		config.RootCAs = roots
+	}
+	if o.ClientCertificate != "" {
+		certificate, err := tls.X509KeyPair([]byte(o.ClientCertificate), []byte(o.ClientKey))
+		if err != nil {
+			return invalidArgument("invalid tls client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return nil
+}
+
+// tracingShutdownTimeout bounds the export of the remaining spans by
+// closeBucket.
+const tracingShutdownTimeout = 5 * time.Second
+
+// defaultTracingServiceName is the service.name of exported spans when the
+// tracing option has none.
+const defaultTracingServiceName = "s3_client_dart"
+
+// tracingOptions are the OpenTelemetry settings of initBucket. Spans are
+// exported over OTLP/HTTP in batches.
+type tracingOptions struct {
+	// Endpoint is the http:// or https:// URL of the collector's traces
+	// endpoint, e.g. https://collector:4318/v1/traces.
+	Endpoint string `json:"endpoint"`
+	// Headers are sent with every export, e.g. an API key of the tracing
+	// backend.
+	Headers map[string]string `json:"headers"`
+	// ServiceName is the service.name resource attribute of the spans,
+	// defaultTracingServiceName when empty.
+	ServiceName string `json:"serviceName"`
+	// SampleRatio is the fraction of traces exported, between 0 and 1, all
+	// when nil.
+	SampleRatio *float64 `json:"sampleRatio"`
+}
+
+func (o tracingOptions) check() error {
+	u, err := url.Parse(o.Endpoint)
+	if err != nil {
+		return invalidArgument("invalid tracing endpoint: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return invalidArgument("tracing endpoint %q must be an http:// or https:// URL", u.Redacted())
+	}
+	if o.SampleRatio != nil && (*o.SampleRatio < 0 || *o.SampleRatio > 1) {
+		return invalidArgument("tracing sampleRatio must be between 0 and 1")
+	}
+	return nil
+}
+
+// newTracerProvider builds the provider exporting the bucket's spans. The
+// exporter connects lazily, so an unreachable collector only drops spans.
+func (o tracingOptions) newTracerProvider() (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(o.Endpoint), otlptracehttp.WithHeaders(o.Headers))
+	if err != nil {
+		return nil, err
+	}
+	serviceName := o.ServiceName
+	if serviceName == "" {
+		serviceName = defaultTracingServiceName
+	}
+	sampler := sdktrace.AlwaysSample()
+	if o.SampleRatio != nil {
+		sampler = sdktrace.TraceIDRatioBased(*o.SampleRatio)
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	), nil
+}
+
+// otelTracerProvider adapts an OpenTelemetry TracerProvider to the tracing
+// interface of the SDK, which starts a span per operation and per attempt.
+type otelTracerProvider struct {
+	provider trace.TracerProvider
+}
+
+func (p otelTracerProvider) Tracer(scope string, _ ...tracing.TracerOption) tracing.Tracer {
+	return otelTracer{tracer: p.provider.Tracer(scope)}
+}
+
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+func (t otelTracer) StartSpan(ctx context.Context, name string, opts ...tracing.SpanOption) (context.Context, tracing.Span) {
+	var options tracing.SpanOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	kind := trace.SpanKindInternal
+	switch options.Kind {
+	case tracing.SpanKindClient:
+		kind = trace.SpanKindClient
+	case tracing.SpanKindServer:
+		kind = trace.SpanKindServer
+	case tracing.SpanKindProducer:
+		kind = trace.SpanKindProducer
+	case tracing.SpanKindConsumer:
+		kind = trace.SpanKindConsumer
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(otelAttributes(options.Properties.Values())...))
+	adapted := otelSpan{span: span, name: name}
+	// The SDK finds the current span, e.g. to add request IDs, in ctx
+	return tracing.WithSpan(ctx, adapted), adapted
+}
+
+type otelSpan struct {
+	span trace.Span
+	name string
+}
+
+func (s otelSpan) Name() string {
+	return s.name
+}
+
+func (s otelSpan) Context() tracing.SpanContext {
+	spanContext := s.span.SpanContext()
+	return tracing.SpanContext{
+		TraceID:  spanContext.TraceID().String(),
+		SpanID:   spanContext.SpanID().String(),
+		IsRemote: spanContext.IsRemote(),
+	}
+}
+
+func (s otelSpan) AddEvent(name string, opts ...tracing.EventOption) {
+	var options tracing.EventOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	s.span.AddEvent(name, trace.WithAttributes(otelAttributes(options.Properties.Values())...))
+}
+
+func (s otelSpan) SetStatus(status tracing.SpanStatus) {
+	switch status {
+	case tracing.SpanStatusOK:
+		s.span.SetStatus(codes.Ok, "")
+	case tracing.SpanStatusError:
+		s.span.SetStatus(codes.Error, "")
+	}
+}
+
+func (s otelSpan) SetProperty(key, value any) {
+	s.span.SetAttributes(otelAttribute(key, value))
+}
+
+func (s otelSpan) End() {
+	s.span.End()
+}
+
+// otelAttributes converts span properties of the SDK to attributes.
+func otelAttributes(properties map[any]any) []attribute.KeyValue {
+	attributes := make([]attribute.KeyValue, 0, len(properties))
+	for key, value := range properties {
+		attributes = append(attributes, otelAttribute(key, value))
+	}
+	return attributes
+}
+
+func otelAttribute(key, value any) attribute.KeyValue {
+	name := fmt.Sprint(key)
+	switch v := value.(type) {
+	case string:
+		return attribute.String(name, v)
+	case bool:
+		return attribute.Bool(name, v)
+	case int:
+		return attribute.Int(name, v)
+	case int64:
+		return attribute.Int64(name, v)
+	case float64:
+		return attribute.Float64(name, v)
+	}
+	return attribute.String(name, fmt.Sprint(value))
+}
+
+// traceOperations is an API option completing the SDK's operation spans
+// with the request IDs and retry count of the operation, and sending the
+// W3C trace context with every request so servers can join the trace.
+func traceOperations(stack *middleware.Stack) error {
+	err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("TraceOperation", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		// The operation span, attempts have their own
+		span, _ := tracing.GetSpan(ctx)
+		if requestID, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+			span.SetProperty("aws.request_id", requestID)
+		}
+		if hostID, ok := s3.GetHostIDMetadata(metadata); ok {
+			span.SetProperty("aws.extended_request_id", hostID)
+		}
+		if results, ok := retry.GetAttemptResults(metadata); ok && len(results.Results) > 0 {
+			span.SetProperty("operation.retry_count", len(results.Results)-1)
+		}
+		return out, metadata, err
+	}), middleware.After)
+	if err != nil {
+		return err
+	}
+	// After signing, so the header is left out of the signature
+	return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("TraceContext", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		if request, ok := in.Request.(*smithyhttp.Request); ok {
+			propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(request.Header))
+		}
+		return next.HandleFinalize(ctx, in)
+	}), middleware.After)
+}
+
+// parseBucketOptions decodes the optionsJson argument of initBucket.
+func parseBucketOptions(optionsJson string) (bucketOptions, error) {
+	var options bucketOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	if options.TimeoutSeconds < 0 {
+		return options, invalidArgument("timeoutSeconds must not be negative")
+	}
+	if options.Retry != nil {
+		if err := options.Retry.check(); err != nil {
+			return options, err
+		}
+	}
+	switch options.CredentialSource {
+	case "":
+		options.CredentialSource = credentialSourceStatic
+	case credentialSourceStatic, credentialSourceDefault, credentialSourceSSO, credentialSourceWebIdentity, credentialSourceCallback, credentialSourceAnonymous:
+	default:
+		return options, invalidArgument("unsupported credentialSource %q, expected static, default, sso, webIdentity, callback or anonymous", options.CredentialSource)
+	}
+	if options.CredentialsExpiration != nil && options.CredentialSource != credentialSourceCallback {
+		return options, invalidArgument("credentialsExpiration requires the callback credentialSource")
+	}
+	if (options.WebIdentity != nil) != (options.CredentialSource == credentialSourceWebIdentity) {
+		return options, invalidArgument("the webIdentity credentialSource requires the webIdentity option, and only it")
+	}
+	if options.WebIdentity != nil {
+		if err := options.WebIdentity.check(); err != nil {
+			return options, err
+		}
+	}
+	if options.Profile != "" && (options.CredentialSource == credentialSourceStatic || options.CredentialSource == credentialSourceAnonymous) {
+		return options, invalidArgument("profile requires the default or sso credentialSource")
+	}
+	if options.AssumeRole != nil && options.CredentialSource == credentialSourceAnonymous {
+		return options, invalidArgument("assumeRole requires credentials, it can't be used with the anonymous credentialSource")
+	}
+	if options.AssumeRole != nil {
+		if err := options.AssumeRole.check(); err != nil {
+			return options, err
+		}
+	}
+	if options.PartSizeMB != 0 && (options.PartSizeMB < 5 || options.PartSizeMB > maxPartSizeMB) {
+		return options, invalidArgument("partSizeMB must be between 5 and %d", maxPartSizeMB)
+	}
+	if options.Concurrency < 0 {
+		return options, invalidArgument("concurrency must not be negative")
+	}
+	switch options.AddressingStyle {
+	case "", addressingStylePath, addressingStyleVirtual, addressingStyleAuto:
+	default:
+		return options, invalidArgument("unsupported addressingStyle %q, expected path, virtual or auto", options.AddressingStyle)
+	}
+	if len(options.AppID) > maxAppIDLength {
+		return options, invalidArgument("appId must be at most %d characters", maxAppIDLength)
+	}
+	if options.Proxy != nil {
+		if _, err := options.Proxy.proxyURL(); err != nil {
+			return options, err
+		}
+	}
+	if options.TLS != nil {
+		if err := options.TLS.check(); err != nil {
+			return options, err
+		}
+	}
+	if err := checkRequestPayer(options.RequestPayer); err != nil {
+		return options, err
+	}
+	if options.Tracing != nil {
+		if err := options.Tracing.check(); err != nil {
+			return options, err
+		}
+	}
+	switch options.Provider {
+	case "":
+	case providerR2:
+		if options.DualStack || options.Accelerate {
+			return options, invalidArgument("dualStack and accelerate are not supported by the r2 provider")
+		}
+		if options.AddressingStyle == "" {
+			options.AddressingStyle = addressingStylePath
+		}
+	default:
+		return options, invalidArgument("unsupported provider %q, expected r2", options.Provider)
+	}
+	switch options.Jurisdiction {
+	case "":
+	case "eu", "fedramp":
+		if options.Provider != providerR2 {
+			return options, invalidArgument("jurisdiction requires the r2 provider")
+		}
+	default:
+		return options, invalidArgument("unsupported jurisdiction %q, expected eu or fedramp", options.Jurisdiction)
+	}
+	return options, nil
+}
+
+// initBucket configures the client for a bucket. usePathStyle (1 or 0) selects
+// path-style addressing, needed by MinIO, unless the addressingStyle option
+// overrides it; "auto" picks virtual-hosted addressing for AWS and path style
+// for other endpoints. insecureSkipVerify (1 or 0) disables TLS certificate
+// verification, for self-signed development endpoints only.
+// optionsJson is an optional JSON object whose timeoutSeconds bounds every S3
+// call of the bucket, so a hung connection fails instead of blocking forever,
+// whose retry object sets the retry policy, see retryOptions, whose
+// credentialSource picks the static keys, the SDK's default chain, an SSO
+// profile, a web identity token or credentials provided by the app, and whose
+// assumeRole object makes those the source credentials of a role. Its
+// partSizeMB and concurrency tune multipart uploads and downloads.
+// It returns a result envelope whose data is the handle every other bucket
+// function takes, valid for the life of the process. Failures are returned,
+// never fatal, since they would otherwise take the host app down with them.
+//
+//export initBucket
+func initBucket(endpoint *C.char, bucketName *C.char, keyId *C.char, secretAccessKey *C.char, sessionToken *C.char, region *C.char, accountId *C.char, usePathStyle C.int, insecureSkipVerify C.int, optionsJson *C.char) *C.char {
+	ctx := context.TODO()
+
+	options, err := parseBucketOptions(C.GoString(optionsJson))
+	if err != nil {
+		return errorResult("Error initializing bucket", err)
+	}
+
+	// Convert C strings to Go strings and trim whitespace
+	endpointStr := C.GoString(endpoint)
+	regionStr := C.GoString(region)
+	accessKeyID := C.GoString(keyId)
+	secretKey := C.GoString(secretAccessKey)
+	sessionTokenStr := C.GoString(sessionToken)
+	accountIDStr := C.GoString(accountId)
+	if options.Provider == providerR2 {
+		if endpointStr == "" {
+			if accountIDStr == "" {
+				return errorResult("Error initializing bucket", invalidArgument("the r2 provider requires the accountId, or an endpoint"))
+			}
+			endpointStr = r2Endpoint(accountIDStr, options.Jurisdiction)
+		} else if options.Jurisdiction != "" {
+			return errorResult("Error initializing bucket", invalidArgument("jurisdiction can't be combined with an endpoint, which already selects it"))
+		}
+		if regionStr == "" {
+			regionStr = "auto"
+		}
+	}
+	pathStyle := usesPathStyle(options.AddressingStyle, endpointStr, usePathStyle != 0)
+	allowInsecure := options.AllowInsecure || insecureSkipVerify != 0
+	// The SDK would otherwise fail every request of the bucket
+	if (options.DualStack || options.Accelerate) && endpointStr != "" {
+		return errorResult("Error initializing bucket", invalidArgument("dualStack and accelerate require the default AWS endpoint, pass an empty endpoint"))
+	}
+	if options.Accelerate && pathStyle {
+		return errorResult("Error initializing bucket", invalidArgument("accelerate requires virtual-hosted addressing"))
+	}
+	if isPlainHTTP(endpointStr) && !allowInsecure {
+		return errorResult("Error initializing bucket", invalidArgument("plain http endpoint %q requires the allowInsecure option", endpointStr))
+	}
+
+	logger.Debug("Initializing S3 client",
+		"endpoint", endpointStr,
+		"region", regionStr,
+		"pathStyle", pathStyle,
+		"timeoutSeconds", options.TimeoutSeconds,
+		"credentialSource", options.CredentialSource)
+
+	// The bucket owns its transport, configured like the SDK's default one, so
+	// closeBucket can release its connections
+	transport := awshttp.NewBuildableClient().GetTransport()
+	if isPlainHTTP(endpointStr) {
+		logger.Warn("Requests are sent over plain HTTP, never use this in production", "endpoint", endpointStr)
+	}
+	if allowInsecure {
+		logger.Warn("TLS certificate verification is disabled, never use this in production")
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.InsecureSkipVerify = true
+	}
+	if options.TLS != nil {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		if err := options.TLS.apply(transport.TLSClientConfig); err != nil {
+			return errorResult("Error initializing bucket", err)
+		}
+	}
+	if options.Proxy != nil {
+		// Already validated by parseBucketOptions
+		proxyURL, _ := options.Proxy.proxyURL()
+		logger.Debug("Using proxy", "proxy", proxyURL.Redacted())
+		// The transport sends the credentials as Proxy-Authorization, on
+		// CONNECT for HTTPS endpoints
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	metrics := &transferMetrics{}
+	httpClient := &http.Client{
+		Transport: &throttlingTransport{base: transport, metrics: metrics},
+		// Like the SDK's client, return redirects to the SDK instead of following them
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	configOptions := []func(*config.LoadOptions) error{config.WithRegion(regionStr), config.WithHTTPClient(httpClient)}
+	if options.Profile != "" {
+		configOptions = append(configOptions, config.WithSharedConfigProfile(options.Profile))
+	}
+	if options.AppID != "" {
+		configOptions = append(configOptions, config.WithAppID(options.AppID))
+	}
+	if options.CredentialSource == credentialSourceSSO {
+		if err := checkSSOProfile(ctx, options.Profile); err != nil {
+			return errorResult("Error initializing bucket", err)
+		}
+	}
+
+	// Load default config with region
+	cfg, err := config.LoadDefaultConfig(ctx, configOptions...)
+	if err != nil {
+		return errorResult("Error initializing bucket", fmt.Errorf("couldn't load AWS configuration: %w", err))
+	}
+
+	var fromCallback *callbackCredentials
+	if options.CredentialSource == credentialSourceCallback {
+		if accessKeyID != "" && options.CredentialsExpiration == nil {
+			return errorResult("Error initializing bucket", invalidArgument("the callback credentialSource requires credentialsExpiration with keys"))
+		}
+		fromCallback = &callbackCredentials{}
+	}
+
+	var roleProvider func(aws.CredentialsProvider) aws.CredentialsProvider
+	if options.AssumeRole != nil {
+		roleProvider = options.AssumeRole.roleProvider(cfg)
+		logger.Debug("Assuming role", "roleArn", options.AssumeRole.RoleARN)
+	}
+
+	var diagnostics *diagnosticsLog
+	if options.EnableDiagnostics {
+		diagnostics = &diagnosticsLog{}
+	}
+	var tracerProvider *sdktrace.TracerProvider
+	if options.Tracing != nil {
+		tracerProvider, err = options.Tracing.newTracerProvider()
+		if err != nil {
+			return errorResult("Error initializing tracing", err)
+		}
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		// Set custom endpoint (for Cloudflare R2, MinIO, etc.)
+		if endpointStr != "" {
+			o.BaseEndpoint = aws.String(endpointStr)
+		}
+
+		// Path-style addressing is required for MinIO and some S3-compatible services
+		o.UsePathStyle = pathStyle
+
+		if options.Provider == providerR2 {
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+
+		o.UseAccelerate = options.Accelerate
+		if options.DualStack {
+			o.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+		}
+
+		if options.Retry != nil {
+			o.Retryer = options.Retry.newRetryer()
+		}
+
+		// Set credentials, the default chain and SSO profiles are already
+		// resolved by LoadDefaultConfig
+		switch options.CredentialSource {
+		case credentialSourceStatic:
+			o.Credentials = staticCredentials(accessKeyID, secretKey, sessionTokenStr, accountIDStr)
+		case credentialSourceWebIdentity:
+			o.Credentials = options.WebIdentity.provider(cfg)
+		case credentialSourceCallback:
+			o.Credentials = aws.NewCredentialsCache(fromCallback, func(co *aws.CredentialsCacheOptions) {
+				co.ExpiryWindow = credentialsExpiryWindow
+			})
+		case credentialSourceAnonymous:
+			o.Credentials = aws.AnonymousCredentials{}
+		}
+		if roleProvider != nil {
+			o.Credentials = roleProvider(o.Credentials)
+		}
+
+		if options.RequestPayer != "" {
+			o.APIOptions = append(o.APIOptions, addHeaders(map[string]string{"x-amz-request-payer": options.RequestPayer}))
+		}
+		if diagnostics != nil {
+			o.APIOptions = append(o.APIOptions, diagnostics.record)
+		}
+		if tracerProvider != nil {
+			o.TracerProvider = otelTracerProvider{provider: tracerProvider}
+			o.APIOptions = append(o.APIOptions, traceOperations)
+		}
+	})
+
+	var retryPolicy retryOptions
+	if options.Retry != nil {
+		retryPolicy = *options.Retry
+	}
+	handle := registerBucket(&S3Bucket{
+		BucketName:       C.GoString(bucketName),
+		client:           client,
+		operationTimeout: time.Duration(options.TimeoutSeconds) * time.Second,
+		transport:        transport,
+		accountID:        accountIDStr,
+		roleProvider:     roleProvider,
+		fromCallback:     fromCallback,
+		partSize:         int64(options.PartSizeMB) * 1024 * 1024,
+		concurrency:      options.Concurrency,
+		requestPayer:     options.RequestPayer,
+		diagnostics:      diagnostics,
+		metrics:          metrics,
+		retry:            retryPolicy,
+		tracerProvider:   tracerProvider,
+	})
+	if fromCallback != nil {
+		// Set once registered so the prefetch can find the bucket
+		fromCallback.handle.Store(int64(handle))
+		if accessKeyID != "" {
+			fromCallback.set(aws.Credentials{
+				AccessKeyID:     accessKeyID,
+				SecretAccessKey: secretKey,
+				SessionToken:    sessionTokenStr,
+				Source:          "callback",
+				CanExpire:       true,
+				Expires:         *options.CredentialsExpiration,
+			})
+		}
+	}
+	logger.Info("S3 bucket initialized", "bucket", C.GoString(bucketName), "handle", handle)
+	return okResult(handle)
+}
+
+// checkSSOProfile fails unless profile, or the default profile when empty, is
+// configured for IAM Identity Center, so the sso source can't silently fall
+// back to other credentials of the profile.
+func checkSSOProfile(ctx context.Context, profile string) error {
+	// Resolve the profile and files the way LoadDefaultConfig does
+	env, err := config.NewEnvConfig()
+	if err != nil {
+		return invalidArgument("couldn't read AWS environment variables: %v", err)
+	}
+	if profile == "" {
+		profile = env.SharedConfigProfile
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	sharedConfig, err := config.LoadSharedConfigProfile(ctx, profile, func(o *config.LoadSharedConfigOptions) {
+		if env.SharedConfigFile != "" {
+			o.ConfigFiles = []string{env.SharedConfigFile}
+		}
+		if env.SharedCredentialsFile != "" {
+			o.CredentialsFiles = []string{env.SharedCredentialsFile}
+		}
+	})
+	if err != nil {
+		return invalidArgument("couldn't load profile %q: %v", profile, err)
+	}
+	if sharedConfig.SSOSessionName == "" && sharedConfig.SSOStartURL == "" {
+		return invalidArgument("profile %q is not configured for SSO, expected sso_session or sso_start_url", profile)
+	}
+	return nil
+}
+
+// staticCredentials returns a provider of fixed credentials. sessionToken and
+// accountID are optional.
+func staticCredentials(accessKeyID string, secretKey string, sessionToken string, accountID string) aws.CredentialsProvider {
+	return aws.NewCredentialsCache(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		creds := aws.Credentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretKey,
+			Source:          "static",
+		}
+
+		// Only set session token if provided
+		if sessionToken != "" {
+			creds.SessionToken = sessionToken
+		}
+
+		// Only set account ID if provided
+		if accountID != "" {
+			creds.AccountID = accountID
+		}
+
+		return creds, nil
+	}))
+}
+
+// updateCredentials replaces the bucket's credentials, e.g. with a refreshed
+// STS token, without re-initializing it: the handle, its settings and the
+// encryption key are kept, and operations already running finish with the
+// credentials they started with. sessionToken may be empty. With the
+// assumeRole option, they replace the credentials the role is assumed with;
+// a bucket using another credential source switches to them.
+//
+//export updateCredentials
+func updateCredentials(handle C.longlong, keyId *C.char, secretAccessKey *C.char, sessionToken *C.char) *C.char {
+	accessKeyID := C.GoString(keyId)
+	secretKey := C.GoString(secretAccessKey)
+	if accessKeyID == "" || secretKey == "" {
+		return errorResult("Error updating credentials", invalidArgument("keyId and secretAccessKey must not be empty"))
+	}
+	sessionTokenStr := C.GoString(sessionToken)
+
+	err := updateBucket(handle, func(b *S3Bucket) {
+		b.client = s3.New(b.client.Options(), func(o *s3.Options) {
+			o.Credentials = staticCredentials(accessKeyID, secretKey, sessionTokenStr, b.accountID)
+			if b.roleProvider != nil {
+				o.Credentials = b.roleProvider(o.Credentials)
+			}
+		})
+		b.fromCallback = nil
+	})
+	if err != nil {
+		return errorResult("Error updating credentials", err)
+	}
+	return okResult(nil)
+}
+
+// setBucketRegion changes the region the bucket's requests are signed for
+// and sent to, for a bucket living in another region than the one passed to
+// initBucket, without initializing it again. An empty region detects the
+// bucket's region from the x-amz-bucket-region header of a HeadBucket
+// request. The region is returned as data.
+//
+//export setBucketRegion
+func setBucketRegion(handle C.longlong, region *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error setting bucket region", errInvalidHandle)
+	}
+
+	regionStr := C.GoString(region)
+	if regionStr == "" {
+		ctx, cancel := bucket.operationContext()
+		defer cancel()
+
+		detected, err := manager.GetBucketRegion(ctx, bucket.client, bucket.BucketName)
+		if err != nil {
+			return errorResult("Error detecting bucket region", err)
+		}
+		regionStr = detected
+	}
+
+	err := updateBucket(handle, func(b *S3Bucket) {
+		b.client = s3.New(b.client.Options(), func(o *s3.Options) {
+			o.Region = regionStr
+		})
+	})
+	if err != nil {
+		return errorResult("Error setting bucket region", err)
+	}
+	return okResult(regionStr)
+}
+
+// Credentials of the callback source are owned by the app. They are requested
+// through the credentials callback ahead of their expiry, and the app answers
+// asynchronously with provideCredentials, so a blocking call made from the
+// app's own thread doesn't wait on an answer that thread must send.
+const (
+	// credentialsPrefetchWindow is how long before expiry fresh credentials
+	// are requested.
+	credentialsPrefetchWindow = 5 * time.Minute
+	// credentialsExpiryWindow is how long before expiry the SDK's cache stops
+	// using credentials, by then normally replaced by the prefetched ones.
+	credentialsExpiryWindow = time.Minute
+	// credentialsRequestTimeout bounds the wait for an answer.
+	credentialsRequestTimeout = 30 * time.Second
+)
+
+var (
+	credentialsCallback   C.credentials_callback
+	credentialsCallbackMu sync.Mutex
+	// pendingCredentials maps the id of every unanswered credentials request
+	// to the channel its answer is delivered on.
+	pendingCredentials       sync.Map // int64 -> chan credentialsAnswer
+	nextCredentialsRequestID atomic.Int64
+)
+
+type credentialsAnswer struct {
+	credentials aws.Credentials
+	err         error
+}
+
+// setCredentialsCallback registers the function called with a bucket handle
+// and a request id when a bucket using the callback credential source needs
+// fresh credentials. It is called from a Go thread, so Dart must register a
+// NativeCallable.listener, then answer with provideCredentials.
+//
+//export setCredentialsCallback
+func setCredentialsCallback(callback C.credentials_callback) {
+	credentialsCallbackMu.Lock()
+	defer credentialsCallbackMu.Unlock()
+	credentialsCallback = callback
+}
+
+// providedCredentials is the JSON shape of the answer to a credentials
+// request. Error reports that the app couldn't get credentials.
+type providedCredentials struct {
+	AccessKeyID     string     `json:"accessKeyId"`
+	SecretAccessKey string     `json:"secretAccessKey"`
+	SessionToken    string     `json:"sessionToken"`
+	Expiration      *time.Time `json:"expiration"`
+	Error           string     `json:"error"`
+}
+
+func parseProvidedCredentials(credentialsJson string) (aws.Credentials, error) {
+	var provided providedCredentials
+	if err := decodeOptions(credentialsJson, &provided); err != nil {
+		return aws.Credentials{}, err
+	}
+	if provided.Error != "" {
+		return aws.Credentials{}, fmt.Errorf("app couldn't provide credentials: %s", provided.Error)
+	}
+	if provided.AccessKeyID == "" || provided.SecretAccessKey == "" {
+		return aws.Credentials{}, invalidArgument("provided credentials require accessKeyId and secretAccessKey")
+	}
+
+	credentials := aws.Credentials{
+		AccessKeyID:     provided.AccessKeyID,
+		SecretAccessKey: provided.SecretAccessKey,
+		SessionToken:    provided.SessionToken,
+		Source:          "callback",
+	}
+	if provided.Expiration != nil {
+		credentials.CanExpire = true
+		credentials.Expires = *provided.Expiration
+	}
+	return credentials, nil
+}
+
+// provideCredentials answers the credentials request requestID with a JSON
+// object of accessKeyId, secretAccessKey, sessionToken and expiration
+// (RFC 3339), or {"error":"..."} if the app couldn't get credentials. Returns
+// 1 if the answer was delivered, 0 if the request is unknown, already answered
+// or timed out.
+//
+//export provideCredentials
+func provideCredentials(requestID C.longlong, credentialsJson *C.char) C.int {
+	answers, ok := pendingCredentials.LoadAndDelete(int64(requestID))
+	if !ok {
+		return 0
+	}
+	credentials, err := parseProvidedCredentials(C.GoString(credentialsJson))
+	answers.(chan credentialsAnswer) <- credentialsAnswer{credentials: credentials, err: err}
+	return 1
+}
+
+// callbackCredentials is the credentials provider of the callback source,
+// wrapped in the SDK's cache which decides when to retrieve them again.
+type callbackCredentials struct {
+	handle atomic.Int64 // set once the bucket is registered
+
+	mu      sync.Mutex
+	current aws.Credentials
+	timer   *time.Timer // prefetches credentials before current expires
+}
+
+// Retrieve returns the credentials prefetched ahead of expiry, and only
+// requests them when they are missing or about to expire.
+func (p *callbackCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	p.mu.Lock()
+	current := p.current
+	p.mu.Unlock()
+	if current.HasKeys() && (!current.CanExpire || time.Until(current.Expires) > credentialsExpiryWindow) {
+		return current, nil
+	}
+	return p.request(ctx)
+}
+
+// request asks the app for credentials and waits for its answer.
+func (p *callbackCredentials) request(ctx context.Context) (aws.Credentials, error) {
+	credentialsCallbackMu.Lock()
+	callback := credentialsCallback
+	credentialsCallbackMu.Unlock()
+	if callback == nil {
+		return aws.Credentials{}, errors.New("no credentials callback registered, call setCredentialsCallback first")
+	}
+
+	id := nextCredentialsRequestID.Add(1)
+	answers := make(chan credentialsAnswer, 1)
+	pendingCredentials.Store(id, answers)
+	defer pendingCredentials.Delete(id)
+	C.invokeCredentialsCallback(callback, C.longlong(p.handle.Load()), C.longlong(id))
+
+	ctx, cancel := context.WithTimeout(ctx, credentialsRequestTimeout)
+	defer cancel()
+	select {
+	case answer := <-answers:
+		if answer.err != nil {
+			return aws.Credentials{}, answer.err
+		}
+		p.set(answer.credentials)
+		return answer.credentials, nil
+	case <-ctx.Done():
+		return aws.Credentials{}, fmt.Errorf("no answer to credentials request %d: %w", id, ctx.Err())
+	}
+}
+
+// set stores credentials and schedules their prefetch. Credentials already
+// within the prefetch window aren't prefetched, which would request them again
+// at once and loop; Retrieve requests them when the SDK's cache expires them.
+func (p *callbackCredentials) set(credentials aws.Credentials) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.current = credentials
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if !credentials.CanExpire {
+		return
+	}
+	if delay := time.Until(credentials.Expires) - credentialsPrefetchWindow; delay > 0 {
+		p.timer = time.AfterFunc(delay, p.prefetch)
+	}
+}
+
+func (p *callbackCredentials) prefetch() {
+	// Stop once the bucket is closed or uses other credentials
+	bucket := lookupBucket(C.longlong(p.handle.Load()))
+	if bucket == nil || bucket.fromCallback != p {
+		return
+	}
+	if _, err := p.request(context.Background()); err != nil {
+		logger.Warn("Couldn't refresh credentials ahead of expiry, retrying on the next request", "error", err)
+	}
+}
+
+// Client-side envelope encryption: every object gets its own random data key,
+// the payload is sealed with AES-256-GCM under it, and the data key is itself
+// sealed under the bucket's master key and stored in the object's metadata.
+// The provider only ever sees ciphertext.
+const (
+	cseKeyMetadata       = "cse-key"   // nonce || data key sealed under the master key
+	cseNonceMetadata     = "cse-nonce" // nonce of the payload
+	cseAlgorithmMetadata = "cse-algorithm"
+	cseAlgorithm         = "AES-256-GCM"
+	cseKeySize           = 32
+)
+
+// errMasterKeyMissing is returned when reading a client-side encrypted object
+// from a bucket without a master key.
+var errMasterKeyMissing = errors.New("object is client-side encrypted but no master key is set, call setClientEncryptionKey first")
+
+// decryptionError reports a client-side encrypted object that couldn't be
+// decrypted: the master key is wrong or the object was tampered with.
+type decryptionError struct {
+	err error
+}
+
+func (e *decryptionError) Error() string {
+	return fmt.Sprintf("couldn't decrypt object: %v", e.err)
+}
+
+func (e *decryptionError) Unwrap() error {
+	return e.err
+}
+
+// sealGCM encrypts plaintext under key with AES-GCM and a random nonce.
+func sealGCM(key []byte, plaintext []byte) (nonce []byte, ciphertext []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plaintext, nil), nil
+}
+
+// openGCM decrypts and authenticates ciphertext sealed by sealGCM.
+func openGCM(key []byte, nonce []byte, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length %d", len(nonce))
+	}
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// metadataValue looks up a user metadata key case-insensitively, since
+// backends differ in how they case the keys they return.
+func metadataValue(metadata map[string]string, key string) (string, bool) {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// isClientEncrypted reports whether metadata marks a client-side encrypted object.
+func isClientEncrypted(metadata map[string]string) bool {
+	_, ok := metadataValue(metadata, cseKeyMetadata)
+	return ok
+}
+
+// encryptObject seals data under a fresh data key and returns the ciphertext
+// with the metadata needed to decrypt it. The data key isn't bound to the
+// object key, so encrypted objects can still be copied and moved server-side.
+func (b *S3Bucket) encryptObject(data []byte) ([]byte, map[string]string, error) {
+	dataKey := make([]byte, cseKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	nonce, ciphertext, err := sealGCM(dataKey, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyNonce, wrappedKey, err := sealGCM(b.masterKey, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata := map[string]string{
+		cseKeyMetadata:       base64.StdEncoding.EncodeToString(append(keyNonce, wrappedKey...)),
+		cseNonceMetadata:     base64.StdEncoding.EncodeToString(nonce),
+		cseAlgorithmMetadata: cseAlgorithm,
+	}
+	return ciphertext, metadata, nil
+}
+
+// decryptObject reverses encryptObject using the metadata stored with the object.
+func (b *S3Bucket) decryptObject(ciphertext []byte, metadata map[string]string) ([]byte, error) {
+	if len(b.masterKey) == 0 {
+		return nil, errMasterKeyMissing
+	}
+	if algorithm, _ := metadataValue(metadata, cseAlgorithmMetadata); algorithm != cseAlgorithm {
+		return nil, &decryptionError{err: fmt.Errorf("unsupported algorithm %q", algorithm)}
+	}
+
+	encodedKey, _ := metadataValue(metadata, cseKeyMetadata)
+	sealedKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, &decryptionError{err: fmt.Errorf("invalid wrapped key: %w", err)}
+	}
+	encodedNonce, _ := metadataValue(metadata, cseNonceMetadata)
+	nonce, err := base64.StdEncoding.DecodeString(encodedNonce)
+	if err != nil {
+		return nil, &decryptionError{err: fmt.Errorf("invalid nonce: %w", err)}
+	}
+
+	// The wrapped key is prefixed by the nonce it was sealed with, which has
+	// the same length as the payload nonce
+	if len(sealedKey) < len(nonce) {
+		return nil, &decryptionError{err: errors.New("wrapped key is truncated")}
+	}
+	dataKey, err := openGCM(b.masterKey, sealedKey[:len(nonce)], sealedKey[len(nonce):])
+	if err != nil {
+		return nil, &decryptionError{err: fmt.Errorf("couldn't unwrap data key, is the master key right? %w", err)}
+	}
+	plaintext, err := openGCM(dataKey, nonce, ciphertext)
+	if err != nil {
+		return nil, &decryptionError{err: err}
+	}
+	return plaintext, nil
+}
+
+// openBody returns a reader over the content of a GetObject result that
+// reports progress, decrypting client-side encrypted objects and
+// decompressing objects compressed by upload. GCM only authenticates a
+// payload once it is complete, so encrypted objects are read fully before any
+// byte is handed out.
+func (b *S3Bucket) openBody(result *s3.GetObjectOutput) (io.Reader, error) {
+	var body io.Reader = newProgressReader(result.Body, lengthOrUnknown(result.ContentLength))
+	if isClientEncrypted(result.Metadata) {
+		ciphertext, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := b.decryptObject(ciphertext, result.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(plaintext)
+	}
+	if algorithm, ok := isCompressed(result.Metadata); ok {
+		return newDecompressor(algorithm, body)
+	}
+	return body, nil
+}
+
+// setClientEncryptionKey enables client-side encryption for the bucket with a
+// base64-encoded 256-bit master key: uploads are encrypted before they leave
+// the process and downloads of encrypted objects are decrypted transparently.
+// An empty key disables encryption of new uploads.
+//
+//export setClientEncryptionKey
+func setClientEncryptionKey(handle C.longlong, masterKeyBase64 *C.char) *C.char {
+	var masterKey []byte
+	if encoded := C.GoString(masterKeyBase64); encoded != "" {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return errorResult("Error setting client encryption key", invalidArgument("master key is not valid base64: %v", err))
+		}
+		if len(decoded) != cseKeySize {
+			return errorResult("Error setting client encryption key", invalidArgument("master key must be 256 bits, got %d bits", len(decoded)*8))
+		}
+		masterKey = decoded
+	}
+
+	err := updateBucket(handle, func(b *S3Bucket) {
+		b.masterKey = masterKey
+	})
+	if err != nil {
+		return errorResult("Error setting client encryption key", err)
+	}
+	return okResult(nil)
+}
+
+// putFile uploads the file at filePath under objectKey. customize, when not nil,
+// can set extra fields (content type, metadata, ...) on the request before it is sent.
+// Files larger than the part size are sent as a multipart upload, see uploader.
+func (b *S3Bucket) putFile(filePath string, objectKey string, customize func(*s3.PutObjectInput)) (*manager.UploadOutput, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open file %v to upload: %w", filePath, err)
+	}
+	defer file.Close()
+
+	if len(b.masterKey) > 0 {
+		// Client-side encryption seals the whole file at once
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read file %v: %w", filePath, err)
+		}
+		output, err := b.putBytes(data, objectKey, customize)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't upload file %v: %w", filePath, err)
+		}
+		return output, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read file %v: %w", filePath, err)
+	}
+	input := b.putInput(objectKey, customize)
+	input.Body = newProgressReader(file, info.Size())
+	if b.compression != "" {
+		compressed := compressingReader(b.compression, input.Body)
+		defer compressed.Close()
+		input.Body = compressed
+	}
+	output, err := b.put(input)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't upload file %v: %w", filePath, err)
+	}
+	return output, nil
+}
+
+// putBytes uploads data under objectKey, see putFile for customize.
+func (b *S3Bucket) putBytes(data []byte, objectKey string, customize func(*s3.PutObjectInput)) (*manager.UploadOutput, error) {
+	input := b.putInput(objectKey, customize)
+	if b.compression != "" {
+		compressed, err := compressBytes(b.compression, data)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't compress %v: %w", objectKey, err)
+		}
+		data = compressed
+	}
+	if len(b.masterKey) > 0 {
+		ciphertext, encryptionMetadata, err := b.encryptObject(data)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't encrypt %v: %w", objectKey, err)
+		}
+		metadata := maps.Clone(input.Metadata)
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		maps.Copy(metadata, encryptionMetadata)
+		input.Metadata = metadata
+		data = ciphertext
+	}
+	input.Body = newProgressReader(bytes.NewReader(data), int64(len(data)))
+	return b.put(input)
+}
+
+// putInput returns the request uploading objectKey, customized by customize
+// when not nil and marked as compressed when the bucket compresses uploads.
+func (b *S3Bucket) putInput(objectKey string, customize func(*s3.PutObjectInput)) *s3.PutObjectInput {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(objectKey),
+	}
+	if customize != nil {
+		customize(input)
+	}
+	if b.compression != "" {
+		metadata := maps.Clone(input.Metadata)
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		metadata[compressionMetadata] = b.compression
+		input.Metadata = metadata
+		// Encrypted bodies aren't in the compressed format, so they must not
+		// advertise it to browsers and CDNs
+		if len(b.masterKey) == 0 {
+			input.ContentEncoding = aws.String(b.compression)
+		}
+	}
+	return input
+}
+
+// put sends input, whose Body is set, through the bucket's uploader.
+func (b *S3Bucket) put(input *s3.PutObjectInput) (*manager.UploadOutput, error) {
+	ctx, cancel := b.operationContext()
+	defer cancel()
+
+	output, err := b.uploader().Upload(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't upload to %v:%v: %w", b.BucketName, aws.ToString(input.Key), err)
+	}
+	return output, nil
+}
+
+// uploader returns the transfer manager of the bucket's uploads: bodies
+// larger than the part size are split into a multipart upload whose parts
+// are sent concurrently and retried individually, and aborted on failure.
+func (b *S3Bucket) uploader() *manager.Uploader {
+	return manager.NewUploader(b.client, func(u *manager.Uploader) {
+		if b.partSize > 0 {
+			u.PartSize = b.partSize
+		}
+		if b.concurrency > 0 {
+			u.Concurrency = b.concurrency
+		}
+	})
+}
+
+// downloader is the counterpart of uploader for downloads, fetching parts of
+// the object with concurrent ranged GetObject requests.
+func (b *S3Bucket) downloader() *manager.Downloader {
+	return manager.NewDownloader(b.client, func(d *manager.Downloader) {
+		if b.partSize > 0 {
+			d.PartSize = b.partSize
+		}
+		if b.concurrency > 0 {
+			d.Concurrency = b.concurrency
+		}
+	})
+}
+
+// compressionMetadata marks objects compressed by upload, with the algorithm
+// as value, so they are decompressed transparently when downloaded. The
+// Content-Encoding header alone isn't enough since objects uploaded already
+// compressed carry it too and are downloaded as they are.
+const compressionMetadata = "compression"
+
+// Compression algorithms of the compression upload option.
+const (
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+// isCompressed reports whether metadata marks an object compressed by upload,
+// returning the algorithm.
+func isCompressed(metadata map[string]string) (string, bool) {
+	return metadataValue(metadata, compressionMetadata)
+}
+
+// newCompressor returns a writer compressing to w with algorithm.
+func newCompressor(algorithm string, w io.Writer) (io.WriteCloser, error) {
+	switch algorithm {
+	case compressionGzip:
+		return gzip.NewWriter(w), nil
+	case compressionZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, invalidArgument("unsupported compression %q, expected gzip or zstd", algorithm)
+}
+
+// newDecompressor returns a reader decompressing reader with algorithm. Both
+// formats end with a checksum of the content, so a corrupted object fails
+// instead of decompressing to garbage.
+func newDecompressor(algorithm string, reader io.Reader) (io.Reader, error) {
+	switch algorithm {
+	case compressionGzip:
+		return gzip.NewReader(reader)
+	case compressionZstd:
+		// A single decoder goroutine decodes synchronously, so the decoder
+		// holds no resources needing a Close
+		return zstd.NewReader(reader, zstd.WithDecoderConcurrency(1))
+	}
+	return nil, fmt.Errorf("object is compressed with unsupported %q", algorithm)
+}
+
+// compressBytes returns data compressed with algorithm.
+func compressBytes(algorithm string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	compressor, err := newCompressor(algorithm, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := compressor.Write(data); err != nil {
+		return nil, err
+	}
+	if err := compressor.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressingReader returns a reader over the content of reader compressed
+// with algorithm on the fly, so large files are never held in memory. Closing
+// it stops the compression.
+func compressingReader(algorithm string, reader io.Reader) io.ReadCloser {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		compressor, err := newCompressor(algorithm, pipeWriter)
+		if err == nil {
+			_, err = io.Copy(compressor, reader)
+			if closeErr := compressor.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		pipeWriter.CloseWithError(err)
+	}()
+	return pipeReader
+}
+
+// encryptionOptions select server-side encryption in the options JSON of
+// upload and copyObject. Without them the bucket's default encryption applies.
+type encryptionOptions struct {
+	ServerSideEncryption string `json:"serverSideEncryption"`
+	SSEKMSKeyID          string `json:"sseKmsKeyId"`
+}
+
+func (o encryptionOptions) check() error {
+	return checkEncryption(types.ServerSideEncryption(o.ServerSideEncryption), o.SSEKMSKeyID)
+}
+
+// values returns the encryption settings in the form every request type takes.
+func (o encryptionOptions) values() (types.ServerSideEncryption, *string) {
+	var kmsKeyID *string
+	if o.SSEKMSKeyID != "" {
+		kmsKeyID = aws.String(o.SSEKMSKeyID)
+	}
+	return types.ServerSideEncryption(o.ServerSideEncryption), kmsKeyID
+}
+
+// timeoutOptions override the bucket's operation timeout for a single call in
+// the options JSON of upload, copyObject, download and statObject.
+type timeoutOptions struct {
+	// TimeoutSeconds bounds each S3 call of the operation; zero keeps the
+	// bucket's timeout.
+	TimeoutSeconds int `json:"timeoutSeconds"`
+}
+
+func (o timeoutOptions) checkTimeout() error {
+	if o.TimeoutSeconds < 0 {
+		return invalidArgument("timeoutSeconds must not be negative")
+	}
+	return nil
+}
+
+// bandwidthOptions cap the throughput of a single transfer in the options
+// JSON of upload and download, see S3Bucket.withBandwidthLimit.
+type bandwidthOptions struct {
+	MaxBytesPerSecond int64 `json:"maxBytesPerSecond"`
+}
+
+func (o bandwidthOptions) checkBandwidth() error {
+	if o.MaxBytesPerSecond < 0 {
+		return invalidArgument("maxBytesPerSecond must not be negative")
+	}
+	return nil
+}
+
+// customerKeyOptions carry an SSE-C key in the options JSON of upload,
+// download and statObject: S3 encrypts the object with a key the caller
+// manages and never stores it, so the same key is needed to read the object.
+type customerKeyOptions struct {
+	// SSECustomerAlgorithm defaults to AES256, the only algorithm S3 supports.
+	SSECustomerAlgorithm string `json:"sseCustomerAlgorithm"`
+	// SSECustomerKey is the base64-encoded 256-bit key.
+	SSECustomerKey string `json:"sseCustomerKey"`
+	// SSECustomerKeyMD5 is the base64-encoded MD5 digest of the key, computed
+	// when empty.
+	SSECustomerKeyMD5 string `json:"sseCustomerKeyMd5"`
+}
+
+// checkCustomerKey validates the key and fills in the algorithm and digest.
+func (o *customerKeyOptions) checkCustomerKey() error {
+	if o.SSECustomerKey == "" {
+		if o.SSECustomerAlgorithm != "" || o.SSECustomerKeyMD5 != "" {
+			return invalidArgument("sseCustomerAlgorithm and sseCustomerKeyMd5 require sseCustomerKey")
+		}
+		return nil
+	}
+
+	if o.SSECustomerAlgorithm == "" {
+		o.SSECustomerAlgorithm = string(types.ServerSideEncryptionAes256)
+	}
+	if o.SSECustomerAlgorithm != string(types.ServerSideEncryptionAes256) {
+		return invalidArgument("unsupported SSE-C algorithm %q, expected AES256", o.SSECustomerAlgorithm)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(o.SSECustomerKey)
+	if err != nil {
+		return invalidArgument("sseCustomerKey is not valid base64: %v", err)
+	}
+	if len(key) != 32 {
+		return invalidArgument("sseCustomerKey must be a 256-bit key, got %d bits", len(key)*8)
+	}
+
+	digest := md5.Sum(key)
+	keyMD5 := base64.StdEncoding.EncodeToString(digest[:])
+	if o.SSECustomerKeyMD5 != "" && o.SSECustomerKeyMD5 != keyMD5 {
+		return invalidArgument("sseCustomerKeyMd5 doesn't match sseCustomerKey")
+	}
+	o.SSECustomerKeyMD5 = keyMD5
+	return nil
+}
+
+// customerKeyValues returns the SSE-C headers, all nil without a key.
+func (o customerKeyOptions) customerKeyValues() (algorithm *string, key *string, keyMD5 *string) {
+	if o.SSECustomerKey == "" {
+		return nil, nil, nil
+	}
+	return aws.String(o.SSECustomerAlgorithm), aws.String(o.SSECustomerKey), aws.String(o.SSECustomerKeyMD5)
+}
+
+// uploadOptions are the optional object settings of upload, decoded from its
+// optionsJson argument. Empty fields are not sent.
+type uploadOptions struct {
+	ContentType        string            `json:"contentType"`
+	CacheControl       string            `json:"cacheControl"`
+	ContentDisposition string            `json:"contentDisposition"`
+	ContentEncoding    string            `json:"contentEncoding"`
+	Metadata           map[string]string `json:"metadata"`
+	StorageClass       string            `json:"storageClass"`
+	// ACL is a canned ACL such as public-read, for providers still relying on
+	// ACLs for public file hosting.
+	ACL string `json:"acl"`
+	// Compression compresses the file with gzip or zstd before upload, see
+	// compressionMetadata.
+	Compression string `json:"compression"`
+	encryptionOptions
+	customerKeyOptions
+	timeoutOptions
+	bandwidthOptions
+	headerOptions
+}
+
+// userMetadataPrefix is the header prefix S3 stores user metadata under. The
+// SDK adds it, so keys given with it are stripped to avoid doubling it.
+const userMetadataPrefix = "x-amz-meta-"
+
+// decodeOptions decodes an options JSON object into options, where an empty
+// string means no options. Unknown fields are rejected so a misspelt option
+// isn't silently ignored.
+func decodeOptions(optionsJson string, options any) error {
+	if optionsJson == "" {
+		return nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(optionsJson))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(options); err != nil {
+		return invalidArgument("invalid options: %v", err)
+	}
+	return nil
+}
+
+// checkStorageClass rejects storage classes the SDK doesn't know, so a typo
+// fails locally instead of as an opaque S3 error. Empty means the default.
+func checkStorageClass(storageClass string) error {
+	if storageClass == "" {
+		return nil
+	}
+	if class := types.StorageClass(storageClass); !slices.Contains(class.Values(), class) {
+		return invalidArgument("unsupported storage class %q", storageClass)
+	}
+	return nil
+}
+
+// parseUploadOptions decodes the optionsJson argument of upload.
+func parseUploadOptions(optionsJson string) (uploadOptions, error) {
+	var options uploadOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	err := options.normalize()
+	return options, err
+}
+
+// normalize validates decoded upload options and strips the user metadata
+// prefix from their metadata keys.
+func (o *uploadOptions) normalize() error {
+	if err := checkStorageClass(o.StorageClass); err != nil {
+		return err
+	}
+	if err := checkObjectACL(o.ACL); err != nil {
+		return err
+	}
+	if err := o.check(); err != nil {
+		return err
+	}
+	if err := o.checkCustomerKey(); err != nil {
+		return err
+	}
+	if o.SSECustomerKey != "" && o.ServerSideEncryption != "" {
+		return invalidArgument("sseCustomerKey can't be combined with serverSideEncryption")
+	}
+	if err := o.checkTimeout(); err != nil {
+		return err
+	}
+	if err := o.checkBandwidth(); err != nil {
+		return err
+	}
+	if err := o.checkHeaders(); err != nil {
+		return err
+	}
+	switch o.Compression {
+	case "", compressionGzip, compressionZstd:
+	default:
+		return invalidArgument("unsupported compression %q, expected gzip or zstd", o.Compression)
+	}
+	if o.Compression != "" && o.ContentEncoding != "" {
+		return invalidArgument("compression sets contentEncoding and can't be combined with it")
+	}
+
+	if len(o.Metadata) > 0 {
+		metadata := make(map[string]string, len(o.Metadata))
+		for key, value := range o.Metadata {
+			if len(key) >= len(userMetadataPrefix) && strings.EqualFold(key[:len(userMetadataPrefix)], userMetadataPrefix) {
+				key = key[len(userMetadataPrefix):]
+			}
+			metadata[key] = value
+		}
+		o.Metadata = metadata
+	}
+	return nil
+}
+
+// applyToPut sets the options on a PutObject request.
+func (o uploadOptions) applyToPut(input *s3.PutObjectInput) {
+	if o.ContentType != "" {
+		input.ContentType = aws.String(o.ContentType)
+	}
+	if o.CacheControl != "" {
+		input.CacheControl = aws.String(o.CacheControl)
+	}
+	if o.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(o.ContentDisposition)
+	}
+	if o.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(o.ContentEncoding)
+	}
+	if len(o.Metadata) > 0 {
+		input.Metadata = o.Metadata
+	}
+	if o.StorageClass != "" {
+		input.StorageClass = types.StorageClass(o.StorageClass)
+	}
+	if o.ACL != "" {
+		input.ACL = types.ObjectCannedACL(o.ACL)
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId = o.values()
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = o.customerKeyValues()
+}
+
+// upload uploads a file. optionsJson is an optional JSON object setting the
+// contentType, cacheControl, contentDisposition, contentEncoding, user
+// metadata, storageClass, canned acl and server-side encryption (SSE-S3,
+// SSE-KMS or SSE-C) of the object, and the timeoutSeconds of the upload; the
+// content type falls back to the file extension.
+//
+//export upload
+func upload(handle C.longlong, filePath *C.char, objectKey *C.char, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error uploading object", errInvalidHandle)
+	}
+	return bucket.runUpload(C.GoString(filePath), C.GoString(objectKey), C.GoString(optionsJson))
+}
+
+// runUpload implements upload and uploadAsync.
+func (b *S3Bucket) runUpload(filePath string, objectKey string, optionsJson string) *C.char {
+	options, err := parseUploadOptions(optionsJson)
+	if err != nil {
+		return errorResult("Error uploading object", err)
+	}
+	if options.ContentType == "" {
+		options.ContentType = mime.TypeByExtension(filepath.Ext(filePath))
+	}
+
+	if _, err := b.withTimeout(options.TimeoutSeconds).withBandwidthLimit(options.MaxBytesPerSecond).withCompression(options.Compression).withHeaders(options.Headers).putFile(filePath, objectKey, options.applyToPut); err != nil {
+		return errorResult("Error uploading object", explainACLError(err))
+	}
+	return okResult(objectKey)
+}
+
+// uploadWithMetadata uploads a file with an explicit content type and user
+// metadata. metadataJson is a JSON object of string values, whose keys are
+// stripped of the x-amz-meta- prefix like the metadata option of upload;
+// contentType falls back to the file extension when empty.
+//
+//export uploadWithMetadata
+func uploadWithMetadata(handle C.longlong, filePath *C.char, objectKey *C.char, contentType *C.char, metadataJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error uploading object", errInvalidHandle)
+	}
+
+	filePathStr := C.GoString(filePath)
+
+	options := uploadOptions{ContentType: C.GoString(contentType)}
+	if metadataStr := C.GoString(metadataJson); metadataStr != "" {
+		if err := json.Unmarshal([]byte(metadataStr), &options.Metadata); err != nil {
+			return errorResult("Error uploading object", invalidArgument("invalid metadata JSON: %v", err))
+		}
+	}
+	if err := options.normalize(); err != nil {
+		return errorResult("Error uploading object", err)
+	}
+	if options.ContentType == "" {
+		options.ContentType = mime.TypeByExtension(filepath.Ext(filePathStr))
+	}
+
+	if _, err := bucket.putFile(filePathStr, C.GoString(objectKey), options.applyToPut); err != nil {
+		return errorResult("Error uploading object", err)
+	}
+	return okResult(C.GoString(objectKey))
+}
+
+// checkEncryption validates a server-side encryption setting: sse is empty for
+// the bucket default, AES256 (SSE-S3) or aws:kms (SSE-KMS), and a KMS key id
+// is only valid with aws:kms.
+func checkEncryption(sse types.ServerSideEncryption, kmsKeyID string) error {
+	switch sse {
+	case "", types.ServerSideEncryptionAes256, types.ServerSideEncryptionAwsKms:
+	default:
+		return invalidArgument("unsupported encryption type %q, expected AES256 or aws:kms", sse)
+	}
+	if kmsKeyID != "" && sse != types.ServerSideEncryptionAwsKms {
+		return invalidArgument("a KMS key id can only be used with aws:kms encryption")
+	}
+	return nil
+}
+
+// encryptedUpload is the result of uploadWithEncryption, as reported by S3.
+type encryptedUpload struct {
+	Key                  string `json:"key"`
+	ServerSideEncryption string `json:"serverSideEncryption"`
+	KMSKeyID             string `json:"kmsKeyId,omitempty"`
+}
+
+// uploadWithEncryption uploads a file with server-side encryption. sseType is
+// AES256 (SSE-S3) or aws:kms (SSE-KMS); kmsKeyId is only valid with aws:kms
+// and may be empty to use the account's default KMS key. Fails with code
+// EncryptionNotApplied if S3 doesn't confirm the requested encryption.
+//
+//export uploadWithEncryption
+func uploadWithEncryption(handle C.longlong, filePath *C.char, objectKey *C.char, sseType *C.char, kmsKeyId *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error uploading object", errInvalidHandle)
+	}
+
+	objectKeyStr := C.GoString(objectKey)
+	sse := types.ServerSideEncryption(C.GoString(sseType))
+	kmsKeyIDStr := C.GoString(kmsKeyId)
+
+	if sse == "" {
+		return errorResult("Error uploading object", invalidArgument("an encryption type is required, expected AES256 or aws:kms"))
+	}
+	if err := checkEncryption(sse, kmsKeyIDStr); err != nil {
+		return errorResult("Error uploading object", err)
+	}
+
+	output, err := bucket.putFile(C.GoString(filePath), objectKeyStr, func(input *s3.PutObjectInput) {
+		input.ServerSideEncryption = sse
+		if kmsKeyIDStr != "" {
+			input.SSEKMSKeyId = aws.String(kmsKeyIDStr)
+		}
+	})
+	if err != nil {
+		return errorResult("Error uploading object", err)
+	}
+
+	if output.ServerSideEncryption != sse {
+		message := fmt.Sprintf("object %v was uploaded but the backend reported encryption %q instead of %q", objectKeyStr, output.ServerSideEncryption, sse)
+		logger.Error("Error uploading object", "code", "EncryptionNotApplied", "error", message)
+		return marshalResult(result{OK: false, Code: "EncryptionNotApplied", Message: message})
+	}
+	return okResult(encryptedUpload{
+		Key:                  objectKeyStr,
+		ServerSideEncryption: string(output.ServerSideEncryption),
+		KMSKeyID:             aws.ToString(output.SSEKMSKeyId),
+	})
+}
+
+// isACLNotSupported reports whether err is a backend refusing canned ACLs,
+// either because the bucket enforces owner-only ACLs or because the service
+// (like R2) doesn't implement them at all.
+func isACLNotSupported(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "AccessControlListNotSupported", "NotImplemented":
+			return true
+		}
+	}
+	return false
+}
+
+// explainACLError adds a hint to errors of backends refusing canned ACLs,
+// returning other errors unchanged.
+func explainACLError(err error) error {
+	if isACLNotSupported(err) {
+		return fmt.Errorf("the storage backend doesn't support ACLs, use a bucket policy or public bucket instead: %w", err)
+	}
+	return err
+}
+
+// checkObjectACL rejects canned ACLs the SDK doesn't know. Empty means none.
+func checkObjectACL(acl string) error {
+	if cannedACL := types.ObjectCannedACL(acl); acl != "" && !slices.Contains(cannedACL.Values(), cannedACL) {
+		return invalidArgument("unsupported canned ACL %q", acl)
+	}
+	return nil
+}
+
+// uploadWithAcl uploads a file with a canned ACL such as public-read or private.
+//
+//export uploadWithAcl
+func uploadWithAcl(handle C.longlong, filePath *C.char, objectKey *C.char, acl *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error uploading object", errInvalidHandle)
+	}
+
+	cannedACL := C.GoString(acl)
+	if cannedACL == "" {
+		return errorResult("Error uploading object", invalidArgument("canned ACL must not be empty"))
+	}
+	if err := checkObjectACL(cannedACL); err != nil {
+		return errorResult("Error uploading object", err)
+	}
+
+	_, err := bucket.putFile(C.GoString(filePath), C.GoString(objectKey), func(input *s3.PutObjectInput) {
+		input.ACL = types.ObjectCannedACL(cannedACL)
+	})
+	if err != nil {
+		return errorResult("Error uploading object", explainACLError(err))
+	}
+	return okResult(C.GoString(objectKey))
+}
+
+// setObjectAcl replaces the ACL of an existing object with a canned ACL such
+// as public-read or private.
+//
+//export setObjectAcl
+func setObjectAcl(handle C.longlong, objectKey *C.char, acl *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error setting object ACL", errInvalidHandle)
+	}
+
+	cannedACL := C.GoString(acl)
+	if cannedACL == "" {
+		return errorResult("Error setting object ACL", invalidArgument("canned ACL must not be empty"))
+	}
+	if err := checkObjectACL(cannedACL); err != nil {
+		return errorResult("Error setting object ACL", err)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	_, err := bucket.client.PutObjectAcl(ctx, &s3.PutObjectAclInput{
+		Bucket: aws.String(bucket.BucketName),
+		Key:    aws.String(C.GoString(objectKey)),
+		ACL:    types.ObjectCannedACL(cannedACL),
+	})
+	if err != nil {
+		return errorResult("Error setting object ACL", explainACLError(err))
+	}
+	return okResult(nil)
+}
+
+// allUsersGroup is the grantee URI of anonymous access in ACLs.
+const allUsersGroup = "http://acs.amazonaws.com/groups/global/AllUsers"
+
+// aclGrant is one grant of an objectACL.
+type aclGrant struct {
+	// Grantee is the canonical user ID, email address or group URI, depending
+	// on GranteeType.
+	Grantee     string `json:"grantee"`
+	GranteeType string `json:"granteeType"`
+	// Permission is READ, WRITE, READ_ACP, WRITE_ACP or FULL_CONTROL.
+	Permission string `json:"permission"`
+}
+
+// objectACL is the JSON shape returned by getObjectAcl.
+type objectACL struct {
+	Owner  string     `json:"owner"`
+	Grants []aclGrant `json:"grants"`
+	// Public reports whether anonymous users can read the object.
+	Public bool `json:"public"`
+}
+
+// getObjectAcl returns the owner and grants of an object's ACL, and whether
+// it is publicly readable.
+//
+//export getObjectAcl
+func getObjectAcl(handle C.longlong, objectKey *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error getting object ACL", errInvalidHandle)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	output, err := bucket.client.GetObjectAcl(ctx, &s3.GetObjectAclInput{
+		Bucket: aws.String(bucket.BucketName),
+		Key:    aws.String(C.GoString(objectKey)),
+	})
+	if err != nil {
+		return errorResult("Error getting object ACL", explainACLError(err))
+	}
+
+	acl := objectACL{Grants: make([]aclGrant, 0, len(output.Grants))}
+	if output.Owner != nil {
+		acl.Owner = aws.ToString(output.Owner.ID)
+	}
+	for _, grant := range output.Grants {
+		if grant.Grantee == nil {
+			continue
+		}
+		entry := aclGrant{
+			GranteeType: string(grant.Grantee.Type),
+			Permission:  string(grant.Permission),
+		}
+		switch grant.Grantee.Type {
+		case types.TypeGroup:
+			entry.Grantee = aws.ToString(grant.Grantee.URI)
+		case types.TypeAmazonCustomerByEmail:
+			entry.Grantee = aws.ToString(grant.Grantee.EmailAddress)
+		default:
+			entry.Grantee = aws.ToString(grant.Grantee.ID)
+		}
+		if entry.Grantee == allUsersGroup && (grant.Permission == types.PermissionRead || grant.Permission == types.PermissionFullControl) {
+			acl.Public = true
+		}
+		acl.Grants = append(acl.Grants, entry)
+	}
+	return okResult(acl)
+}
+
+// checksummedUpload is the result of uploadWithChecksum.
+type checksummedUpload struct {
+	Key       string `json:"key"`
+	Algorithm string `json:"algorithm"`
+	// Checksum is the base64 checksum S3 stored, empty when the backend doesn't support checksums.
+	Checksum string `json:"checksum,omitempty"`
+	// ChecksumType is FULL_OBJECT when Checksum covers the whole file, or
+	// COMPOSITE for a multipart upload whose Checksum, suffixed with the
+	// number of parts, is computed over the checksums of the parts.
+	ChecksumType      string `json:"checksumType,omitempty"`
+	ChecksumSupported bool   `json:"checksumSupported"`
+}
+
+// storedChecksum returns the checksum for algorithm reported for an upload; it is
+// a checksum of the part checksums for multipart uploads.
+func storedChecksum(output *manager.UploadOutput, algorithm types.ChecksumAlgorithm) string {
+	switch algorithm {
+	case types.ChecksumAlgorithmCrc32:
+		return aws.ToString(output.ChecksumCRC32)
+	case types.ChecksumAlgorithmCrc32c:
+		return aws.ToString(output.ChecksumCRC32C)
+	case types.ChecksumAlgorithmSha1:
+		return aws.ToString(output.ChecksumSHA1)
+	case types.ChecksumAlgorithmSha256:
+		return aws.ToString(output.ChecksumSHA256)
+	case types.ChecksumAlgorithmCrc64nvme:
+		return aws.ToString(output.ChecksumCRC64NVME)
+	}
+	return ""
+}
+
+// isChecksumNotSupported reports whether err is a backend rejecting the
+// additional checksum headers rather than the upload itself. S3 reports many
+// unrelated failures, such as a bad SSE parameter, as InvalidRequest, so those
+// only count when their message is about the checksum.
+func isChecksumNotSupported(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotImplemented":
+			return true
+		case "InvalidRequest":
+			return strings.Contains(strings.ToLower(apiErr.ErrorMessage()), "checksum")
+		}
+	}
+	return false
+}
+
+// uploadWithChecksum uploads a file along with a checksum computed locally
+// using algorithm (CRC32, CRC32C, SHA1, SHA256 or CRC64NVME), so S3 rejects
+// a body corrupted in transit. Multipart uploads send one with every part.
+// Backends that don't support checksums get a plain upload and
+// checksumSupported is false in the result.
+//
+//export uploadWithChecksum
+func uploadWithChecksum(handle C.longlong, filePath *C.char, objectKey *C.char, algorithm *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error uploading object", errInvalidHandle)
+	}
+	filePathStr := C.GoString(filePath)
+	objectKeyStr := C.GoString(objectKey)
+
+	checksumAlgorithm := types.ChecksumAlgorithm(strings.ToUpper(C.GoString(algorithm)))
+	if !slices.Contains(checksumAlgorithm.Values(), checksumAlgorithm) {
+		return errorResult("Error uploading object", invalidArgument("unsupported checksum algorithm %q", checksumAlgorithm))
+	}
+
+	uploaded := checksummedUpload{Key: objectKeyStr, Algorithm: string(checksumAlgorithm)}
+	output, err := bucket.putFile(filePathStr, objectKeyStr, func(input *s3.PutObjectInput) {
+		input.ChecksumAlgorithm = checksumAlgorithm
+	})
+	if err != nil && isChecksumNotSupported(err) {
+		logger.Warn("Backend rejected checksum, retrying without it", "algorithm", checksumAlgorithm, "key", objectKeyStr, "error", describeError(err))
+		output, err = bucket.putFile(filePathStr, objectKeyStr, nil)
+	}
+	if err != nil {
+		return errorResult("Error uploading object", err)
+	}
+
+	uploaded.Checksum = storedChecksum(output, checksumAlgorithm)
+	uploaded.ChecksumSupported = uploaded.Checksum != ""
+	if uploaded.ChecksumSupported {
+		uploaded.ChecksumType = string(output.ChecksumType)
+		if uploaded.ChecksumType == "" {
+			// Backends predating checksum types only store composite checksums for multipart uploads
+			uploaded.ChecksumType = string(types.ChecksumTypeFullObject)
+			if output.UploadID != "" {
+				uploaded.ChecksumType = string(types.ChecksumTypeComposite)
+			}
+		}
+	}
+	return okResult(uploaded)
+}
+
+// uploadBytes uploads length bytes starting at data, which may contain NULs,
+// for content generated in memory with no file on disk. length is a long long
+// like that of bytes_result, so buffers aren't capped at 2 GiB.
+//
+//export uploadBytes
+func uploadBytes(handle C.longlong, data *C.char, length C.longlong, objectKey *C.char, contentType *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error uploading object", errInvalidHandle)
+	}
+
+	if length < 0 || int64(length) > math.MaxInt || (data == nil && length > 0) {
+		return errorResult("Error uploading object", invalidArgument("invalid buffer of length %d", length))
+	}
+
+	// Copied so the caller may free the buffer as soon as we return. Not with
+	// C.GoBytes, whose length is a C int
+	body := bytes.Clone(unsafe.Slice((*byte)(unsafe.Pointer(data)), int(length)))
+	contentTypeStr := C.GoString(contentType)
+
+	_, err := bucket.putBytes(body, C.GoString(objectKey), func(input *s3.PutObjectInput) {
+		if contentTypeStr != "" {
+			input.ContentType = aws.String(contentTypeStr)
+		}
+	})
+	if err != nil {
+		return errorResult("Error uploading object", err)
+	}
+	return okResult(C.GoString(objectKey))
+}
+
+// fileError describes one local file that failed to transfer.
+type fileError struct {
+	Path    string `json:"path"`
+	Key     string `json:"key"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// uploadDirectoryResult is the JSON shape returned by uploadDirectory.
+type uploadDirectoryResult struct {
+	Uploaded int `json:"uploaded"`
+	// Files has the outcome of every file found, in no particular order.
+	Files  []fileResult `json:"files"`
+	Errors []fileError  `json:"errors"`
+}
+
+// fileResult is the outcome of the transfer of one local file.
+type fileResult struct {
+	Path    string `json:"path"`
+	Key     string `json:"key"`
+	OK      bool   `json:"ok"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// defaultDirectoryConcurrency is the number of files uploadDirectory
+// transfers at once when its options don't say.
+const defaultDirectoryConcurrency = 4
+
+// uploadDirectoryOptions are the optional settings of uploadDirectory,
+// decoded from its optionsJson argument: the upload options applied to every
+// file and the size of the worker pool.
+type uploadDirectoryOptions struct {
+	uploadOptions
+	Concurrency int `json:"concurrency"`
+}
+
+// parseUploadDirectoryOptions decodes the optionsJson argument of uploadDirectory.
+func parseUploadDirectoryOptions(optionsJson string) (uploadDirectoryOptions, error) {
+	var options uploadDirectoryOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	if err := options.normalize(); err != nil {
+		return options, err
+	}
+	if options.Concurrency < 0 {
+		return options, invalidArgument("concurrency must not be negative")
+	}
+	if options.Concurrency == 0 {
+		options.Concurrency = defaultDirectoryConcurrency
+	}
+	return options, nil
+}
+
+// uploadDirectory uploads every file under localDir, keyed by keyPrefix plus
+// the file's path relative to localDir with forward slashes. Files are
+// uploaded by a pool of workers sharing the same client. optionsJson is an
+// optional JSON object with the options of upload, applied to every file,
+// and the concurrency of the pool.
+//
+//export uploadDirectory
+func uploadDirectory(handle C.longlong, localDir *C.char, keyPrefix *C.char, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error uploading directory", errInvalidHandle)
+	}
+	return bucket.runUploadDirectory(C.GoString(localDir), C.GoString(keyPrefix), C.GoString(optionsJson))
+}
+
+// runUploadDirectory implements uploadDirectory and uploadDirectoryAsync.
+func (b *S3Bucket) runUploadDirectory(localDir string, keyPrefix string, optionsJson string) *C.char {
+	options, err := parseUploadDirectoryOptions(optionsJson)
+	if err != nil {
+		return errorResult("Error uploading directory", err)
+	}
+	// The bandwidth cap is shared by all the files
+	bucket := b.withTimeout(options.TimeoutSeconds).withBandwidthLimit(options.MaxBytesPerSecond).withCompression(options.Compression).withHeaders(options.Headers)
+
+	type uploadJob struct {
+		path string
+		key  string
+	}
+	jobs := make(chan uploadJob)
+
+	var (
+		mu      sync.Mutex
+		summary = uploadDirectoryResult{Files: []fileResult{}, Errors: []fileError{}}
+		wg      sync.WaitGroup
+	)
+	for range options.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				fileOptions := options.uploadOptions
+				if fileOptions.ContentType == "" {
+					fileOptions.ContentType = mime.TypeByExtension(filepath.Ext(job.path))
+				}
+				_, err := bucket.putFile(job.path, job.key, fileOptions.applyToPut)
+
+				mu.Lock()
+				file := fileResult{Path: job.path, Key: job.key, OK: err == nil}
+				if err != nil {
+					logger.Error("Error uploading file", "path", job.path, "key", job.key, "error", describeError(err))
+					file.Code, file.Message = errorCode(err), describeError(err)
+					summary.Errors = append(summary.Errors, fileError{
+						Path:    job.path,
+						Key:     job.key,
+						Code:    file.Code,
+						Message: file.Message,
+					})
+				} else {
+					summary.Uploaded++
+				}
+				summary.Files = append(summary.Files, file)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	walkErr := filepath.WalkDir(localDir, func(path string, entry fs.DirEntry, err error) error {
+		if canceledErr := b.canceled(); canceledErr != nil {
+			return canceledErr
+		}
+		if err != nil {
+			if path == localDir {
+				// The directory itself can't be read, nothing to upload
+				return err
+			}
+			mu.Lock()
+			summary.Errors = append(summary.Errors, fileError{Path: path, Message: err.Error()})
+			summary.Files = append(summary.Files, fileResult{Path: path, Message: err.Error()})
+			mu.Unlock()
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(localDir, path)
+		if err != nil {
+			return err
+		}
+		jobs <- uploadJob{path: path, key: keyPrefix + filepath.ToSlash(relativePath)}
+		return nil
+	})
+	close(jobs)
+	wg.Wait()
+
+	if walkErr != nil {
+		return errorResult("Error uploading directory", walkErr)
+	}
+	return okResult(summary)
+}
+
+// isNotFound reports whether err is S3 telling us the object (or bucket) does not exist,
+// as opposed to a network, permission or throttling failure.
+func isNotFound(err error) bool {
+	var notFound *types.NotFound
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &notFound) || errors.As(err, &noSuchKey) {
+		return true
+	}
+
+	// HeadObject has no response body, so some backends only give us the status code
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotFound", "NoSuchKey", "NoSuchBucket":
+			return true
+		}
+	}
+	return false
+}
+
+// checkKeyBucketExist returns 1 when the object exists, 0 when S3 reports it
+// missing, and -1 for any other failure so the caller can decide to retry.
+//
+//export checkKeyBucketExist
+func checkKeyBucketExist(handle C.longlong, objectKey *C.char) C.int {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		logger.Error("Invalid handle", "handle", handle, "error", errInvalidHandle)
+		return C.int(-1)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	_, err := bucket.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket.BucketName),
+		Key:    aws.String(C.GoString(objectKey)),
+	})
+	if err == nil {
+		// No error means the HeadObject call succeeded, and the object exists.
+		return C.int(1)
+	}
+	if isNotFound(err) {
+		return C.int(0)
+	}
+	logger.Error("Couldn't check object", "bucket", bucket.BucketName, "key", C.GoString(objectKey), "error", describeError(err))
+	return C.int(-1)
+}
+
+// createBucketOptions are the optional settings of createBucket, decoded
+// from its optionsJson argument. Empty fields keep the defaults.
+type createBucketOptions struct {
+	// Region overrides the region of the client for the new bucket.
+	Region string `json:"region"`
+	ACL    string `json:"acl"`
+	timeoutOptions
+}
+
+// parseCreateBucketOptions decodes the optionsJson argument of createBucket.
+func parseCreateBucketOptions(optionsJson string) (createBucketOptions, error) {
+	var options createBucketOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	if cannedACL := types.BucketCannedACL(options.ACL); options.ACL != "" && !slices.Contains(cannedACL.Values(), cannedACL) {
+		return options, invalidArgument("unsupported canned ACL %q", options.ACL)
+	}
+	err := options.checkTimeout()
+	return options, err
+}
+
+// createBucket creates the configured bucket, succeeding if we already own it.
+// The location constraint is only sent for regions that need one: it is
+// omitted when the region is empty, us-east-1 or R2's "auto". optionsJson is
+// an optional JSON object with the region of the bucket when it isn't the
+// client's, a canned acl such as private or public-read and timeoutSeconds
+// overriding the bucket's operation timeout.
+//
+//export createBucket
+func createBucket(handle C.longlong, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error creating bucket", errInvalidHandle)
+	}
+
+	options, err := parseCreateBucketOptions(C.GoString(optionsJson))
+	if err != nil {
+		return errorResult("Error creating bucket", err)
+	}
+	bucket = bucket.withTimeout(options.TimeoutSeconds)
+
+	input := &s3.CreateBucketInput{
+		Bucket: aws.String(bucket.BucketName),
+		ACL:    types.BucketCannedACL(options.ACL),
+	}
+	region := bucket.client.Options().Region
+	if options.Region != "" {
+		region = options.Region
+	}
+	switch region {
+	case "", "us-east-1", "auto":
+	default:
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(region),
+		}
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	// S3 rejects a location constraint other than the region the request is sent to
+	_, err = bucket.client.CreateBucket(ctx, input, func(o *s3.Options) {
+		if region != "" {
+			o.Region = region
+		}
+	})
+	var alreadyOwned *types.BucketAlreadyOwnedByYou
+	if err != nil && !errors.As(err, &alreadyOwned) {
+		return errorResult("Error creating bucket", err)
+	}
+	return okResult(nil)
+}
+
+// emptyBucket deletes every object of the bucket, with all their versions
+// and delete markers, and aborts its pending multipart uploads, so the bucket
+// can be deleted. On services without versioning support, like R2, the
+// objects are listed and deleted by key.
+func (b *S3Bucket) emptyBucket() error {
+	uploads, err := b.pendingMultipartUploads()
+	if err != nil {
+		return err
+	}
+	for _, upload := range uploads {
+		if err := b.abortMultipartUpload(aws.ToString(upload.Key), aws.ToString(upload.UploadId)); err != nil {
+			return err
+		}
+	}
+
+	identifiers, err := b.versionIdentifiers()
+	if errorCode(err) == "NotImplemented" {
+		var objectKeys []string
+		objectKeys, err = b.listKeys("")
+		identifiers = make([]types.ObjectIdentifier, len(objectKeys))
+		for i, key := range objectKeys {
+			identifiers[i] = types.ObjectIdentifier{Key: aws.String(key)}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	result := b.deleteObjects(identifiers)
+	if len(result.Errors) > 0 {
+		first := result.Errors[0]
+		return fmt.Errorf("couldn't delete %d objects of bucket %v, %v: %v", len(result.Errors), b.BucketName, first.Key, first.Message)
+	}
+	return nil
+}
+
+// versionIdentifiers lists every version and delete marker in the bucket.
+func (b *S3Bucket) versionIdentifiers() ([]types.ObjectIdentifier, error) {
+	var identifiers []types.ObjectIdentifier
+	paginator := s3.NewListObjectVersionsPaginator(b.client, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(b.BucketName),
+	})
+	for paginator.HasMorePages() {
+		ctx, cancel := b.operationContext()
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range page.Versions {
+			identifiers = append(identifiers, types.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+		}
+		for _, marker := range page.DeleteMarkers {
+			identifiers = append(identifiers, types.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+	}
+	return identifiers, nil
+}
+
+// deleteBucketOptions are the optional settings of deleteBucket, decoded from
+// its optionsJson argument.
+type deleteBucketOptions struct {
+	// Force empties the bucket first, the objects being otherwise left alone
+	// and the deletion failing with BucketNotEmpty.
+	Force bool `json:"force"`
+	timeoutOptions
+}
+
+// deleteBucket deletes the configured bucket, which must be empty unless
+// optionsJson, an optional JSON object, sets force: then every object,
+// object version and pending multipart upload is deleted first. Its
+// timeoutSeconds overrides the bucket's operation timeout.
+//
+//export deleteBucket
+func deleteBucket(handle C.longlong, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error deleting bucket", errInvalidHandle)
+	}
+
+	var options deleteBucketOptions
+	if err := decodeOptions(C.GoString(optionsJson), &options); err != nil {
+		return errorResult("Error deleting bucket", err)
+	}
+	if err := options.checkTimeout(); err != nil {
+		return errorResult("Error deleting bucket", err)
+	}
+	bucket = bucket.withTimeout(options.TimeoutSeconds)
+
+	if options.Force {
+		if err := bucket.emptyBucket(); err != nil {
+			return errorResult("Error deleting bucket", err)
+		}
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	if _, err := bucket.client.DeleteBucket(ctx, &s3.DeleteBucketInput{
+		Bucket: aws.String(bucket.BucketName),
+	}); err != nil {
+		return errorResult("Error deleting bucket", err)
+	}
+	return okResult(nil)
+}
+
+// setBucketVersioning enables versioning on the configured bucket when
+// enabled is 1, so overwritten and deleted objects keep their previous
+// versions, and suspends it otherwise. Suspending keeps the existing versions.
+//
+//export setBucketVersioning
+func setBucketVersioning(handle C.longlong, enabled C.int) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error setting bucket versioning", errInvalidHandle)
+	}
+
+	status := types.BucketVersioningStatusSuspended
+	if enabled != 0 {
+		status = types.BucketVersioningStatusEnabled
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	_, err := bucket.client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(bucket.BucketName),
+		VersioningConfiguration: &types.VersioningConfiguration{Status: status},
+	})
+	if err != nil {
+		return errorResult("Error setting bucket versioning", err)
+	}
+	return okResult(nil)
+}
+
+// getBucketVersioning returns the versioning status of the configured bucket:
+// "Enabled", "Suspended", or "" when versioning was never enabled.
+//
+//export getBucketVersioning
+func getBucketVersioning(handle C.longlong) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error getting bucket versioning", errInvalidHandle)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	output, err := bucket.client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+		Bucket: aws.String(bucket.BucketName),
+	})
+	if err != nil {
+		return errorResult("Error getting bucket versioning", err)
+	}
+	return okResult(string(output.Status))
+}
+
+// objectVersion is one entry of the JSON array returned by listObjectVersions,
+// a version of an object or a delete marker.
+type objectVersion struct {
+	Key            string `json:"key"`
+	VersionID      string `json:"versionId"`
+	IsLatest       bool   `json:"isLatest"`
+	IsDeleteMarker bool   `json:"isDeleteMarker"`
+	Size           int64  `json:"size"`
+	LastModified   string `json:"lastModified,omitempty"`
+	ETag           string `json:"etag,omitempty"`
+	StorageClass   string `json:"storageClass,omitempty"`
+}
+
+// listObjectVersions lists every version and delete marker of the objects
+// under prefix, following pagination. Versions of a key are listed newest
+// first; objects stored before versioning was enabled have the version ID
+// "null".
+//
+//export listObjectVersions
+func listObjectVersions(handle C.longlong, prefix *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error listing object versions", errInvalidHandle)
+	}
+
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket.BucketName),
+	}
+	if prefixStr := C.GoString(prefix); prefixStr != "" {
+		input.Prefix = aws.String(prefixStr)
+	}
+
+	versions := []objectVersion{}
+	paginator := s3.NewListObjectVersionsPaginator(bucket.client, input)
+	for paginator.HasMorePages() {
+		ctx, cancel := bucket.operationContext()
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return errorResult("Error listing object versions", err)
+		}
+
+		// A page holds versions and delete markers separately, each sorted by
+		// key then newest first; merge them back into that order
+		type listedVersion struct {
+			objectVersion
+			modified time.Time
+		}
+		listed := make([]listedVersion, 0, len(page.Versions)+len(page.DeleteMarkers))
+		for _, version := range page.Versions {
+			listed = append(listed, listedVersion{
+				objectVersion: objectVersion{
+					Key:          aws.ToString(version.Key),
+					VersionID:    aws.ToString(version.VersionId),
+					IsLatest:     aws.ToBool(version.IsLatest),
+					Size:         aws.ToInt64(version.Size),
+					ETag:         aws.ToString(version.ETag),
+					StorageClass: string(version.StorageClass),
+				},
+				modified: aws.ToTime(version.LastModified),
+			})
+		}
+		for _, marker := range page.DeleteMarkers {
+			listed = append(listed, listedVersion{
+				objectVersion: objectVersion{
+					Key:            aws.ToString(marker.Key),
+					VersionID:      aws.ToString(marker.VersionId),
+					IsLatest:       aws.ToBool(marker.IsLatest),
+					IsDeleteMarker: true,
+				},
+				modified: aws.ToTime(marker.LastModified),
+			})
+		}
+		slices.SortStableFunc(listed, func(a listedVersion, b listedVersion) int {
+			switch {
+			case a.Key != b.Key:
+				return strings.Compare(a.Key, b.Key)
+			case a.IsLatest != b.IsLatest:
+				if a.IsLatest {
+					return -1
+				}
+				return 1
+			}
+			return b.modified.Compare(a.modified)
+		})
+		for _, version := range listed {
+			if !version.modified.IsZero() {
+				version.LastModified = version.modified.UTC().Format(time.RFC3339)
+			}
+			versions = append(versions, version.objectVersion)
+		}
+	}
+	return okResult(versions)
+}
+
+// retentionOptions are the settings of setObjectRetention, decoded from its
+// optionsJson argument.
+type retentionOptions struct {
+	// Mode is GOVERNANCE, which users with the s3:BypassGovernanceRetention
+	// permission can lift, or COMPLIANCE, which nobody can until RetainUntil.
+	Mode string `json:"mode"`
+	// RetainUntil is the RFC 3339 date until which the version can't be
+	// overwritten or deleted.
+	RetainUntil string `json:"retainUntil"`
+	// VersionID selects the version to retain, the latest one when empty.
+	VersionID string `json:"versionId"`
+	// BypassGovernance allows shortening or removing a GOVERNANCE retention.
+	BypassGovernance bool `json:"bypassGovernance"`
+	timeoutOptions
+}
+
+// parseRetentionOptions decodes and validates the optionsJson argument of
+// setObjectRetention.
+func parseRetentionOptions(optionsJson string) (retentionOptions, time.Time, error) {
+	var options retentionOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, time.Time{}, err
+	}
+	if mode := types.ObjectLockRetentionMode(options.Mode); !slices.Contains(mode.Values(), mode) {
+		return options, time.Time{}, invalidArgument("retention mode must be GOVERNANCE or COMPLIANCE, got %q", options.Mode)
+	}
+	retainUntil, err := time.Parse(time.RFC3339, options.RetainUntil)
+	if err != nil {
+		return options, time.Time{}, invalidArgument("retainUntil must be an RFC 3339 date: %v", err)
+	}
+	if err := options.checkTimeout(); err != nil {
+		return options, time.Time{}, err
+	}
+	return options, retainUntil, nil
+}
+
+// setObjectRetention places a WORM retention on an object of a bucket with
+// Object Lock enabled: until its retainUntil date, the version can't be
+// overwritten or deleted. optionsJson is a JSON object with the mode and
+// retainUntil, and optionally the versionId to retain, bypassGovernance and a
+// timeoutSeconds overriding the bucket's operation timeout.
+//
+//export setObjectRetention
+func setObjectRetention(handle C.longlong, objectKey *C.char, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error setting object retention", errInvalidHandle)
+	}
+
+	options, retainUntil, err := parseRetentionOptions(C.GoString(optionsJson))
+	if err != nil {
+		return errorResult("Error setting object retention", err)
+	}
+
+	ctx, cancel := bucket.withTimeout(options.TimeoutSeconds).operationContext()
+	defer cancel()
+
+	input := &s3.PutObjectRetentionInput{
+		Bucket: aws.String(bucket.BucketName),
+		Key:    aws.String(C.GoString(objectKey)),
+		Retention: &types.ObjectLockRetention{
+			Mode:            types.ObjectLockRetentionMode(options.Mode),
+			RetainUntilDate: aws.Time(retainUntil),
+		},
+	}
+	if options.VersionID != "" {
+		input.VersionId = aws.String(options.VersionID)
+	}
+	if options.BypassGovernance {
+		input.BypassGovernanceRetention = aws.Bool(true)
+	}
+	if _, err := bucket.client.PutObjectRetention(ctx, input); err != nil {
+		return errorResult("Error setting object retention", err)
+	}
+	return okResult(nil)
+}
+
+// objectRetention is the JSON shape returned by getObjectRetention, empty for
+// an object without retention.
+type objectRetention struct {
+	Mode        string `json:"mode,omitempty"`
+	RetainUntil string `json:"retainUntil,omitempty"`
+}
+
+// getObjectRetention returns the retention mode and date of an object, or of
+// the version versionId when it isn't empty.
+//
+//export getObjectRetention
+func getObjectRetention(handle C.longlong, objectKey *C.char, versionId *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error getting object retention", errInvalidHandle)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	input := &s3.GetObjectRetentionInput{
+		Bucket: aws.String(bucket.BucketName),
+		Key:    aws.String(C.GoString(objectKey)),
+	}
+	if versionIdStr := C.GoString(versionId); versionIdStr != "" {
+		input.VersionId = aws.String(versionIdStr)
+	}
+	output, err := bucket.client.GetObjectRetention(ctx, input)
+	if errorCode(err) == "NoSuchObjectLockConfiguration" {
+		return okResult(objectRetention{})
+	}
+	if err != nil {
+		return errorResult("Error getting object retention", err)
+	}
+
+	var retention objectRetention
+	if output.Retention != nil {
+		retention.Mode = string(output.Retention.Mode)
+		if output.Retention.RetainUntilDate != nil {
+			retention.RetainUntil = output.Retention.RetainUntilDate.UTC().Format(time.RFC3339)
+		}
+	}
+	return okResult(retention)
+}
+
+// setObjectLegalHold places a legal hold on an object of a bucket with Object
+// Lock enabled when enabled is 1, and lifts it otherwise. A held version
+// can't be deleted, regardless of its retention, until the hold is lifted.
+// versionId selects the version, the latest one when empty.
+//
+//export setObjectLegalHold
+func setObjectLegalHold(handle C.longlong, objectKey *C.char, enabled C.int, versionId *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error setting object legal hold", errInvalidHandle)
+	}
+
+	status := types.ObjectLockLegalHoldStatusOff
+	if enabled != 0 {
+		status = types.ObjectLockLegalHoldStatusOn
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	input := &s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String(bucket.BucketName),
+		Key:       aws.String(C.GoString(objectKey)),
+		LegalHold: &types.ObjectLockLegalHold{Status: status},
+	}
+	if versionIdStr := C.GoString(versionId); versionIdStr != "" {
+		input.VersionId = aws.String(versionIdStr)
+	}
+	if _, err := bucket.client.PutObjectLegalHold(ctx, input); err != nil {
+		return errorResult("Error setting object legal hold", err)
+	}
+	return okResult(nil)
+}
+
+// getObjectLegalHold returns whether an object, or the version versionId when
+// it isn't empty, is under a legal hold.
+//
+//export getObjectLegalHold
+func getObjectLegalHold(handle C.longlong, objectKey *C.char, versionId *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error getting object legal hold", errInvalidHandle)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	input := &s3.GetObjectLegalHoldInput{
+		Bucket: aws.String(bucket.BucketName),
+		Key:    aws.String(C.GoString(objectKey)),
+	}
+	if versionIdStr := C.GoString(versionId); versionIdStr != "" {
+		input.VersionId = aws.String(versionIdStr)
+	}
+	output, err := bucket.client.GetObjectLegalHold(ctx, input)
+	if errorCode(err) == "NoSuchObjectLockConfiguration" {
+		return okResult(false)
+	}
+	if err != nil {
+		return errorResult("Error getting object legal hold", err)
+	}
+	return okResult(output.LegalHold != nil && output.LegalHold.Status == types.ObjectLockLegalHoldStatusOn)
+}
+
+// lifecycleRule is one rule of the JSON array taken by setBucketLifecycle and
+// returned by getBucketLifecycle.
+type lifecycleRule struct {
+	ID string `json:"id"`
+	// Prefix restricts the rule to the keys starting with it, every key when
+	// empty.
+	Prefix  string `json:"prefix"`
+	Enabled bool   `json:"enabled"`
+	// ExpirationDays deletes objects this many days after their creation, or
+	// adds a delete marker on versioned buckets.
+	ExpirationDays int32 `json:"expirationDays,omitempty"`
+	// AbortIncompleteUploadsDays aborts multipart uploads still pending this
+	// many days after they were started, freeing their parts.
+	AbortIncompleteUploadsDays int32 `json:"abortIncompleteUploadsDays,omitempty"`
+}
+
+// parseLifecycleRules decodes and validates the rulesJson argument of
+// setBucketLifecycle.
+func parseLifecycleRules(rulesJson string) ([]types.LifecycleRule, error) {
+	var rules []lifecycleRule
+	decoder := json.NewDecoder(strings.NewReader(rulesJson))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, invalidArgument("invalid lifecycle rules: %v", err)
+	}
+
+	converted := make([]types.LifecycleRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.ExpirationDays < 0 || rule.AbortIncompleteUploadsDays < 0 {
+			return nil, invalidArgument("rule %d: days must not be negative", i)
+		}
+		if rule.ExpirationDays == 0 && rule.AbortIncompleteUploadsDays == 0 {
+			return nil, invalidArgument("rule %d: set expirationDays or abortIncompleteUploadsDays", i)
+		}
+
+		status := types.ExpirationStatusDisabled
+		if rule.Enabled {
+			status = types.ExpirationStatusEnabled
+		}
+		entry := types.LifecycleRule{
+			Status: status,
+			Filter: &types.LifecycleRuleFilter{Prefix: aws.String(rule.Prefix)},
+		}
+		if rule.ID != "" {
+			entry.ID = aws.String(rule.ID)
+		}
+		if rule.ExpirationDays > 0 {
+			entry.Expiration = &types.LifecycleExpiration{Days: aws.Int32(rule.ExpirationDays)}
+		}
+		if rule.AbortIncompleteUploadsDays > 0 {
+			entry.AbortIncompleteMultipartUpload = &types.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: aws.Int32(rule.AbortIncompleteUploadsDays),
+			}
+		}
+		converted = append(converted, entry)
+	}
+	return converted, nil
+}
+
+// setBucketLifecycle replaces the lifecycle configuration of the configured
+// bucket with rulesJson, a JSON array of rules each with an optional id and
+// prefix, enabled, and expirationDays and/or abortIncompleteUploadsDays. An
+// empty array removes the configuration. Rules using other actions, such as
+// transitions set from the provider console, are replaced too.
+//
+//export setBucketLifecycle
+func setBucketLifecycle(handle C.longlong, rulesJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error setting bucket lifecycle", errInvalidHandle)
+	}
+
+	rules, err := parseLifecycleRules(C.GoString(rulesJson))
+	if err != nil {
+		return errorResult("Error setting bucket lifecycle", err)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	// S3 rejects a configuration without rules, deleting it is the equivalent
+	if len(rules) == 0 {
+		_, err = bucket.client.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{
+			Bucket: aws.String(bucket.BucketName),
+		})
+	} else {
+		_, err = bucket.client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+			Bucket:                 aws.String(bucket.BucketName),
+			LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: rules},
+		})
+	}
+	if err != nil {
+		return errorResult("Error setting bucket lifecycle", err)
+	}
+	return okResult(nil)
+}
+
+// getBucketLifecycle returns the lifecycle rules of the configured bucket as
+// a JSON array, empty when it has none. Only the prefix filter and the
+// expiration and abort actions are reported.
+//
+//export getBucketLifecycle
+func getBucketLifecycle(handle C.longlong) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error getting bucket lifecycle", errInvalidHandle)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	output, err := bucket.client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket.BucketName),
+	})
+	if errorCode(err) == "NoSuchLifecycleConfiguration" {
+		return okResult([]lifecycleRule{})
+	}
+	if err != nil {
+		return errorResult("Error getting bucket lifecycle", err)
+	}
+
+	rules := make([]lifecycleRule, 0, len(output.Rules))
+	for _, entry := range output.Rules {
+		// Configurations written with the legacy API carry the prefix outside
+		// of the filter
+		rule := lifecycleRule{
+			ID:      aws.ToString(entry.ID),
+			Prefix:  aws.ToString(entry.Prefix),
+			Enabled: entry.Status == types.ExpirationStatusEnabled,
+		}
+		if entry.Filter != nil && entry.Filter.Prefix != nil {
+			rule.Prefix = aws.ToString(entry.Filter.Prefix)
+		}
+		if entry.Expiration != nil {
+			rule.ExpirationDays = aws.ToInt32(entry.Expiration.Days)
+		}
+		if entry.AbortIncompleteMultipartUpload != nil {
+			rule.AbortIncompleteUploadsDays = aws.ToInt32(entry.AbortIncompleteMultipartUpload.DaysAfterInitiation)
+		}
+		rules = append(rules, rule)
+	}
+	return okResult(rules)
+}
+
+// corsRule is one rule of the JSON array taken by setBucketCors and returned
+// by getBucketCors.
+type corsRule struct {
+	ID string `json:"id,omitempty"`
+	// AllowedOrigins are the origins allowed to make cross-origin requests,
+	// e.g. "https://app.example.com" or "*".
+	AllowedOrigins []string `json:"allowedOrigins"`
+	// AllowedMethods are among GET, PUT, POST, DELETE and HEAD.
+	AllowedMethods []string `json:"allowedMethods"`
+	// AllowedHeaders are the request headers allowed in preflight requests.
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+	// ExposeHeaders are the response headers readable by the browser, such as
+	// ETag for multipart uploads.
+	ExposeHeaders []string `json:"exposeHeaders,omitempty"`
+	// MaxAgeSeconds is how long browsers may cache the preflight response.
+	MaxAgeSeconds int32 `json:"maxAgeSeconds,omitempty"`
+}
+
+// corsMethods are the HTTP methods a CORS rule can allow.
+var corsMethods = []string{"GET", "PUT", "POST", "DELETE", "HEAD"}
+
+// parseCorsRules decodes and validates the rulesJson argument of
+// setBucketCors.
+func parseCorsRules(rulesJson string) ([]types.CORSRule, error) {
+	var rules []corsRule
+	decoder := json.NewDecoder(strings.NewReader(rulesJson))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, invalidArgument("invalid CORS rules: %v", err)
+	}
+
+	converted := make([]types.CORSRule, 0, len(rules))
+	for i, rule := range rules {
+		if len(rule.AllowedOrigins) == 0 || len(rule.AllowedMethods) == 0 {
+			return nil, invalidArgument("rule %d: allowedOrigins and allowedMethods must not be empty", i)
+		}
+		for _, method := range rule.AllowedMethods {
+			if !slices.Contains(corsMethods, method) {
+				return nil, invalidArgument("rule %d: unsupported method %q", i, method)
+			}
+		}
+		if rule.MaxAgeSeconds < 0 {
+			return nil, invalidArgument("rule %d: maxAgeSeconds must not be negative", i)
+		}
+
+		entry := types.CORSRule{
+			AllowedOrigins: rule.AllowedOrigins,
+			AllowedMethods: rule.AllowedMethods,
+			AllowedHeaders: rule.AllowedHeaders,
+			ExposeHeaders:  rule.ExposeHeaders,
+		}
+		if rule.ID != "" {
+			entry.ID = aws.String(rule.ID)
+		}
+		if rule.MaxAgeSeconds > 0 {
+			entry.MaxAgeSeconds = aws.Int32(rule.MaxAgeSeconds)
+		}
+		converted = append(converted, entry)
+	}
+	return converted, nil
+}
+
+// setBucketCors replaces the CORS configuration of the configured bucket with
+// rulesJson, a JSON array of rules each with allowedOrigins and
+// allowedMethods, and optionally an id, allowedHeaders, exposeHeaders and
+// maxAgeSeconds. An empty array removes the configuration.
+//
+//export setBucketCors
+func setBucketCors(handle C.longlong, rulesJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error setting bucket CORS", errInvalidHandle)
+	}
+
+	rules, err := parseCorsRules(C.GoString(rulesJson))
+	if err != nil {
+		return errorResult("Error setting bucket CORS", err)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	// S3 rejects a configuration without rules, deleting it is the equivalent
+	if len(rules) == 0 {
+		_, err = bucket.client.DeleteBucketCors(ctx, &s3.DeleteBucketCorsInput{
+			Bucket: aws.String(bucket.BucketName),
+		})
+	} else {
+		_, err = bucket.client.PutBucketCors(ctx, &s3.PutBucketCorsInput{
+			Bucket:            aws.String(bucket.BucketName),
+			CORSConfiguration: &types.CORSConfiguration{CORSRules: rules},
+		})
+	}
+	if err != nil {
+		return errorResult("Error setting bucket CORS", err)
+	}
+	return okResult(nil)
+}
+
+// getBucketCors returns the CORS rules of the configured bucket as a JSON
+// array, empty when it has none.
+//
+//export getBucketCors
+func getBucketCors(handle C.longlong) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error getting bucket CORS", errInvalidHandle)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	output, err := bucket.client.GetBucketCors(ctx, &s3.GetBucketCorsInput{
+		Bucket: aws.String(bucket.BucketName),
+	})
+	if errorCode(err) == "NoSuchCORSConfiguration" {
+		return okResult([]corsRule{})
+	}
+	if err != nil {
+		return errorResult("Error getting bucket CORS", err)
+	}
+
+	rules := make([]corsRule, 0, len(output.CORSRules))
+	for _, entry := range output.CORSRules {
+		rules = append(rules, corsRule{
+			ID:             aws.ToString(entry.ID),
+			AllowedOrigins: entry.AllowedOrigins,
+			AllowedMethods: entry.AllowedMethods,
+			AllowedHeaders: entry.AllowedHeaders,
+			ExposeHeaders:  entry.ExposeHeaders,
+			MaxAgeSeconds:  aws.ToInt32(entry.MaxAgeSeconds),
+		})
+	}
+	return okResult(rules)
+}
+
+// setBucketPolicy replaces the bucket policy of the configured bucket with
+// policyJson, an IAM policy document, e.g. to allow public reads of a prefix
+// or restrict access to an IP range.
+//
+//export setBucketPolicy
+func setBucketPolicy(handle C.longlong, policyJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error setting bucket policy", errInvalidHandle)
+	}
+
+	// Catch malformed documents locally, S3 only reports MalformedPolicy
+	policy := C.GoString(policyJson)
+	var document map[string]any
+	if err := json.Unmarshal([]byte(policy), &document); err != nil {
+		return errorResult("Error setting bucket policy", invalidArgument("policy must be a JSON object: %v", err))
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	_, err := bucket.client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(bucket.BucketName),
+		Policy: aws.String(policy),
+	})
+	if err != nil {
+		return errorResult("Error setting bucket policy", err)
+	}
+	return okResult(nil)
+}
+
+// getBucketPolicy returns the policy document of the configured bucket as
+// data, null when it has none.
+//
+//export getBucketPolicy
+func getBucketPolicy(handle C.longlong) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error getting bucket policy", errInvalidHandle)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	output, err := bucket.client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{
+		Bucket: aws.String(bucket.BucketName),
+	})
+	if errorCode(err) == "NoSuchBucketPolicy" {
+		return okResult(nil)
+	}
+	if err != nil {
+		return errorResult("Error getting bucket policy", err)
+	}
+
+	policy := json.RawMessage(aws.ToString(output.Policy))
+	if !json.Valid(policy) {
+		return errorResult("Error getting bucket policy", fmt.Errorf("service returned a malformed policy: %q", policy))
+	}
+	return okResult(policy)
+}
+
+// deleteBucketPolicy removes the policy of the configured bucket. It succeeds
+// if the bucket has none.
+//
+//export deleteBucketPolicy
+func deleteBucketPolicy(handle C.longlong) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error deleting bucket policy", errInvalidHandle)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	_, err := bucket.client.DeleteBucketPolicy(ctx, &s3.DeleteBucketPolicyInput{
+		Bucket: aws.String(bucket.BucketName),
+	})
+	if err != nil {
+		return errorResult("Error deleting bucket policy", err)
+	}
+	return okResult(nil)
+}
+
+// bucketExists returns 1 when the configured bucket exists, 0 when S3 reports
+// it missing, and -1 for any other failure, like checkKeyBucketExist.
+//
+//export bucketExists
+func bucketExists(handle C.longlong) C.int {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		logger.Error("Invalid handle", "handle", handle, "error", errInvalidHandle)
+		return C.int(-1)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	_, err := bucket.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket.BucketName),
+	})
+	if err == nil {
+		return C.int(1)
+	}
+	if isNotFound(err) {
+		return C.int(0)
+	}
+	logger.Error("Couldn't check bucket", "bucket", bucket.BucketName, "error", describeError(err))
+	return C.int(-1)
+}
+
+// Statuses of the configured bucket reported by bucketStatus.
+const (
+	bucketAccessible = "accessible"
+	bucketForbidden  = "forbidden"
+	bucketMissing    = "missing"
+)
+
+// bucketStatusResult is the JSON shape returned by bucketStatus.
+type bucketStatusResult struct {
+	Status string `json:"status"`
+	// Region is the bucket's region, when accessible and reported.
+	Region string `json:"region,omitempty"`
+}
+
+// isForbidden reports whether err is S3 denying access, as opposed to the
+// resource not existing.
+func isForbidden(err error) bool {
+	// HeadBucket has no response body, so only the status code tells
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusForbidden {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDenied"
+}
+
+// bucketStatus tells whether the configured bucket exists and the credentials
+// can access it, so init flows can tell a typo in the bucket name from
+// missing permissions before the first upload. Unlike bucketExists, a bucket
+// the credentials are denied access to is reported as existing but
+// forbidden; network and other failures are returned as errors.
+//
+//export bucketStatus
+func bucketStatus(handle C.longlong) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error checking bucket", errInvalidHandle)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	output, err := bucket.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket.BucketName),
+	})
+	switch {
+	case err == nil:
+		return okResult(bucketStatusResult{Status: bucketAccessible, Region: aws.ToString(output.BucketRegion)})
+	case isNotFound(err):
+		return okResult(bucketStatusResult{Status: bucketMissing})
+	case isForbidden(err):
+		return okResult(bucketStatusResult{Status: bucketForbidden})
+	}
+	return errorResult("Error checking bucket", err)
+}
+
+// bucketSummary is one entry of the JSON array returned by listBuckets.
+type bucketSummary struct {
+	Name         string `json:"name"`
+	CreationDate string `json:"creationDate,omitempty"`
+	Region       string `json:"region,omitempty"`
+}
+
+// listBuckets returns every bucket visible to the credentials of handle, not
+// only its own bucket, with their creation dates and, where the service
+// reports it, their regions.
+//
+//export listBuckets
+func listBuckets(handle C.longlong) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error listing buckets", errInvalidHandle)
+	}
+
+	buckets := []bucketSummary{}
+	paginator := s3.NewListBucketsPaginator(bucket.client, &s3.ListBucketsInput{})
+	for paginator.HasMorePages() {
+		ctx, cancel := bucket.operationContext()
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return errorResult("Error listing buckets", err)
+		}
+
+		for _, listed := range page.Buckets {
+			summary := bucketSummary{
+				Name:   aws.ToString(listed.Name),
+				Region: aws.ToString(listed.BucketRegion),
+			}
+			if listed.CreationDate != nil {
+				summary.CreationDate = listed.CreationDate.UTC().Format(time.RFC3339)
+			}
+			buckets = append(buckets, summary)
+		}
+	}
+	return okResult(buckets)
+}
+
+// list returns every key in the bucket, following continuation tokens past
+// the 1000-key page limit. Use listPage to page through large buckets.
+//
+//export list
+func list(handle C.longlong) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error listing objects", errInvalidHandle)
+	}
+
+	objectKeys, err := bucket.listKeys("")
+	if err != nil {
+		return errorResult("Error listing objects", bucket.explainRequesterPays(err))
+	}
+
+	return okResult(objectKeys)
+}
+
+// keyPage is the JSON shape returned by listPage.
+type keyPage struct {
+	Keys                  []string `json:"keys"`
+	NextContinuationToken string   `json:"nextContinuationToken,omitempty"`
+}
+
+// listPage returns a single page of keys. Pass an empty continuationToken for
+// the first page, then the returned nextContinuationToken until it is absent.
+// maxKeys <= 0 uses the S3 default of 1000.
+//
+//export listPage
+func listPage(handle C.longlong, continuationToken *C.char, maxKeys C.int) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error listing objects", errInvalidHandle)
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket.BucketName),
+	}
+	if token := C.GoString(continuationToken); token != "" {
+		input.ContinuationToken = aws.String(token)
+	}
+	if maxKeys > 0 {
+		input.MaxKeys = aws.Int32(int32(maxKeys))
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	output, err := bucket.client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return errorResult("Error listing objects", bucket.explainRequesterPays(err))
+	}
+
+	page := keyPage{Keys: []string{}}
+	for _, object := range output.Contents {
+		page.Keys = append(page.Keys, aws.ToString(object.Key))
+	}
+	if aws.ToBool(output.IsTruncated) {
+		page.NextContinuationToken = aws.ToString(output.NextContinuationToken)
+	}
+
+	return okResult(page)
+}
+
+// objectSummary is one entry of the listDetailed result.
+type objectSummary struct {
+	Key          string `json:"key"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"lastModified,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	StorageClass string `json:"storageClass,omitempty"`
+}
+
+// listDetailed lists every object under prefix with its size, modification
+// date, ETag and storage class, following continuation tokens past the
+// 1000-key page limit.
+//
+//export listDetailed
+func listDetailed(handle C.longlong, prefix *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error listing objects", errInvalidHandle)
+	}
+
+	listed, err := bucket.listObjects(C.GoString(prefix))
+	if err != nil {
+		return errorResult("Error listing objects", bucket.explainRequesterPays(err))
+	}
+
+	objects := make([]objectSummary, len(listed))
+	for i, object := range listed {
+		objects[i] = objectSummary{
+			Key:          object.key,
+			Size:         object.size,
+			ETag:         object.etag,
+			StorageClass: object.storageClass,
+		}
+		if !object.lastModified.IsZero() {
+			objects[i].LastModified = object.lastModified.UTC().Format(time.RFC3339)
+		}
+	}
+	return okResult(objects)
+}
+
+// globPrefix returns the part of pattern before its first wildcard, the
+// prefix every matching key starts with.
+func globPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// checkGlob validates the syntax of pattern, see matchGlob.
+func checkGlob(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return invalidArgument("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether key matches pattern, whose "/"-separated segments
+// have the syntax of path.Match: "*" matches any run of characters but "/",
+// "?" a single one and "[...]" a class. A "**" segment matches any number of
+// segments, none included, so "releases/**/manifest.json" matches
+// "releases/manifest.json" and "releases/v1/beta/manifest.json".
+func matchGlob(pattern []string, key []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skipped := 0; skipped <= len(key); skipped++ {
+				if matchGlob(pattern[1:], key[skipped:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(key) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], key[0]); !matched {
+			return false
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0
+}
+
+// listGlob returns the keys matching a glob pattern, see matchGlob, filtered
+// here rather than on the Dart side. Only the keys starting with the pattern's
+// literal prefix are listed, so "releases/*/manifest.json" doesn't list the
+// whole bucket.
+//
+//export listGlob
+func listGlob(handle C.longlong, pattern *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error listing objects", errInvalidHandle)
+	}
+
+	patternStr := C.GoString(pattern)
+	if err := checkGlob(patternStr); err != nil {
+		return errorResult("Error listing objects", err)
+	}
+
+	objectKeys, err := bucket.listKeys(globPrefix(patternStr))
+	if err != nil {
+		return errorResult("Error listing objects", bucket.explainRequesterPays(err))
+	}
+
+	segments := strings.Split(patternStr, "/")
+	matches := []string{}
+	for _, key := range objectKeys {
+		if matchGlob(segments, strings.Split(key, "/")) {
+			matches = append(matches, key)
+		}
+	}
+	return okResult(matches)
+}
+
+// objectStat is the JSON shape returned by statObject.
+type objectStat struct {
+	Exists             bool              `json:"exists"`
+	Size               int64             `json:"size,omitempty"`
+	ContentType        string            `json:"contentType,omitempty"`
+	ETag               string            `json:"etag,omitempty"`
+	LastModified       string            `json:"lastModified,omitempty"`
+	StorageClass       string            `json:"storageClass,omitempty"`
+	CacheControl       string            `json:"cacheControl,omitempty"`
+	ContentDisposition string            `json:"contentDisposition,omitempty"`
+	ContentEncoding    string            `json:"contentEncoding,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	// ClientEncrypted marks objects encrypted by setClientEncryptionKey, whose
+	// Size is that of the ciphertext.
+	ClientEncrypted bool `json:"clientEncrypted,omitempty"`
+	// VersionID is only set on versioned buckets.
+	VersionID string `json:"versionId,omitempty"`
+}
+
+// statObject returns an object's metadata, or {"exists":false} when it does
+// not exist, so it doubles as an existence check. optionsJson is an optional
+// JSON object carrying the SSE-C key of an object uploaded with one, a
+// timeoutSeconds overriding the bucket's operation timeout, the versionId
+// of a previous version to describe and a requestPayer for requester pays
+// buckets.
+//
+//export statObject
+func statObject(handle C.longlong, objectKey *C.char, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error reading object metadata", errInvalidHandle)
+	}
+
+	options, err := parseReadOptions(C.GoString(optionsJson))
+	if err != nil {
+		return errorResult("Error reading object metadata", err)
+	}
+
+	bucket = bucket.withTimeout(options.TimeoutSeconds).withRequestPayer(options.RequestPayer)
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket.BucketName),
+		Key:    aws.String(C.GoString(objectKey)),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = options.customerKeyValues()
+	input.VersionId = options.versionID()
+	output, err := bucket.client.HeadObject(ctx, input)
+
+	var stat objectStat
+	switch {
+	case err == nil:
+		stat = objectStat{
+			Exists:             true,
+			Size:               aws.ToInt64(output.ContentLength),
+			ContentType:        aws.ToString(output.ContentType),
+			ETag:               aws.ToString(output.ETag),
+			StorageClass:       string(output.StorageClass),
+			CacheControl:       aws.ToString(output.CacheControl),
+			ContentDisposition: aws.ToString(output.ContentDisposition),
+			ContentEncoding:    aws.ToString(output.ContentEncoding),
+			Metadata:           output.Metadata,
+			ClientEncrypted:    isClientEncrypted(output.Metadata),
+			VersionID:          aws.ToString(output.VersionId),
+		}
+		// S3 only sends the storage class header for classes other than STANDARD
+		if stat.StorageClass == "" {
+			stat.StorageClass = string(types.StorageClassStandard)
+		}
+		if output.LastModified != nil {
+			stat.LastModified = output.LastModified.UTC().Format(time.RFC3339)
+		}
+	case isNotFound(err):
+		stat = objectStat{Exists: false}
+	default:
+		return errorResult("Error reading object metadata", bucket.explainRequesterPays(err))
+	}
+
+	return okResult(stat)
+}
+
+// listing is the JSON shape returned by listWithPrefix.
+type listing struct {
+	Keys           []string `json:"keys"`
+	CommonPrefixes []string `json:"commonPrefixes"`
+}
+
+// listWithPrefix returns one "folder" of the bucket: the keys directly under
+// prefix and, when delimiter is set, the subfolders as common prefixes. Every
+// page is followed so folders past the 1000-entry limit are complete.
+//
+//export listWithPrefix
+func listWithPrefix(handle C.longlong, prefix *C.char, delimiter *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error listing objects", errInvalidHandle)
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket.BucketName),
+	}
+	if prefixStr := C.GoString(prefix); prefixStr != "" {
+		input.Prefix = aws.String(prefixStr)
+	}
+	// An empty delimiter leaves the listing flat, matching every key under the prefix
+	if delimiterStr := C.GoString(delimiter); delimiterStr != "" {
+		input.Delimiter = aws.String(delimiterStr)
+	}
+
+	folder := listing{
+		Keys:           []string{},
+		CommonPrefixes: []string{},
+	}
+	paginator := s3.NewListObjectsV2Paginator(bucket.client, input)
+	for paginator.HasMorePages() {
+		// Each page gets its own timeout so large folders can still be listed
+		ctx, cancel := bucket.operationContext()
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return errorResult("Error listing objects", bucket.explainRequesterPays(err))
+		}
+
+		for _, object := range page.Contents {
+			folder.Keys = append(folder.Keys, aws.ToString(object.Key))
+		}
+		// S3 counts common prefixes toward the page size, so a folder with
+		// many subfolders spans several pages too
+		for _, commonPrefix := range page.CommonPrefixes {
+			folder.CommonPrefixes = append(folder.CommonPrefixes, aws.ToString(commonPrefix.Prefix))
+		}
+	}
+
+	return okResult(folder)
+}
+
+//export delete
+func delete(handle C.longlong, objectKey *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error deleting object", errInvalidHandle)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	_, err := bucket.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket.BucketName),
+		Key:    aws.String(C.GoString(objectKey)),
+	})
+	if err != nil {
+		return errorResult("Error deleting object", err)
+	}
+	return okResult(nil)
+}
+
+// deleteObjectVersion permanently deletes one version of an object, or a
+// delete marker, on a versioned bucket. Unlike delete, which only adds a
+// delete marker there, the version can't be restored afterwards.
+//
+//export deleteObjectVersion
+func deleteObjectVersion(handle C.longlong, objectKey *C.char, versionId *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error deleting object version", errInvalidHandle)
+	}
+
+	versionIdStr := C.GoString(versionId)
+	if versionIdStr == "" {
+		return errorResult("Error deleting object version", invalidArgument("version ID must not be empty"))
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	_, err := bucket.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:    aws.String(bucket.BucketName),
+		Key:       aws.String(C.GoString(objectKey)),
+		VersionId: aws.String(versionIdStr),
+	})
+	if err != nil {
+		return errorResult("Error deleting object version", err)
+	}
+	return okResult(nil)
+}
+
+// errNoDeleteMarker is returned by restoreDeleted when the latest version of
+// the object isn't a delete marker, or the object has no version at all.
+var errNoDeleteMarker = errors.New("object has no delete marker to remove")
+
+// restoreDeleted undoes a delete on a versioned bucket by removing the
+// object's latest delete marker, which makes the version underneath it
+// current again.
+//
+//export restoreDeleted
+func restoreDeleted(handle C.longlong, objectKey *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error restoring object", errInvalidHandle)
+	}
+
+	key := C.GoString(objectKey)
+	markerID, err := bucket.latestDeleteMarker(key)
+	if err != nil {
+		return errorResult("Error restoring object", err)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	_, err = bucket.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:    aws.String(bucket.BucketName),
+		Key:       aws.String(key),
+		VersionId: aws.String(markerID),
+	})
+	if err != nil {
+		return errorResult("Error restoring object", err)
+	}
+	return okResult(nil)
+}
+
+// latestDeleteMarker returns the version ID of the delete marker hiding key,
+// or errNoDeleteMarker if its latest version is a regular one.
+func (b *S3Bucket) latestDeleteMarker(key string) (string, error) {
+	paginator := s3.NewListObjectVersionsPaginator(b.client, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(b.BucketName),
+		Prefix: aws.String(key),
+	})
+	for paginator.HasMorePages() {
+		ctx, cancel := b.operationContext()
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return "", err
+		}
+
+		// The prefix also matches longer keys, only the exact one counts
+		for _, marker := range page.DeleteMarkers {
+			if aws.ToString(marker.Key) == key && aws.ToBool(marker.IsLatest) {
+				return aws.ToString(marker.VersionId), nil
+			}
+		}
+		for _, version := range page.Versions {
+			if aws.ToString(version.Key) == key && aws.ToBool(version.IsLatest) {
+				return "", errNoDeleteMarker
+			}
+		}
+	}
+	return "", errNoDeleteMarker
+}
+
+// maxDeleteBatch is the most keys a single DeleteObjects request accepts.
+const maxDeleteBatch = 1000
+
+// deleteError describes one key S3 refused to delete.
+type deleteError struct {
+	Key     string `json:"key"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// deleteManyResult is the JSON shape returned by deleteMany.
+type deleteManyResult struct {
+	Deleted []string      `json:"deleted"`
+	Errors  []deleteError `json:"errors"`
+}
+
+// deleteKeys removes keys in batches of up to 1000 keys. S3 may partially
+// fail a batch, so every key ends up in either Deleted or Errors.
+func (b *S3Bucket) deleteKeys(objectKeys []string) deleteManyResult {
+	objects := make([]types.ObjectIdentifier, len(objectKeys))
+	for i, key := range objectKeys {
+		objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+	}
+	return b.deleteObjects(objects)
+}
+
+// deleteObjects is deleteKeys for identifiers that may name a version of
+// their object. A key appears once per version in the result.
+func (b *S3Bucket) deleteObjects(identifiers []types.ObjectIdentifier) deleteManyResult {
+	summary := deleteManyResult{
+		Deleted: []string{},
+		Errors:  []deleteError{},
+	}
+
+	for start := 0; start < len(identifiers); start += maxDeleteBatch {
+		objects := identifiers[start:min(start+maxDeleteBatch, len(identifiers))]
+
+		// Quiet mode only reports failures, which keeps responses small for
+		// large batches; every other key of the batch was deleted
+		ctx, cancel := b.operationContext()
+		output, err := b.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(b.BucketName),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		cancel()
+		if err != nil {
+			// The whole request failed, so none of the keys in this batch were removed
+			errMsg := describeError(err)
+			logger.Error("Error deleting objects", "error", errMsg)
+			for _, object := range objects {
+				summary.Errors = append(summary.Errors, deleteError{Key: aws.ToString(object.Key), Code: errorCode(err), Message: errMsg})
+			}
+			continue
+		}
+
+		// Keys and version IDs travel as XML, which can't carry a NUL, so
+		// one can join them
+		identify := func(key *string, versionID *string) string {
+			return aws.ToString(key) + "\x00" + aws.ToString(versionID)
+		}
+		failed := make(map[string]bool, len(output.Errors))
+		for _, failedObject := range output.Errors {
+			failed[identify(failedObject.Key, failedObject.VersionId)] = true
+			summary.Errors = append(summary.Errors, deleteError{
+				Key:     aws.ToString(failedObject.Key),
+				Code:    aws.ToString(failedObject.Code),
+				Message: aws.ToString(failedObject.Message),
+			})
+		}
+		for _, object := range objects {
+			if !failed[identify(object.Key, object.VersionId)] {
+				summary.Deleted = append(summary.Deleted, aws.ToString(object.Key))
+			}
+		}
+	}
+
+	return summary
+}
+
+// deleteMany removes a JSON array of keys in batches of up to 1000 keys.
+//
+//export deleteMany
+func deleteMany(handle C.longlong, objectKeysJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error deleting objects", errInvalidHandle)
+	}
+
+	var objectKeys []string
+	if err := json.Unmarshal([]byte(C.GoString(objectKeysJson)), &objectKeys); err != nil {
+		return errorResult("Error deleting objects", invalidArgument("invalid key list: %v", err))
+	}
+
+	return okResult(bucket.deleteKeys(objectKeys))
+}
+
+// listKeys returns every key under prefix, following continuation tokens.
+func (b *S3Bucket) listKeys(prefix string) ([]string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.BucketName),
+	}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+
+	objectKeys := []string{}
+	paginator := s3.NewListObjectsV2Paginator(b.client, input)
+	for paginator.HasMorePages() {
+		// Each page gets its own timeout so large buckets can still be listed
+		ctx, cancel := b.operationContext()
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range page.Contents {
+			objectKeys = append(objectKeys, aws.ToString(object.Key))
+		}
+	}
+	return objectKeys, nil
+}
+
+// deletePrefix removes every object under prefix, e.g. a per-user directory.
+// With dryRun set (1) nothing is deleted and the keys that would be removed
+// are returned instead. An empty prefix is rejected so a missing argument
+// can't wipe the whole bucket.
+//
+//export deletePrefix
+func deletePrefix(handle C.longlong, prefix *C.char, dryRun C.int) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error deleting prefix", errInvalidHandle)
+	}
+
+	prefixStr := C.GoString(prefix)
+	if prefixStr == "" {
+		return errorResult("Error deleting prefix", invalidArgument("prefix must not be empty"))
+	}
+
+	objectKeys, err := bucket.listKeys(prefixStr)
+	if err != nil {
+		return errorResult("Error deleting prefix", err)
+	}
+	if dryRun != 0 {
+		return okResult(objectKeys)
+	}
+
+	return okResult(bucket.deleteKeys(objectKeys))
+}
+
+// copySource builds the CopySource value for CopyObject: "bucket/key" with the
+// key escaped by escapeKey.
+func copySource(bucketName string, objectKey string) string {
+	return bucketName + "/" + escapeKey(objectKey)
+}
+
+// escapeKey URL-escapes objectKey segment by segment so slashes keep
+// separating "folders".
+func escapeKey(objectKey string) string {
+	segments := strings.Split(objectKey, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// copyOptions are the optional settings of copyObject, decoded from its
+// optionsJson argument. Empty fields keep the S3 defaults.
+type copyOptions struct {
+	StorageClass string `json:"storageClass"`
+	encryptionOptions
+	timeoutOptions
+}
+
+// parseCopyOptions decodes the optionsJson argument of copyObject.
+func parseCopyOptions(optionsJson string) (copyOptions, error) {
+	var options copyOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	err := options.checkCopy()
+	return options, err
+}
+
+// checkCopy validates decoded copy options.
+func (o copyOptions) checkCopy() error {
+	if err := checkStorageClass(o.StorageClass); err != nil {
+		return err
+	}
+	if err := o.check(); err != nil {
+		return err
+	}
+	return o.checkTimeout()
+}
+
+// applyToCopy sets the options on a CopyObject request.
+func (o copyOptions) applyToCopy(input *s3.CopyObjectInput) {
+	if o.StorageClass != "" {
+		input.StorageClass = types.StorageClass(o.StorageClass)
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId = o.values()
+}
+
+// applyToCreateMultipart sets the options on the upload of a multipart copy.
+func (o copyOptions) applyToCreateMultipart(input *s3.CreateMultipartUploadInput) {
+	if o.StorageClass != "" {
+		input.StorageClass = types.StorageClass(o.StorageClass)
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId = o.values()
+}
+
+// copyObject copies sourceKey to destKey server-side within the bucket.
+func (b *S3Bucket) copyObject(sourceKey string, destKey string, options copyOptions) error {
+	// Copying an object onto itself is only meaningful to change its storage
+	// class or encryption
+	if sourceKey == destKey && options.StorageClass == "" && options.ServerSideEncryption == "" {
+		return invalidArgument("source and destination keys are identical (%v)", sourceKey)
+	}
+
+	return b.copyFrom(b.BucketName, sourceKey, destKey, options)
+}
+
+// copyFrom copies sourceKey of sourceBucket, on the same service as b, to
+// destKey of b server-side.
+func (b *S3Bucket) copyFrom(sourceBucket string, sourceKey string, destKey string, options copyOptions) error {
+	ctx, cancel := b.operationContext()
+	defer cancel()
+
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(b.BucketName),
+		CopySource: aws.String(copySource(sourceBucket, sourceKey)),
+		Key:        aws.String(destKey),
+	}
+	options.applyToCopy(input)
+	_, err := b.client.CopyObject(ctx, input)
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("source object %v does not exist: %w", sourceKey, err)
+		}
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "InvalidRequest" || apiErr.ErrorCode() == "EntityTooLarge") {
+			// CopyObject rejects sources over 5 GiB; those have to be copied part by part
+			head, headErr := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+				Bucket: aws.String(sourceBucket),
+				Key:    aws.String(sourceKey),
+			})
+			if headErr == nil && aws.ToInt64(head.ContentLength) > maxCopyObjectSize {
+				return b.multipartCopy(sourceBucket, sourceKey, destKey, head, options)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+const (
+	// maxCopyObjectSize is the largest source CopyObject accepts.
+	maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+	// copyPartSize is the size of each UploadPartCopy in a multipart copy.
+	copyPartSize = 512 * 1024 * 1024
+)
+
+// multipartCopy copies an object of sourceBucket too large for CopyObject
+// with UploadPartCopy.
+// Unlike CopyObject it doesn't carry the source's headers over, so they are
+// taken from source. On failure the upload is aborted so no parts linger.
+func (b *S3Bucket) multipartCopy(sourceBucket string, sourceKey string, destKey string, source *s3.HeadObjectOutput, options copyOptions) error {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(b.BucketName),
+		Key:                aws.String(destKey),
+		ContentType:        source.ContentType,
+		CacheControl:       source.CacheControl,
+		ContentDisposition: source.ContentDisposition,
+		ContentEncoding:    source.ContentEncoding,
+		Metadata:           source.Metadata,
+	}
+	options.applyToCreateMultipart(input)
+
+	ctx, cancel := b.operationContext()
+	upload, err := b.client.CreateMultipartUpload(ctx, input)
+	cancel()
+	if err != nil {
+		return err
+	}
+	uploadID := aws.ToString(upload.UploadId)
+
+	size := aws.ToInt64(source.ContentLength)
+	var parts []types.CompletedPart
+	for partNumber, offset := int32(1), int64(0); offset < size; partNumber, offset = partNumber+1, offset+copyPartSize {
+		// Each part gets its own timeout so the whole copy isn't bound by one
+		ctx, cancel := b.operationContext()
+		part, err := b.client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(b.BucketName),
+			Key:             aws.String(destKey),
+			UploadId:        aws.String(uploadID),
+			PartNumber:      aws.Int32(partNumber),
+			CopySource:      aws.String(copySource(sourceBucket, sourceKey)),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, min(offset+copyPartSize, size)-1)),
+			// Fail rather than stitch together parts of two versions if the source changes mid-copy
+			CopySourceIfMatch: source.ETag,
+		})
+		cancel()
+		if err != nil {
+			b.abortFailedUpload(destKey, uploadID)
+			return err
+		}
+		parts = append(parts, types.CompletedPart{
+			ETag:       part.CopyPartResult.ETag,
+			PartNumber: aws.Int32(partNumber),
+		})
+	}
+
+	ctx, cancel = b.operationContext()
+	defer cancel()
+
+	_, err = b.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.BucketName),
+		Key:             aws.String(destKey),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		b.abortFailedUpload(destKey, uploadID)
+		return err
+	}
+	return nil
+}
+
+// abortTimeout bounds the abort of the multipart upload of a failed transfer.
+const abortTimeout = 30 * time.Second
+
+// abortFailedUpload aborts the multipart upload of a failed transfer. The
+// failure may be the cancellation of the bucket's operations, so the abort
+// runs detached from it. An upload that can't be aborted keeps accruing
+// storage charges, so the failure is logged for abortStaleMultipartUploads to
+// clean up.
+func (b *S3Bucket) abortFailedUpload(objectKey string, uploadID string) {
+	parent := b.baseContext
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), abortTimeout)
+	defer cancel()
+
+	_, err := b.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(b.BucketName),
+		Key:      aws.String(objectKey),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		logger.Warn("Couldn't abort multipart upload, its parts remain until aborted", "uploadId", uploadID, "key", objectKey, "error", describeError(err))
+	}
+}
+
+// copyObject copies an object server-side. optionsJson is an optional JSON
+// object; its storageClass moves the copy to another storage class, and with
+// it sourceKey may equal destKey to change the class in place. Its
+// serverSideEncryption and sseKmsKeyId re-encrypt the copy, and its
+// timeoutSeconds overrides the bucket's operation timeout.
+//
+//export copyObject
+func copyObject(handle C.longlong, sourceKey *C.char, destKey *C.char, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error copying object", errInvalidHandle)
+	}
+
+	options, err := parseCopyOptions(C.GoString(optionsJson))
+	if err != nil {
+		return errorResult("Error copying object", err)
+	}
+
+	if err := bucket.withTimeout(options.TimeoutSeconds).copyObject(C.GoString(sourceKey), C.GoString(destKey), options); err != nil {
+		return errorResult("Error copying object", err)
+	}
+	return okResult(nil)
+}
+
+// copyPrefixOptions are the optional settings of copyPrefix, decoded from its
+// optionsJson argument: the copy options applied to every object and the
+// size of the worker pool.
+type copyPrefixOptions struct {
+	copyOptions
+	Concurrency int `json:"concurrency"`
+}
+
+// parseCopyPrefixOptions decodes the optionsJson argument of copyPrefix.
+func parseCopyPrefixOptions(optionsJson string) (copyPrefixOptions, error) {
+	var options copyPrefixOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	if err := options.checkCopy(); err != nil {
+		return options, err
+	}
+	if options.Concurrency < 0 {
+		return options, invalidArgument("concurrency must not be negative")
+	}
+	if options.Concurrency == 0 {
+		options.Concurrency = defaultDirectoryConcurrency
+	}
+	return options, nil
+}
+
+// copyError describes one object copyPrefix failed to copy.
+type copyError struct {
+	SourceKey string `json:"sourceKey"`
+	DestKey   string `json:"destKey"`
+	Code      string `json:"code,omitempty"`
+	Message   string `json:"message"`
+}
+
+// copyPrefixResult is the JSON shape returned by copyPrefix. Copied holds the
+// keys of the copies, in no particular order.
+type copyPrefixResult struct {
+	Copied []string    `json:"copied"`
+	Errors []copyError `json:"errors"`
+}
+
+// copyPrefix copies every object under srcPrefix server-side to the same key
+// with srcPrefix replaced by dstPrefix, e.g. to promote "staging/" to
+// "release/". The objects are listed before the first copy, so copies landing
+// under srcPrefix aren't copied again. optionsJson is an optional JSON object
+// with the options of copyObject, applied to every object, and the
+// concurrency of the worker pool.
+//
+//export copyPrefix
+func copyPrefix(handle C.longlong, srcPrefix *C.char, dstPrefix *C.char, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error copying prefix", errInvalidHandle)
+	}
+
+	options, err := parseCopyPrefixOptions(C.GoString(optionsJson))
+	if err != nil {
+		return errorResult("Error copying prefix", err)
+	}
+	srcPrefixStr, dstPrefixStr := C.GoString(srcPrefix), C.GoString(dstPrefix)
+	if srcPrefixStr == dstPrefixStr {
+		return errorResult("Error copying prefix", invalidArgument("source and destination prefixes are identical (%v)", srcPrefixStr))
+	}
+	bucket = bucket.withTimeout(options.TimeoutSeconds)
+
+	sourceKeys, err := bucket.listKeys(srcPrefixStr)
+	if err != nil {
+		return errorResult("Error copying prefix", err)
+	}
+
+	jobs := make(chan string)
+	var (
+		mu      sync.Mutex
+		summary = copyPrefixResult{Copied: []string{}, Errors: []copyError{}}
+		wg      sync.WaitGroup
+	)
+	for range options.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sourceKey := range jobs {
+				destKey := dstPrefixStr + strings.TrimPrefix(sourceKey, srcPrefixStr)
+				err := bucket.copyObject(sourceKey, destKey, options.copyOptions)
+
+				mu.Lock()
+				if err != nil {
+					logger.Error("Error copying object", "key", sourceKey, "error", describeError(err))
+					summary.Errors = append(summary.Errors, copyError{
+						SourceKey: sourceKey,
+						DestKey:   destKey,
+						Code:      errorCode(err),
+						Message:   describeError(err),
+					})
+				} else {
+					summary.Copied = append(summary.Copied, destKey)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, sourceKey := range sourceKeys {
+		if bucket.canceled() != nil {
+			break
+		}
+		jobs <- sourceKey
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := bucket.canceled(); err != nil {
+		return errorResult("Error copying prefix", err)
+	}
+	return okResult(summary)
+}
+
+// mirrorOptions are the optional settings of mirrorBucket, decoded from its
+// optionsJson argument: the sync options, delete removing the destination's
+// objects missing from the source, and the timeout of each request.
+type mirrorOptions struct {
+	syncOptions
+	timeoutOptions
+}
+
+// parseMirrorOptions decodes the optionsJson argument of mirrorBucket.
+func parseMirrorOptions(optionsJson string) (mirrorOptions, error) {
+	var options mirrorOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	if err := options.checkTimeout(); err != nil {
+		return options, err
+	}
+	err := options.checkSync()
+	return options, err
+}
+
+// sameService reports whether a and b are buckets of the same service, so b
+// can copy the objects of a server-side.
+func sameService(a *S3Bucket, b *S3Bucket) bool {
+	aOptions, bOptions := a.client.Options(), b.client.Options()
+	return aws.ToString(aOptions.BaseEndpoint) == aws.ToString(bOptions.BaseEndpoint) && aOptions.Region == bOptions.Region
+}
+
+// mirrorReason tells why the source object must be copied over its copy in
+// the destination, or "" when the copy is up to date: it has the source's
+// size and either its ETag or a later modification date. Copies made by
+// streaming the object get another ETag when uploaded in parts.
+func mirrorReason(source remoteObject, dest remoteObject, found bool) string {
+	switch {
+	case !found:
+		return syncMissing
+	case source.size != dest.size:
+		return syncSize
+	case source.etag == dest.etag || !dest.lastModified.Before(source.lastModified):
+		return ""
+	}
+	return syncModified
+}
+
+// streamFrom copies objectKey of source, on any service, to b by downloading
+// it and uploading the stream. The bytes and headers are copied as is, so
+// client-side encrypted and compressed objects stay so.
+func (b *S3Bucket) streamFrom(source *S3Bucket, objectKey string) error {
+	ctx, cancel := source.operationContext()
+	defer cancel()
+
+	result, err := source.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(source.BucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return err
+	}
+	defer result.Body.Close()
+
+	_, err = b.put(&s3.PutObjectInput{
+		Bucket:             aws.String(b.BucketName),
+		Key:                aws.String(objectKey),
+		Body:               result.Body,
+		ContentLength:      result.ContentLength,
+		ContentType:        result.ContentType,
+		CacheControl:       result.CacheControl,
+		ContentDisposition: result.ContentDisposition,
+		ContentEncoding:    result.ContentEncoding,
+		ContentLanguage:    result.ContentLanguage,
+		Metadata:           result.Metadata,
+	})
+	return err
+}
+
+// mirrorBucket copies every object under prefix, or of the whole bucket when
+// empty, from the bucket of sourceHandle to the bucket of destHandle under
+// the same key, e.g. to migrate from S3 to R2. Objects are copied
+// server-side when both buckets are on the same service and the
+// destination's credentials can read the source, and streamed through the
+// library otherwise. Objects whose copy is up to date are skipped, so a
+// mirror interrupted midway resumes where it stopped when run again.
+// optionsJson is an optional JSON object with the concurrency of the worker
+// pool, delete to also remove the destination's objects under prefix missing
+// from the source, dryRun to only report what would change and
+// timeoutSeconds overriding the timeout of both buckets.
+//
+//export mirrorBucket
+func mirrorBucket(sourceHandle C.longlong, destHandle C.longlong, prefix *C.char, optionsJson *C.char) *C.char {
+	source, dest := lookupBucket(sourceHandle), lookupBucket(destHandle)
+	if source == nil || dest == nil {
+		return errorResult("Error mirroring bucket", errInvalidHandle)
+	}
+
+	options, err := parseMirrorOptions(C.GoString(optionsJson))
+	if err != nil {
+		return errorResult("Error mirroring bucket", err)
+	}
+	serverSide := sameService(source, dest)
+	if serverSide && source.BucketName == dest.BucketName {
+		return errorResult("Error mirroring bucket", invalidArgument("source and destination are the same bucket (%v)", source.BucketName))
+	}
+	source, dest = source.withTimeout(options.TimeoutSeconds), dest.withTimeout(options.TimeoutSeconds)
+
+	prefixStr := C.GoString(prefix)
+	sourceObjects, err := source.listObjects(prefixStr)
+	if err != nil {
+		return errorResult("Error mirroring bucket", fmt.Errorf("couldn't list source bucket %v: %w", source.BucketName, err))
+	}
+	destObjects, err := dest.listObjects(prefixStr)
+	if err != nil {
+		return errorResult("Error mirroring bucket", fmt.Errorf("couldn't list destination bucket %v: %w", dest.BucketName, err))
+	}
+	existing := make(map[string]remoteObject, len(destObjects))
+	for _, object := range destObjects {
+		existing[object.key] = object
+	}
+
+	summary := syncResult{Transferred: []syncEntry{}, Deleted: []syncEntry{}, Errors: []fileError{}, DryRun: options.DryRun}
+	var copies []syncEntry
+	inSource := make(map[string]bool, len(sourceObjects))
+	for _, object := range sourceObjects {
+		inSource[object.key] = true
+		mirrored, found := existing[object.key]
+		if reason := mirrorReason(object, mirrored, found); reason != "" {
+			copies = append(copies, syncEntry{Key: object.key, Reason: reason})
+		} else {
+			summary.Skipped++
+		}
+	}
+
+	if options.DryRun {
+		summary.Transferred = append(summary.Transferred, copies...)
+	} else {
+		var streamOnly atomic.Bool
+		source.transferAll(copies, options.Concurrency, &summary, func(entry syncEntry) error {
+			if serverSide && !streamOnly.Load() {
+				err := dest.copyFrom(source.BucketName, entry.Key, entry.Key, copyOptions{})
+				if err == nil || errorCode(err) != "AccessDenied" {
+					return err
+				}
+				// The destination's credentials can't read the source, so
+				// every object has to go through the library
+				streamOnly.Store(true)
+			}
+			return dest.streamFrom(source, entry.Key)
+		})
+	}
+
+	if options.Delete && source.canceled() == nil {
+		var extraneous []string
+		for _, object := range destObjects {
+			if !inSource[object.key] {
+				extraneous = append(extraneous, object.key)
+			}
+		}
+		deleted := extraneous
+		if !options.DryRun {
+			result := dest.deleteKeys(extraneous)
+			deleted = result.Deleted
+			for _, failed := range result.Errors {
+				summary.Errors = append(summary.Errors, fileError{Key: failed.Key, Code: failed.Code, Message: failed.Message})
+			}
+		}
+		for _, key := range deleted {
+			summary.Deleted = append(summary.Deleted, syncEntry{Key: key})
+		}
+	}
+
+	if err := source.canceled(); err != nil {
+		return errorResult("Error mirroring bucket", err)
+	}
+	return okResult(summary)
+}
+
+// sourceNotDeletedError reports a move whose copy succeeded but whose source
+// could not be removed: the data is safe at the destination, and both keys exist.
+type sourceNotDeletedError struct {
+	sourceKey string
+	destKey   string
+	err       error
+}
+
+func (e *sourceNotDeletedError) Error() string {
+	return fmt.Sprintf("object was copied to %v but source %v could not be deleted and still exists: %v", e.destKey, e.sourceKey, e.err)
+}
+
+func (e *sourceNotDeletedError) Unwrap() error {
+	return e.err
+}
+
+// moveObject copies sourceKey to destKey server-side, then deletes the source
+// only once the copy succeeded.
+//
+//export moveObject
+func moveObject(handle C.longlong, sourceKey *C.char, destKey *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error moving object", errInvalidHandle)
+	}
+	sourceKeyStr := C.GoString(sourceKey)
+	destKeyStr := C.GoString(destKey)
+
+	if err := bucket.copyObject(sourceKeyStr, destKeyStr, copyOptions{}); err != nil {
+		return errorResult("Error moving object", err)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	_, err := bucket.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket.BucketName),
+		Key:    aws.String(sourceKeyStr),
+	})
+	if err != nil {
+		return errorResult("Error moving object", &sourceNotDeletedError{sourceKey: sourceKeyStr, destKey: destKeyStr, err: err})
+	}
+	return okResult(nil)
+}
+
+// readOptions are the optional settings of statObject, decoded from its
+// optionsJson argument, and those of download shared with it.
+type readOptions struct {
+	// VersionID selects a version of the object on a versioned bucket, the
+	// latest one when empty.
+	VersionID string `json:"versionId"`
+	customerKeyOptions
+	timeoutOptions
+	requestPayerOptions
+}
+
+// versionID returns the VersionId of requests, nil for the latest version.
+func (o readOptions) versionID() *string {
+	if o.VersionID == "" {
+		return nil
+	}
+	return aws.String(o.VersionID)
+}
+
+// parseReadOptions decodes the optionsJson argument of statObject.
+func parseReadOptions(optionsJson string) (readOptions, error) {
+	var options readOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	err := options.checkRead()
+	return options, err
+}
+
+// checkRead validates decoded read options and fills in the SSE-C defaults.
+func (o *readOptions) checkRead() error {
+	if err := o.checkCustomerKey(); err != nil {
+		return err
+	}
+	if err := o.checkTimeout(); err != nil {
+		return err
+	}
+	return o.checkRequestPayer()
+}
+
+// objectReadOptions are the optional settings of downloadRange, downloadBytes
+// and downloadStream, decoded from their optionsJson argument: those of
+// statObject plus extra request headers.
+type objectReadOptions struct {
+	readOptions
+	headerOptions
+}
+
+// parseObjectReadOptions decodes the optionsJson argument of downloadRange,
+// downloadBytes and downloadStream.
+func parseObjectReadOptions(optionsJson string) (objectReadOptions, error) {
+	var options objectReadOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	if err := options.checkRead(); err != nil {
+		return options, err
+	}
+	return options, options.checkHeaders()
+}
+
+// downloadOptions are the optional settings of download, decoded from its
+// optionsJson argument.
+type downloadOptions struct {
+	readOptions
+	bandwidthOptions
+	headerOptions
+	// Resumable keeps what was received across failed attempts, see
+	// downloadResumable.
+	Resumable bool `json:"resumable"`
+}
+
+// parseDownloadOptions decodes the optionsJson argument of download.
+func parseDownloadOptions(optionsJson string) (downloadOptions, error) {
+	var options downloadOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	err := options.checkDownload()
+	return options, err
+}
+
+// checkDownload validates decoded download options and fills in the SSE-C
+// defaults.
+func (o *downloadOptions) checkDownload() error {
+	if err := o.checkRead(); err != nil {
+		return err
+	}
+	if err := o.checkBandwidth(); err != nil {
+		return err
+	}
+	return o.checkHeaders()
+}
+
+// downloadFile writes the object at objectKey to destinationPath, in parts
+// fetched concurrently by the downloader.
+func (b *S3Bucket) downloadFile(objectKey string, destinationPath string, options downloadOptions) error {
+	ctx, cancel := b.operationContext()
+	defer cancel()
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(objectKey),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = options.customerKeyValues()
+	input.VersionId = options.versionID()
+	head, err := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		VersionId:            input.VersionId,
+		SSECustomerAlgorithm: input.SSECustomerAlgorithm,
+		SSECustomerKey:       input.SSECustomerKey,
+		SSECustomerKeyMD5:    input.SSECustomerKeyMD5,
+		ChecksumMode:         types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return err
+	}
+	if _, compressed := isCompressed(head.Metadata); compressed || isClientEncrypted(head.Metadata) {
+		// GCM already authenticates what is decrypted, and the compression
+		// formats what is decompressed
+		return b.downloadWhole(ctx, input, destinationPath)
+	}
+	if options.Resumable {
+		return b.downloadResumable(ctx, input, head, destinationPath)
+	}
+
+	// Every part must come from the object headed, not one overwritten meanwhile
+	input.IfMatch = head.ETag
+	file, err := os.Create(destinationPath)
+	if err != nil {
+		return fmt.Errorf("couldn't create file %v: %w", destinationPath, err)
+	}
+	defer file.Close()
+
+	_, err = b.downloader().Download(ctx, newProgressWriterAt(file, aws.ToInt64(head.ContentLength)), input)
+	if err != nil {
+		return err
+	}
+	if err := verifyDownload(objectKey, destinationPath, head); err != nil {
+		file.Close()
+		os.Remove(destinationPath)
+		return err
+	}
+	return nil
+}
+
+// downloadWhole writes the object of input to destinationPath with a single
+// GetObject, needed by client-side encrypted objects which are decrypted whole
+// and compressed objects which are decompressed as a stream.
+func (b *S3Bucket) downloadWhole(ctx context.Context, input *s3.GetObjectInput, destinationPath string) error {
+	result, err := b.client.GetObject(ctx, input)
+	if err != nil {
+		return err
+	}
+	defer result.Body.Close()
+
+	// Opened before the file is created so a failed decryption leaves no file behind
+	body, err := b.openBody(result)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(destinationPath)
+	if err != nil {
+		return fmt.Errorf("couldn't create file %v: %w", destinationPath, err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, body)
+	if err != nil {
+		// Decompression stops at corrupted content, which must not be left behind
+		file.Close()
+		os.Remove(destinationPath)
+		return fmt.Errorf("couldn't write file %v: %w", destinationPath, err)
+	}
+	return nil
+}
+
+// resumeState is recorded next to the .part file of a resumable download,
+// whose length is the number of bytes already received.
+type resumeState struct {
+	// ETag identifies the object being downloaded, the .part file is
+	// discarded when the object changed since.
+	ETag string `json:"etag"`
+	Size int64  `json:"size"`
+}
+
+// downloadResumable writes the object of input, described by head, to
+// destinationPath + ".part" then renames it to destinationPath once complete.
+// When a previous attempt for the same object left a .part file, only the
+// missing bytes are requested with a Range request, so a dropped connection
+// doesn't restart a large download from scratch.
+func (b *S3Bucket) downloadResumable(ctx context.Context, input *s3.GetObjectInput, head *s3.HeadObjectOutput, destinationPath string) error {
+	partPath := destinationPath + ".part"
+	statePath := partPath + ".json"
+	state := resumeState{ETag: aws.ToString(head.ETag), Size: aws.ToInt64(head.ContentLength)}
+
+	var offset int64
+	var previous resumeState
+	if data, err := os.ReadFile(statePath); err == nil && json.Unmarshal(data, &previous) == nil && previous == state {
+		if info, err := os.Stat(partPath); err == nil && info.Size() <= state.Size {
+			offset = info.Size()
+		}
+	}
+	if offset == 0 {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(statePath, data, 0o644); err != nil {
+			return fmt.Errorf("couldn't record download state %v: %w", statePath, err)
+		}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return fmt.Errorf("couldn't open file %v: %w", partPath, err)
+	}
+	defer file.Close()
+
+	if offset < state.Size {
+		input.IfMatch = head.ETag
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+		result, err := b.client.GetObject(ctx, input)
+		if err != nil {
+			var apiErr smithy.APIError
+			if errors.As(err, &apiErr) && apiErr.ErrorCode() == "PreconditionFailed" {
+				// The object changed since it was headed, start over next time
+				os.Remove(statePath)
+			}
+			return err
+		}
+		defer result.Body.Close()
+
+		body := newProgressReader(result.Body, state.Size)
+		if progress, ok := body.(*progressReader); ok {
+			// Count the bytes received by earlier attempts
+			progress.transferred = offset
+		}
+		if _, err := io.Copy(file, body); err != nil {
+			return fmt.Errorf("couldn't write file %v: %w", partPath, err)
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("couldn't write file %v: %w", partPath, err)
+	}
+	if err := verifyDownload(aws.ToString(input.Key), partPath, head); err != nil {
+		// Resuming would only keep the corrupt bytes
+		os.Remove(partPath)
+		os.Remove(statePath)
+		return err
+	}
+	if err := os.Rename(partPath, destinationPath); err != nil {
+		return fmt.Errorf("couldn't rename %v to %v: %w", partPath, destinationPath, err)
+	}
+	os.Remove(statePath)
+	return nil
+}
+
+// integrityError reports a downloaded file whose content doesn't match the
+// checksum or ETag of the object, i.e. it was corrupted on the way.
+type integrityError struct {
+	objectKey string
+	algorithm string
+	expected  string
+	actual    string
+}
+
+func (e *integrityError) Error() string {
+	return fmt.Sprintf("downloaded content of %v doesn't match its %v: expected %v, got %v", e.objectKey, e.algorithm, e.expected, e.actual)
+}
+
+// expectedDigest returns the algorithm and value a download of the object
+// described by head can be verified against, preferring a checksum stored
+// with the object over its ETag. ok is false when neither covers the whole
+// content: composite checksums of multipart uploads are computed over their
+// parts, and the ETag is only an MD5 digest of single-part objects not
+// encrypted with KMS or SSE-C.
+func expectedDigest(head *s3.HeadObjectOutput) (algorithm string, expected string, ok bool) {
+	if head.ChecksumType != types.ChecksumTypeComposite {
+		checksums := []struct {
+			algorithm types.ChecksumAlgorithm
+			value     *string
+		}{
+			{types.ChecksumAlgorithmCrc64nvme, head.ChecksumCRC64NVME},
+			{types.ChecksumAlgorithmCrc32c, head.ChecksumCRC32C},
+			{types.ChecksumAlgorithmCrc32, head.ChecksumCRC32},
+			{types.ChecksumAlgorithmSha256, head.ChecksumSHA256},
+			{types.ChecksumAlgorithmSha1, head.ChecksumSHA1},
+		}
+		for _, checksum := range checksums {
+			// Composite checksums end with the number of parts
+			if value := aws.ToString(checksum.value); value != "" && !strings.Contains(value, "-") {
+				return string(checksum.algorithm), value, true
+			}
+		}
+	}
+
+	switch head.ServerSideEncryption {
+	case types.ServerSideEncryptionAwsKms, types.ServerSideEncryptionAwsKmsDsse:
+		return "", "", false
+	}
+	if head.SSECustomerAlgorithm != nil {
+		return "", "", false
+	}
+	etag := strings.Trim(aws.ToString(head.ETag), `"`)
+	if digest, err := hex.DecodeString(etag); err != nil || len(digest) != md5.Size {
+		return "", "", false
+	}
+	return "MD5", strings.ToLower(etag), true
+}
+
+// newDigest returns the hash computing algorithm, see expectedDigest.
+func newDigest(algorithm string) hash.Hash {
+	switch types.ChecksumAlgorithm(algorithm) {
+	case types.ChecksumAlgorithmCrc64nvme:
+		// The reversed NVMe polynomial, as crc64.MakeTable expects
+		return crc64.New(crc64.MakeTable(0x9a6c9329ac4bc9b5))
+	case types.ChecksumAlgorithmCrc32c:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case types.ChecksumAlgorithmCrc32:
+		return crc32.NewIEEE()
+	case types.ChecksumAlgorithmSha256:
+		return sha256.New()
+	case types.ChecksumAlgorithmSha1:
+		return sha1.New()
+	}
+	return md5.New()
+}
+
+// verifyDownload checks the file at path against the checksum or ETag of the
+// object described by head, returning an integrityError on mismatch. Objects
+// offering neither for their whole content are not verified.
+func verifyDownload(objectKey string, path string, head *s3.HeadObjectOutput) error {
+	algorithm, expected, ok := expectedDigest(head)
+	if !ok {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("couldn't open file %v to verify: %w", path, err)
+	}
+	defer file.Close()
+
+	digest := newDigest(algorithm)
+	if _, err := io.Copy(digest, file); err != nil {
+		return fmt.Errorf("couldn't read file %v to verify: %w", path, err)
+	}
+	actual := base64.StdEncoding.EncodeToString(digest.Sum(nil))
+	if algorithm == "MD5" {
+		actual = hex.EncodeToString(digest.Sum(nil))
+	}
+	if actual != expected {
+		return &integrityError{objectKey: objectKey, algorithm: algorithm, expected: expected, actual: actual}
+	}
+	return nil
+}
+
+// download writes an object to a local file. optionsJson is an optional JSON
+// object carrying the SSE-C key of an object uploaded with one, a
+// timeoutSeconds overriding the bucket's operation timeout, the versionId of
+// a previous version to download and resumable, which makes a retried
+// download continue where the failed one stopped.
+//
+//export download
+func download(handle C.longlong, objectKey *C.char, destinationPath *C.char, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error downloading object", errInvalidHandle)
+	}
+	return bucket.runDownload(C.GoString(objectKey), C.GoString(destinationPath), C.GoString(optionsJson))
+}
+
+// runDownload implements download and downloadAsync.
+func (b *S3Bucket) runDownload(objectKey string, destinationPath string, optionsJson string) *C.char {
+	options, err := parseDownloadOptions(optionsJson)
+	if err != nil {
+		return errorResult("Error downloading object", err)
+	}
+
+	bucket := b.withTimeout(options.TimeoutSeconds).withBandwidthLimit(options.MaxBytesPerSecond).withHeaders(options.Headers).withRequestPayer(options.RequestPayer)
+	if err := bucket.downloadFile(objectKey, destinationPath, options); err != nil {
+		return errorResult("Error downloading object", bucket.explainRequesterPays(err))
+	}
+	return okResult(nil)
+}
+
+// downloadManyResult is the JSON shape returned by downloadMany.
+type downloadManyResult struct {
+	Downloaded []string    `json:"downloaded"`
+	Errors     []fileError `json:"errors"`
+}
+
+// downloadManyOptions are the optional settings of downloadMany, decoded from
+// its optionsJson argument: the download options applied to every object and
+// the version to download of some of them.
+type downloadManyOptions struct {
+	downloadOptions
+	// VersionIDs maps keys to the version downloaded instead of the latest.
+	VersionIDs map[string]string `json:"versionIds"`
+}
+
+// parseDownloadManyOptions decodes the optionsJson argument of downloadMany.
+func parseDownloadManyOptions(optionsJson string) (downloadManyOptions, error) {
+	var options downloadManyOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	if err := options.checkDownload(); err != nil {
+		return options, err
+	}
+	if options.VersionID != "" {
+		return options, invalidArgument("versionId only applies to a single object, use versionIds")
+	}
+	return options, nil
+}
+
+// downloadMany downloads keysJson[i] to destPathsJson[i] for two JSON arrays of
+// the same length, using a pool of concurrency workers sharing the same client,
+// defaultDirectoryConcurrency when 0 and never more workers than keys.
+// optionsJson is an optional JSON object with the options of download, applied
+// to every object, except for versionId: versionIds maps keys to the version
+// to download.
+//
+//export downloadMany
+func downloadMany(handle C.longlong, keysJson *C.char, destPathsJson *C.char, concurrency C.int, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error downloading objects", errInvalidHandle)
+	}
+	return bucket.runDownloadMany(C.GoString(keysJson), C.GoString(destPathsJson), int(concurrency), C.GoString(optionsJson))
+}
+
+// runDownloadMany implements downloadMany and downloadManyAsync.
+func (b *S3Bucket) runDownloadMany(keysJson string, destPathsJson string, concurrency int, optionsJson string) *C.char {
+	options, err := parseDownloadManyOptions(optionsJson)
+	if err != nil {
+		return errorResult("Error downloading objects", err)
+	}
+	var keys, destinationPaths []string
+	if err := json.Unmarshal([]byte(keysJson), &keys); err != nil {
+		return errorResult("Error downloading objects", invalidArgument("invalid key list: %v", err))
+	}
+	if err := json.Unmarshal([]byte(destPathsJson), &destinationPaths); err != nil {
+		return errorResult("Error downloading objects", invalidArgument("invalid destination path list: %v", err))
+	}
+	if len(keys) != len(destinationPaths) {
+		return errorResult("Error downloading objects", invalidArgument("got %d keys but %d destination paths", len(keys), len(destinationPaths)))
+	}
+	if concurrency < 0 {
+		return errorResult("Error downloading objects", invalidArgument("concurrency must not be negative"))
+	}
+	if concurrency == 0 {
+		concurrency = defaultDirectoryConcurrency
+	}
+	// The bandwidth cap is shared by all the objects
+	bucket := b.withTimeout(options.TimeoutSeconds).withBandwidthLimit(options.MaxBytesPerSecond).withHeaders(options.Headers).withRequestPayer(options.RequestPayer)
+
+	indexes := make(chan int)
+
+	var (
+		mu      sync.Mutex
+		summary = downloadManyResult{Downloaded: []string{}, Errors: []fileError{}}
+		wg      sync.WaitGroup
+	)
+	for range min(concurrency, len(keys)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				objectOptions := options.downloadOptions
+				objectOptions.VersionID = options.VersionIDs[keys[i]]
+				err := bucket.downloadFile(keys[i], destinationPaths[i], objectOptions)
+
+				mu.Lock()
+				if err != nil {
+					logger.Error("Error downloading object", "key", keys[i], "error", describeError(err))
+					summary.Errors = append(summary.Errors, fileError{
+						Path:    destinationPaths[i],
+						Key:     keys[i],
+						Code:    errorCode(err),
+						Message: describeError(err),
+					})
+				} else {
+					summary.Downloaded = append(summary.Downloaded, keys[i])
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range keys {
+		if b.canceled() != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if err := b.canceled(); err != nil {
+		return errorResult("Error downloading objects", err)
+	}
+	return okResult(summary)
+}
+
+// downloadPrefixResult is the JSON shape returned by downloadPrefix.
+type downloadPrefixResult struct {
+	Downloaded int `json:"downloaded"`
+	// Files has the outcome of every object found, in no particular order.
+	Files  []fileResult `json:"files"`
+	Errors []fileError  `json:"errors"`
+}
+
+// downloadPrefixOptions are the optional settings of downloadPrefix, decoded
+// from its optionsJson argument: the download options applied to every object
+// and the size of the worker pool.
+type downloadPrefixOptions struct {
+	downloadOptions
+	Concurrency int `json:"concurrency"`
+}
+
+// parseDownloadPrefixOptions decodes the optionsJson argument of downloadPrefix.
+func parseDownloadPrefixOptions(optionsJson string) (downloadPrefixOptions, error) {
+	var options downloadPrefixOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	if err := options.checkDownload(); err != nil {
+		return options, err
+	}
+	if options.VersionID != "" {
+		return options, invalidArgument("versionId only applies to a single object")
+	}
+	if options.Concurrency < 0 {
+		return options, invalidArgument("concurrency must not be negative")
+	}
+	if options.Concurrency == 0 {
+		options.Concurrency = defaultDirectoryConcurrency
+	}
+	return options, nil
+}
+
+// downloadPrefix downloads every object under keyPrefix into localDir,
+// recreating the folder structure of the keys after the prefix, the
+// counterpart of uploadDirectory. optionsJson is an optional JSON object with
+// the options of download, applied to every object, and the concurrency of
+// the worker pool.
+//
+//export downloadPrefix
+func downloadPrefix(handle C.longlong, keyPrefix *C.char, localDir *C.char, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error downloading prefix", errInvalidHandle)
+	}
+	return bucket.runDownloadPrefix(C.GoString(keyPrefix), C.GoString(localDir), C.GoString(optionsJson))
+}
+
+// runDownloadPrefix implements downloadPrefix and downloadPrefixAsync.
+func (b *S3Bucket) runDownloadPrefix(keyPrefix string, localDir string, optionsJson string) *C.char {
+	options, err := parseDownloadPrefixOptions(optionsJson)
+	if err != nil {
+		return errorResult("Error downloading prefix", err)
+	}
+	// The bandwidth cap is shared by all the objects
+	bucket := b.withTimeout(options.TimeoutSeconds).withBandwidthLimit(options.MaxBytesPerSecond).withHeaders(options.Headers).withRequestPayer(options.RequestPayer)
+
+	keys, err := bucket.listKeys(keyPrefix)
+	if err != nil {
+		return errorResult("Error downloading prefix", bucket.explainRequesterPays(err))
+	}
+
+	type downloadJob struct {
+		key  string
+		path string
+	}
+	jobs := make(chan downloadJob)
+
+	var (
+		mu      sync.Mutex
+		summary = downloadPrefixResult{Files: []fileResult{}, Errors: []fileError{}}
+		wg      sync.WaitGroup
+	)
+	record := func(path string, key string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		file := fileResult{Path: path, Key: key, OK: err == nil}
+		if err != nil {
+			logger.Error("Error downloading object", "key", key, "error", describeError(err))
+			file.Code, file.Message = errorCode(err), describeError(err)
+			summary.Errors = append(summary.Errors, fileError{Path: path, Key: key, Code: file.Code, Message: file.Message})
+		} else {
+			summary.Downloaded++
+		}
+		summary.Files = append(summary.Files, file)
+	}
+	for range options.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				err := os.MkdirAll(filepath.Dir(job.path), 0o755)
+				if err == nil {
+					err = bucket.downloadFile(job.key, job.path, options.downloadOptions)
+				}
+				record(job.path, job.key, err)
+			}
+		}()
+	}
+
+	for _, key := range keys {
+		if b.canceled() != nil {
+			break
+		}
+		path, ok, err := keyPath(localDir, keyPrefix, key)
+		if err != nil {
+			record("", key, err)
+			continue
+		}
+		if ok {
+			jobs <- downloadJob{key: key, path: path}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := b.canceled(); err != nil {
+		return errorResult("Error downloading prefix", err)
+	}
+	return okResult(summary)
+}
+
+// keyPath maps key, listed under keyPrefix, to its path in localDir: the key
+// with the prefix removed. ok is false for folder markers, which have no
+// content, their folder being created with its files. Keys that would resolve
+// outside localDir, like "../x", are rejected.
+func keyPath(localDir string, keyPrefix string, key string) (path string, ok bool, err error) {
+	relativePath := strings.TrimPrefix(strings.TrimPrefix(key, keyPrefix), "/")
+	if relativePath == "" || strings.HasSuffix(relativePath, "/") {
+		return "", false, nil
+	}
+	relativePath = filepath.FromSlash(relativePath)
+	if !filepath.IsLocal(relativePath) {
+		return "", false, invalidArgument("key %v doesn't map to a path inside %v", key, localDir)
+	}
+	return filepath.Join(localDir, relativePath), true, nil
+}
+
+// remoteObject is what a listing tells about an object, enough for sync to
+// compare it with a local file without a request per object.
+type remoteObject struct {
+	key          string
+	size         int64
+	etag         string
+	lastModified time.Time
+	storageClass string
+}
+
+// listObjects returns every object under prefix sorted by key, following
+// continuation tokens.
+func (b *S3Bucket) listObjects(prefix string) ([]remoteObject, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.BucketName),
+	}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+
+	objects := []remoteObject{}
+	paginator := s3.NewListObjectsV2Paginator(b.client, input)
+	for paginator.HasMorePages() {
+		// Each page gets its own timeout so large buckets can still be listed
+		ctx, cancel := b.operationContext()
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range page.Contents {
+			objects = append(objects, remoteObject{
+				key:          aws.ToString(object.Key),
+				size:         aws.ToInt64(object.Size),
+				etag:         aws.ToString(object.ETag),
+				lastModified: aws.ToTime(object.LastModified),
+				storageClass: string(object.StorageClass),
+			})
+		}
+	}
+	return objects, nil
+}
+
+// matchesETag reports whether the file at path has the content of an object
+// with etag, when the ETag is an MD5 digest of the content. Multipart and
+// KMS-encrypted objects have other ETags and never match.
+func matchesETag(path string, etag string) (bool, error) {
+	etag = strings.ToLower(strings.Trim(etag, `"`))
+	if digest, err := hex.DecodeString(etag); err != nil || len(digest) != md5.Size {
+		return false, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("couldn't open file %v: %w", path, err)
+	}
+	defer file.Close()
+
+	digest := md5.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return false, fmt.Errorf("couldn't read file %v: %w", path, err)
+	}
+	return hex.EncodeToString(digest.Sum(nil)) == etag, nil
+}
+
+// Reasons reported by sync for transferring a file.
+const (
+	syncMissing  = "missing"
+	syncSize     = "size"
+	syncModified = "modified"
+)
+
+// syncEntry is one file sync transferred or deleted. Reason tells why a file
+// was transferred: its counterpart was missing, had another size or was
+// modified.
+type syncEntry struct {
+	Path   string `json:"path"`
+	Key    string `json:"key"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// syncResult is the JSON shape returned by syncUp and syncDown. In a dry run,
+// Transferred and Deleted list what would have been without touching anything.
+type syncResult struct {
+	Transferred []syncEntry `json:"transferred"`
+	Deleted     []syncEntry `json:"deleted"`
+	// Skipped counts the files already up to date.
+	Skipped int         `json:"skipped"`
+	Errors  []fileError `json:"errors"`
+	DryRun  bool        `json:"dryRun"`
+}
+
+// syncOptions are the settings shared by syncUp and syncDown: the size of the
+// worker pool, delete to remove what only exists on the destination side and
+// dryRun to only report what would be done.
+type syncOptions struct {
+	Concurrency int  `json:"concurrency"`
+	Delete      bool `json:"delete"`
+	DryRun      bool `json:"dryRun"`
+}
+
+// checkSync validates decoded sync options and fills in the concurrency.
+func (o *syncOptions) checkSync() error {
+	if o.Concurrency < 0 {
+		return invalidArgument("concurrency must not be negative")
+	}
+	if o.Concurrency == 0 {
+		o.Concurrency = defaultDirectoryConcurrency
+	}
+	return nil
+}
+
+// syncUpOptions are the optional settings of syncUp, decoded from its
+// optionsJson argument.
+type syncUpOptions struct {
+	uploadOptions
+	syncOptions
+}
+
+// syncDownOptions are the optional settings of syncDown, decoded from its
+// optionsJson argument.
+type syncDownOptions struct {
+	downloadOptions
+	syncOptions
+}
+
+// parseSyncUpOptions decodes the optionsJson argument of syncUp.
+func parseSyncUpOptions(optionsJson string) (syncUpOptions, error) {
+	var options syncUpOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	if err := options.normalize(); err != nil {
+		return options, err
+	}
+	err := options.checkSync()
+	return options, err
+}
+
+// parseSyncDownOptions decodes the optionsJson argument of syncDown.
+func parseSyncDownOptions(optionsJson string) (syncDownOptions, error) {
+	var options syncDownOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	if err := options.checkDownload(); err != nil {
+		return options, err
+	}
+	if options.VersionID != "" {
+		return options, invalidArgument("versionId only applies to a single object")
+	}
+	err := options.checkSync()
+	return options, err
+}
+
+// transferAll runs transfer on every entry with a pool of concurrency
+// workers, recording each outcome in summary. It stops queueing entries once
+// the operation is canceled.
+func (b *S3Bucket) transferAll(entries []syncEntry, concurrency int, summary *syncResult, transfer func(syncEntry) error) {
+	jobs := make(chan syncEntry)
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				err := transfer(entry)
+
+				mu.Lock()
+				if err != nil {
+					logger.Error("Error syncing", "path", entry.Path, "error", describeError(err))
+					summary.Errors = append(summary.Errors, fileError{
+						Path:    entry.Path,
+						Key:     entry.Key,
+						Code:    errorCode(err),
+						Message: describeError(err),
+					})
+				} else {
+					summary.Transferred = append(summary.Transferred, entry)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, entry := range entries {
+		if b.canceled() != nil {
+			break
+		}
+		jobs <- entry
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// syncUpReason tells why the file at path must be uploaded over remote, or ""
+// when the object is up to date. Sizes are only compared when the object
+// stores the file as is, without client-side encryption or compression. An
+// object written after the file was last modified is up to date; otherwise
+// the file is uploaded unless its MD5 digest matches the ETag.
+func (b *S3Bucket) syncUpReason(path string, local fs.FileInfo, remote remoteObject, found bool) (string, error) {
+	if !found {
+		return syncMissing, nil
+	}
+	verbatim := b.masterKey == nil && b.compression == ""
+	if verbatim && local.Size() != remote.size {
+		return syncSize, nil
+	}
+	if !local.ModTime().After(remote.lastModified) {
+		return "", nil
+	}
+	if verbatim {
+		if same, err := matchesETag(path, remote.etag); err != nil || same {
+			return "", err
+		}
+	}
+	return syncModified, nil
+}
+
+// syncUp uploads the files under localDir that are missing from the bucket or
+// differ from their object, keyed as uploadDirectory keys them. optionsJson is
+// an optional JSON object with the options of upload, applied to every file,
+// the concurrency of the worker pool, delete to also remove the objects under
+// keyPrefix without a local file and dryRun to only report what would change.
+//
+//export syncUp
+func syncUp(handle C.longlong, localDir *C.char, keyPrefix *C.char, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error syncing directory", errInvalidHandle)
+	}
+	return bucket.runSyncUp(C.GoString(localDir), C.GoString(keyPrefix), C.GoString(optionsJson))
+}
+
+// runSyncUp implements syncUp and syncUpAsync.
+func (b *S3Bucket) runSyncUp(localDir string, keyPrefix string, optionsJson string) *C.char {
+	options, err := parseSyncUpOptions(optionsJson)
+	if err != nil {
+		return errorResult("Error syncing directory", err)
+	}
+	bucket := b.withTimeout(options.TimeoutSeconds).withBandwidthLimit(options.MaxBytesPerSecond).withCompression(options.Compression).withHeaders(options.Headers)
+
+	objects, err := bucket.listObjects(keyPrefix)
+	if err != nil {
+		return errorResult("Error syncing directory", err)
+	}
+	remote := make(map[string]remoteObject, len(objects))
+	for _, object := range objects {
+		remote[object.key] = object
+	}
+
+	summary := syncResult{Transferred: []syncEntry{}, Deleted: []syncEntry{}, Errors: []fileError{}, DryRun: options.DryRun}
+	var uploads []syncEntry
+	localKeys := map[string]bool{}
+	walkErr := filepath.WalkDir(localDir, func(path string, entry fs.DirEntry, err error) error {
+		if canceledErr := b.canceled(); canceledErr != nil {
+			return canceledErr
+		}
+		if err != nil {
+			if path == localDir {
+				return err
+			}
+			summary.Errors = append(summary.Errors, fileError{Path: path, Message: err.Error()})
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(localDir, path)
+		if err != nil {
+			return err
+		}
+		key := keyPrefix + filepath.ToSlash(relativePath)
+		localKeys[key] = true
+
+		info, err := entry.Info()
+		if err == nil {
+			object, found := remote[key]
+			var reason string
+			if reason, err = bucket.syncUpReason(path, info, object, found); err == nil {
+				if reason == "" {
+					summary.Skipped++
+				} else {
+					uploads = append(uploads, syncEntry{Path: path, Key: key, Reason: reason})
+				}
+			}
+		}
+		if err != nil {
+			summary.Errors = append(summary.Errors, fileError{Path: path, Key: key, Code: errorCode(err), Message: describeError(err)})
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return errorResult("Error syncing directory", walkErr)
+	}
+
+	if options.DryRun {
+		summary.Transferred = append(summary.Transferred, uploads...)
+	} else {
+		bucket.transferAll(uploads, options.Concurrency, &summary, func(entry syncEntry) error {
+			fileOptions := options.uploadOptions
+			if fileOptions.ContentType == "" {
+				fileOptions.ContentType = mime.TypeByExtension(filepath.Ext(entry.Path))
+			}
+			_, err := bucket.putFile(entry.Path, entry.Key, fileOptions.applyToPut)
+			return err
+		})
+	}
+
+	if options.Delete && b.canceled() == nil {
+		var extraneous []string
+		for _, object := range objects {
+			// Folder markers have no local file to compare with
+			if !localKeys[object.key] && !strings.HasSuffix(object.key, "/") {
+				extraneous = append(extraneous, object.key)
+			}
+		}
+		deleted := extraneous
+		if !options.DryRun {
+			result := bucket.deleteKeys(extraneous)
+			deleted = result.Deleted
+			for _, failed := range result.Errors {
+				summary.Errors = append(summary.Errors, fileError{Key: failed.Key, Code: failed.Code, Message: failed.Message})
+			}
+		}
+		for _, key := range deleted {
+			summary.Deleted = append(summary.Deleted, syncEntry{Key: key})
+		}
+	}
+
+	if err := b.canceled(); err != nil {
+		return errorResult("Error syncing directory", err)
+	}
+	return okResult(summary)
+}
+
+// syncDownReason tells why the object remote must be downloaded over the file
+// at path, or "" when the file is up to date. syncDown gives the files it
+// writes the modification date of their object, so an unchanged date means an
+// unchanged file; otherwise the object is downloaded unless the file has its
+// size and the MD5 digest of the ETag.
+func syncDownReason(path string, local fs.FileInfo, remote remoteObject) (string, error) {
+	if local == nil {
+		return syncMissing, nil
+	}
+	if local.ModTime().Equal(remote.lastModified) {
+		return "", nil
+	}
+	if local.Size() != remote.size {
+		// Client-side encrypted and compressed objects always differ in
+		// size, their date is set once they are downloaded
+		return syncSize, nil
+	}
+	if same, err := matchesETag(path, remote.etag); err != nil {
+		return "", err
+	} else if same {
+		// Record the date so the file isn't hashed again by the next sync
+		return "", os.Chtimes(path, remote.lastModified, remote.lastModified)
+	}
+	return syncModified, nil
+}
+
+// syncDown downloads the objects under keyPrefix that are missing from
+// localDir or differ from their file, laid out as downloadPrefix lays them
+// out. optionsJson is an optional JSON object with the options of download,
+// applied to every object, the concurrency of the worker pool, delete to also
+// remove the files under localDir without an object and dryRun to only
+// report what would change.
+//
+//export syncDown
+func syncDown(handle C.longlong, keyPrefix *C.char, localDir *C.char, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error syncing prefix", errInvalidHandle)
+	}
+	return bucket.runSyncDown(C.GoString(keyPrefix), C.GoString(localDir), C.GoString(optionsJson))
+}
+
+// runSyncDown implements syncDown and syncDownAsync.
+func (b *S3Bucket) runSyncDown(keyPrefix string, localDir string, optionsJson string) *C.char {
+	options, err := parseSyncDownOptions(optionsJson)
+	if err != nil {
+		return errorResult("Error syncing prefix", err)
+	}
+	bucket := b.withTimeout(options.TimeoutSeconds).withBandwidthLimit(options.MaxBytesPerSecond).withHeaders(options.Headers).withRequestPayer(options.RequestPayer)
+
+	objects, err := bucket.listObjects(keyPrefix)
+	if err != nil {
+		return errorResult("Error syncing prefix", bucket.explainRequesterPays(err))
+	}
+
+	summary := syncResult{Transferred: []syncEntry{}, Deleted: []syncEntry{}, Errors: []fileError{}, DryRun: options.DryRun}
+	local := map[string]fs.FileInfo{}
+	walkErr := filepath.WalkDir(localDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == localDir {
+				if errors.Is(err, fs.ErrNotExist) {
+					// Nothing downloaded yet, the directory is created with the files
+					return fs.SkipAll
+				}
+				return err
+			}
+			summary.Errors = append(summary.Errors, fileError{Path: path, Message: err.Error()})
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			summary.Errors = append(summary.Errors, fileError{Path: path, Message: err.Error()})
+			return nil
+		}
+		local[path] = info
+		return nil
+	})
+	if walkErr != nil {
+		return errorResult("Error syncing prefix", walkErr)
+	}
+
+	var downloads []syncEntry
+	remote := map[string]remoteObject{}
+	for _, object := range objects {
+		path, ok, err := keyPath(localDir, keyPrefix, object.key)
+		if err != nil {
+			summary.Errors = append(summary.Errors, fileError{Key: object.key, Code: errorCode(err), Message: describeError(err)})
+			continue
+		}
+		if !ok {
+			continue
+		}
+		remote[path] = object
+
+		reason, err := syncDownReason(path, local[path], object)
+		if err != nil {
+			summary.Errors = append(summary.Errors, fileError{Path: path, Key: object.key, Code: errorCode(err), Message: describeError(err)})
+			continue
+		}
+		if reason == "" {
+			summary.Skipped++
+		} else {
+			downloads = append(downloads, syncEntry{Path: path, Key: object.key, Reason: reason})
+		}
+	}
+
+	if options.DryRun {
+		summary.Transferred = append(summary.Transferred, downloads...)
+	} else {
+		bucket.transferAll(downloads, options.Concurrency, &summary, func(entry syncEntry) error {
+			if err := os.MkdirAll(filepath.Dir(entry.Path), 0o755); err != nil {
+				return err
+			}
+			if err := bucket.downloadFile(entry.Key, entry.Path, options.downloadOptions); err != nil {
+				return err
+			}
+			lastModified := remote[entry.Path].lastModified
+			return os.Chtimes(entry.Path, lastModified, lastModified)
+		})
+	}
+
+	if options.Delete && b.canceled() == nil {
+		for path := range local {
+			if _, found := remote[path]; found {
+				continue
+			}
+			if !options.DryRun {
+				if err := os.Remove(path); err != nil {
+					summary.Errors = append(summary.Errors, fileError{Path: path, Message: err.Error()})
+					continue
+				}
+			}
+			summary.Deleted = append(summary.Deleted, syncEntry{Path: path})
+		}
+	}
+
+	if err := b.canceled(); err != nil {
+		return errorResult("Error syncing prefix", err)
+	}
+	return okResult(summary)
+}
+
+// downloadRange downloads length bytes of an object starting at offset, or
+// everything from offset on when length is 0. An offset of 0 (re)creates the
+// destination file; any other offset appends to it, so an interrupted download
+// resumes by passing the size of the partial file as offset. Both take a long
+// long because C long is 32 bits on Windows. optionsJson is an optional JSON
+// object with the options of statObject and the headers of download.
+//
+//export downloadRange
+func downloadRange(handle C.longlong, objectKey *C.char, destinationPath *C.char, offset C.longlong, length C.longlong, optionsJson *C.char) *C.char {
+	if offset < 0 || length < 0 {
+		return errorResult("Error downloading object", invalidArgument("invalid range: offset %d, length %d", offset, length))
+	}
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange += fmt.Sprintf("%d", offset+length-1)
+	}
+
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error downloading object", errInvalidHandle)
+	}
+
+	options, err := parseObjectReadOptions(C.GoString(optionsJson))
+	if err != nil {
+		return errorResult("Error downloading object", err)
+	}
+
+	bucket = bucket.withTimeout(options.TimeoutSeconds).withHeaders(options.Headers).withRequestPayer(options.RequestPayer)
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket.BucketName),
+		Key:    aws.String(C.GoString(objectKey)),
+		Range:  aws.String(byteRange),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = options.customerKeyValues()
+	input.VersionId = options.versionID()
+	result, err := bucket.client.GetObject(ctx, input)
+	if err != nil {
+		return errorResult("Error downloading object", bucket.explainRequesterPays(err))
+	}
+	defer result.Body.Close()
+
+	if isClientEncrypted(result.Metadata) {
+		return errorResult("Error downloading object", invalidArgument("client-side encrypted objects can only be downloaded whole"))
+	}
+	if _, compressed := isCompressed(result.Metadata); compressed {
+		return errorResult("Error downloading object", invalidArgument("compressed objects can only be downloaded whole"))
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(C.GoString(destinationPath), flags, 0o644)
+	if err != nil {
+		return errorResult("Error opening file", err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, newProgressReader(result.Body, lengthOrUnknown(result.ContentLength)))
+	if err != nil {
+		return errorResult("Error writing file", err)
+	}
+
+	return okResult(nil)
+}
+
+// bytesError returns a bytes_result carrying the error envelope.
+func bytesError(action string, err error) C.bytes_result {
+	return C.bytes_result{error: errorResult(action, err)}
+}
+
+// downloadBytes reads a whole object into memory. On success data points to a
+// C buffer of length bytes (the data may contain NUL bytes) and error is NULL;
+// on failure data is NULL and error holds the JSON error envelope. Either way
+// the result must be released with freeBytesResult. optionsJson takes the
+// same options as that of downloadRange.
+//
+//export downloadBytes
+func downloadBytes(handle C.longlong, objectKey *C.char, optionsJson *C.char) C.bytes_result {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return bytesError("Error downloading object", errInvalidHandle)
+	}
+
+	options, err := parseObjectReadOptions(C.GoString(optionsJson))
+	if err != nil {
+		return bytesError("Error downloading object", err)
+	}
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-)
+	bucket = bucket.withTimeout(options.TimeoutSeconds).withHeaders(options.Headers).withRequestPayer(options.RequestPayer)
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket.BucketName),
+		Key:    aws.String(C.GoString(objectKey)),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = options.customerKeyValues()
+	input.VersionId = options.versionID()
+	result, err := bucket.client.GetObject(ctx, input)
+	if err != nil {
+		return bytesError("Error downloading object", bucket.explainRequesterPays(err))
+	}
+	defer result.Body.Close()
+
+	body, err := bucket.openBody(result)
+	if err != nil {
+		return bytesError("Error downloading object", err)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return bytesError("Error reading object", err)
+	}
+
+	return C.bytes_result{
+		data:   (*C.char)(C.CBytes(data)),
+		length: C.longlong(len(data)),
+	}
+}
+
+// streamChunkSize is the size of the chunks handed to the stream callback.
+const streamChunkSize = 64 * 1024
 
 var (
-	s3Bucket *S3Bucket
-	s3Mu     sync.Mutex
+	chunkCallback   C.chunk_callback
+	chunkCallbackMu sync.Mutex
+
+	// activeStreams maps the id of every running downloadStream to its cancel
+	// function. A sync.Map since the delete export shadows the builtin.
+	activeStreams sync.Map
 )
 
-// S3Bucket holds the S3 client and bucket name.
-type S3Bucket struct {
-	BucketName string
-	client     *s3.Client
+// setStreamCallback registers the function downloadStream hands chunks to.
+// It receives the id of the stream, a pointer valid only for the duration of
+// the call plus the chunk length, and returns non-zero to stop the stream
+// early.
+//
+//export setStreamCallback
+func setStreamCallback(callback C.chunk_callback) {
+	chunkCallbackMu.Lock()
+	defer chunkCallbackMu.Unlock()
+
+	chunkCallback = callback
 }
 
-//export initBucket
-func initBucket(endpoint *C.char, bucketName *C.char, keyId *C.char, secretAccessKey *C.char, sessionToken *C.char, region *C.char, accountId *C.char) {
-	ctx := context.TODO()
+// cancelDownloadStream aborts the downloadStream running under streamID,
+// which then fails with code Canceled. Returns 1 if the stream was running, 0
+// if the id is unknown or the stream already finished.
+//
+//export cancelDownloadStream
+func cancelDownloadStream(streamID C.longlong) C.int {
+	cancel, ok := activeStreams.Load(int64(streamID))
+	if !ok {
+		return 0
+	}
+	cancel.(context.CancelFunc)()
+	return 1
+}
 
-	// Convert C strings to Go strings and trim whitespace
-	endpointStr := C.GoString(endpoint)
-	regionStr := C.GoString(region)
-	accessKeyID := C.GoString(keyId)
-	secretKey := C.GoString(secretAccessKey)
-	sessionTokenStr := C.GoString(sessionToken)
-	accountIDStr := C.GoString(accountId)
+// downloadStream reads an object in fixed-size chunks and hands each one to
+// the stream callback with streamID, without buffering the whole object. A
+// final zero-length call signals the end of the object, unless the callback
+// stopped the stream. streamID is chosen by the caller, greater than 0 and
+// unique among running streams, so it can cancel the stream with
+// cancelDownloadStream while it blocks here. The operation timeout only bounds
+// the wait for the response: a long stream, e.g. audio played as it
+// downloads, isn't cut off partway through. optionsJson takes the same options
+// as that of downloadRange.
+//
+//export downloadStream
+func downloadStream(handle C.longlong, objectKey *C.char, streamID C.longlong, optionsJson *C.char) *C.char {
+	chunkCallbackMu.Lock()
+	callback := chunkCallback
+	chunkCallbackMu.Unlock()
+	if callback == nil {
+		return errorResult("Error streaming object", invalidArgument("no stream callback registered, call setStreamCallback first"))
+	}
+	if streamID <= 0 {
+		return errorResult("Error streaming object", invalidArgument("stream id must be greater than 0"))
+	}
 
-	// Debug logging (remove in production)
-	fmt.Printf("Initializing S3 client:\n")
-	fmt.Printf("  Endpoint: %s\n", endpointStr)
-	fmt.Printf("  Region: %s\n", regionStr)
-	fmt.Printf("  Access Key ID length: %d\n", len(accessKeyID))
-	fmt.Printf("  Secret Key length: %d\n", len(secretKey))
-	fmt.Printf("  Session Token length: %d\n", len(sessionTokenStr))
-	fmt.Printf("  Account ID: %s\n", accountIDStr)
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error streaming object", errInvalidHandle)
+	}
 
-	// Load default config with region
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(regionStr))
+	options, err := parseObjectReadOptions(C.GoString(optionsJson))
 	if err != nil {
-		log.Fatal(err)
+		return errorResult("Error streaming object", err)
 	}
+	bucket = bucket.withTimeout(options.TimeoutSeconds).withHeaders(options.Headers).withRequestPayer(options.RequestPayer)
 
-	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
-		// Set custom endpoint (for Cloudflare R2, MinIO, etc.)
-		if endpointStr != "" {
-			o.BaseEndpoint = aws.String(endpointStr)
-		}
+	parent := bucket.baseContext
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancelCause(parent)
+	defer cancel(nil)
+	if _, running := activeStreams.LoadOrStore(int64(streamID), context.CancelFunc(func() { cancel(context.Canceled) })); running {
+		return errorResult("Error streaming object", invalidArgument("stream %d is already running", streamID))
+	}
+	defer activeStreams.Delete(int64(streamID))
 
-		// Use path-style addressing (required for R2 and some S3-compatible services)
-		o.UsePathStyle = true
+	var responseTimer *time.Timer
+	if bucket.operationTimeout > 0 {
+		responseTimer = time.AfterFunc(bucket.operationTimeout, func() { cancel(context.DeadlineExceeded) })
+	}
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket.BucketName),
+		Key:    aws.String(C.GoString(objectKey)),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = options.customerKeyValues()
+	input.VersionId = options.versionID()
+	result, err := bucket.client.GetObject(ctx, input)
+	if responseTimer != nil {
+		responseTimer.Stop()
+	}
+	if err != nil {
+		if errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+			err = fmt.Errorf("no response within %v: %w", bucket.operationTimeout, context.DeadlineExceeded)
+		}
+		return errorResult("Error streaming object", bucket.explainRequesterPays(err))
+	}
+	// Closed on every path, including when the callback stops early
+	defer result.Body.Close()
 
-		// Set credentials
-		o.Credentials = aws.NewCredentialsCache(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
-			creds := aws.Credentials{
-				AccessKeyID:     accessKeyID,
-				SecretAccessKey: secretKey,
-				Source:          "static",
+	// Client-side encrypted objects are decrypted whole before streaming starts
+	reader, err := bucket.openBody(result)
+	if err != nil {
+		return errorResult("Error streaming object", err)
+	}
+	chunk := make([]byte, streamChunkSize)
+	for {
+		n, err := io.ReadFull(reader, chunk)
+		if n > 0 {
+			if C.invokeChunkCallback(callback, streamID, (*C.char)(unsafe.Pointer(&chunk[0])), C.longlong(n)) != 0 {
+				return okResult(nil)
 			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return errorResult("Error streaming object", err)
+		}
+	}
 
-			// Only set session token if provided
-			if sessionTokenStr != "" {
-				creds.SessionToken = sessionTokenStr
-			}
+	C.invokeChunkCallback(callback, streamID, nil, 0)
+	return okResult(nil)
+}
 
-			// Only set account ID if provided
-			if accountIDStr != "" {
-				creds.AccountID = accountIDStr
-			}
+var (
+	completionCallback   C.completion_callback
+	completionCallbackMu sync.Mutex
+	nextOperationID      atomic.Int64
 
-			return creds, nil
-		}))
+	// activeOperations maps the id of every running async operation to the
+	// cancel function of its context.
+	activeOperations sync.Map
+)
+
+// setCompletionCallback registers the function the async exports deliver
+// their result to. It is called from a Go thread, so Dart must register a
+// NativeCallable.listener.
+//
+//export setCompletionCallback
+func setCompletionCallback(callback C.completion_callback) {
+	completionCallbackMu.Lock()
+	defer completionCallbackMu.Unlock()
+	completionCallback = callback
+}
+
+// startAsync runs an operation on its own goroutine and returns its id at
+// once, which is always greater than 0. The result envelope is handed to the
+// completion callback with the id; the callback owns it and must release it
+// with freeCString. Returns -1 when no completion callback is registered.
+func startAsync(handle C.longlong, action string, run func(*S3Bucket) *C.char) C.longlong {
+	completionCallbackMu.Lock()
+	callback := completionCallback
+	completionCallbackMu.Unlock()
+	if callback == nil {
+		logger.Error(action, "error", "no completion callback registered, call setCompletionCallback first")
+		return -1
+	}
+
+	id := C.longlong(nextOperationID.Add(1))
+	bucket := lookupBucket(handle)
+	parent := context.Background()
+	if bucket != nil {
+		// Derived from the bucket's context so closeBucket cancels it too
+		parent = bucket.baseContext
+	}
+	ctx, cancel := context.WithCancel(parent)
+	activeOperations.Store(id, cancel)
+	go func() {
+		defer cancel()
+
+		var result *C.char
+		if bucket == nil {
+			result = errorResult(action, errInvalidHandle)
+		} else {
+			// The operation runs on a copy of the bucket whose calls all derive
+			// from ctx, so cancelOperation aborts whichever request is in flight
+			operationBucket := *bucket
+			operationBucket.baseContext = ctx
+			result = run(&operationBucket)
+		}
+		activeOperations.Delete(id)
+		C.invokeCompletionCallback(callback, id, result)
+	}()
+	return id
+}
+
+// cancelOperation aborts a running async operation, which then completes
+// with code Canceled. Returns 1 if the operation was running, 0 if the id is
+// unknown or the operation already finished.
+//
+//export cancelOperation
+func cancelOperation(operationID C.longlong) C.int {
+	cancel, ok := activeOperations.Load(operationID)
+	if !ok {
+		return 0
+	}
+	cancel.(context.CancelFunc)()
+	return 1
+}
+
+// The async exports take the arguments of their blocking counterpart and
+// return an operation id, see startAsync. Arguments are copied before
+// returning, so the caller may release them right away.
+
+//export uploadAsync
+func uploadAsync(handle C.longlong, filePath *C.char, objectKey *C.char, optionsJson *C.char) C.longlong {
+	filePathStr, objectKeyStr, optionsJsonStr := C.GoString(filePath), C.GoString(objectKey), C.GoString(optionsJson)
+	return startAsync(handle, "Error uploading object", func(b *S3Bucket) *C.char {
+		return b.runUpload(filePathStr, objectKeyStr, optionsJsonStr)
+	})
+}
+
+//export downloadAsync
+func downloadAsync(handle C.longlong, objectKey *C.char, destinationPath *C.char, optionsJson *C.char) C.longlong {
+	objectKeyStr, destinationPathStr, optionsJsonStr := C.GoString(objectKey), C.GoString(destinationPath), C.GoString(optionsJson)
+	return startAsync(handle, "Error downloading object", func(b *S3Bucket) *C.char {
+		return b.runDownload(objectKeyStr, destinationPathStr, optionsJsonStr)
+	})
+}
+
+//export uploadDirectoryAsync
+func uploadDirectoryAsync(handle C.longlong, localDir *C.char, keyPrefix *C.char, optionsJson *C.char) C.longlong {
+	localDirStr, keyPrefixStr, optionsJsonStr := C.GoString(localDir), C.GoString(keyPrefix), C.GoString(optionsJson)
+	return startAsync(handle, "Error uploading directory", func(b *S3Bucket) *C.char {
+		return b.runUploadDirectory(localDirStr, keyPrefixStr, optionsJsonStr)
+	})
+}
+
+//export downloadPrefixAsync
+func downloadPrefixAsync(handle C.longlong, keyPrefix *C.char, localDir *C.char, optionsJson *C.char) C.longlong {
+	keyPrefixStr, localDirStr, optionsJsonStr := C.GoString(keyPrefix), C.GoString(localDir), C.GoString(optionsJson)
+	return startAsync(handle, "Error downloading prefix", func(b *S3Bucket) *C.char {
+		return b.runDownloadPrefix(keyPrefixStr, localDirStr, optionsJsonStr)
+	})
+}
+
+//export syncUpAsync
+func syncUpAsync(handle C.longlong, localDir *C.char, keyPrefix *C.char, optionsJson *C.char) C.longlong {
+	localDirStr, keyPrefixStr, optionsJsonStr := C.GoString(localDir), C.GoString(keyPrefix), C.GoString(optionsJson)
+	return startAsync(handle, "Error syncing directory", func(b *S3Bucket) *C.char {
+		return b.runSyncUp(localDirStr, keyPrefixStr, optionsJsonStr)
+	})
+}
+
+//export syncDownAsync
+func syncDownAsync(handle C.longlong, keyPrefix *C.char, localDir *C.char, optionsJson *C.char) C.longlong {
+	keyPrefixStr, localDirStr, optionsJsonStr := C.GoString(keyPrefix), C.GoString(localDir), C.GoString(optionsJson)
+	return startAsync(handle, "Error syncing prefix", func(b *S3Bucket) *C.char {
+		return b.runSyncDown(keyPrefixStr, localDirStr, optionsJsonStr)
 	})
+}
+
+//export downloadManyAsync
+func downloadManyAsync(handle C.longlong, keysJson *C.char, destPathsJson *C.char, concurrency C.int, optionsJson *C.char) C.longlong {
+	keysJsonStr, destPathsJsonStr, optionsJsonStr := C.GoString(keysJson), C.GoString(destPathsJson), C.GoString(optionsJson)
+	return startAsync(handle, "Error downloading objects", func(b *S3Bucket) *C.char {
+		return b.runDownloadMany(keysJsonStr, destPathsJsonStr, int(concurrency), optionsJsonStr)
+	})
+}
+
+// freeCString releases a string returned by any export. Every *C.char result
+// is allocated by the Go library and owned by the caller, which must release
+// it exactly once with freeCString after reading it.
+//
+//export freeCString
+func freeCString(ptr *C.char) {
+	C.free(unsafe.Pointer(ptr))
+}
+
+// freeBytesResult releases the buffer and error string of a bytes_result
+// returned by downloadBytes.
+//
+//export freeBytesResult
+func freeBytesResult(result C.bytes_result) {
+	C.free(unsafe.Pointer(result.data))
+	C.free(unsafe.Pointer(result.error))
+}
+
+// S3 limits on object tags.
+const (
+	maxObjectTags     = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// parseTags decodes a JSON object of tag key/values into an S3 tag set,
+// rejecting sets S3 would refuse.
+func parseTags(tagsJson string) ([]types.Tag, error) {
+	var tags map[string]string
+	if err := json.Unmarshal([]byte(tagsJson), &tags); err != nil {
+		return nil, invalidArgument("invalid tags JSON: %v", err)
+	}
+	if len(tags) > maxObjectTags {
+		return nil, invalidArgument("too many tags: %d, S3 allows at most %d per object", len(tags), maxObjectTags)
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-	s3Bucket = &S3Bucket{
-		BucketName: C.GoString(bucketName),
-		client:     client,
+	tagSet := make([]types.Tag, 0, len(tags))
+	for _, key := range keys {
+		value := tags[key]
+		if key == "" || utf8.RuneCountInString(key) > maxTagKeyLength {
+			return nil, invalidArgument("tag key %q must be between 1 and %d characters", key, maxTagKeyLength)
+		}
+		if utf8.RuneCountInString(value) > maxTagValueLength {
+			return nil, invalidArgument("value of tag %q exceeds %d characters", key, maxTagValueLength)
+		}
+		tagSet = append(tagSet, types.Tag{Key: aws.String(key), Value: aws.String(value)})
 	}
-	fmt.Println("S3 Bucket initialized successfully")
+	return tagSet, nil
 }
 
-//export upload
-func upload(filePath *C.char, objectKey *C.char) *C.char {
-	file, err := os.Open(C.GoString(filePath))
+// putObjectTags replaces the tags of an object with the tags in tagsJson, a
+// JSON object of string values. Values are sent in the XML request body, so
+// they need no URL-encoding by the caller.
+//
+//export putObjectTags
+func putObjectTags(handle C.longlong, objectKey *C.char, tagsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error tagging object", errInvalidHandle)
+	}
+
+	tagSet, err := parseTags(C.GoString(tagsJson))
 	if err != nil {
-		log.Printf("Couldn't open file %v to upload. Here's why: %v\n", C.GoString(filePath), err)
-		return C.CString("")
+		return errorResult("Error tagging object", err)
 	}
-	defer file.Close()
 
-	s3Mu.Lock()
-	// Read the contents of the file into a buffer
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, file); err != nil {
-		fmt.Fprintln(os.Stderr, "Error reading file:", err)
-		return C.CString("Error")
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	_, err = bucket.client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(bucket.BucketName),
+		Key:     aws.String(C.GoString(objectKey)),
+		Tagging: &types.Tagging{TagSet: tagSet},
+	})
+	if err != nil {
+		return errorResult("Error tagging object", err)
+	}
+	return okResult(nil)
+}
+
+//export getObjectTags
+func getObjectTags(handle C.longlong, objectKey *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error reading object tags", errInvalidHandle)
 	}
 
-	_, err = s3Bucket.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String(s3Bucket.BucketName),
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	output, err := bucket.client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket.BucketName),
 		Key:    aws.String(C.GoString(objectKey)),
-		Body:   bytes.NewReader(buf.Bytes()),
 	})
 	if err != nil {
-		log.Printf("Couldn't upload file %v to %v:%v. Here's why: %v\n",
-			C.GoString(filePath), s3Bucket.BucketName, C.GoString(objectKey), err)
-		return C.CString("")
+		return errorResult("Error reading object tags", err)
+	}
+
+	tags := map[string]string{}
+	for _, tag := range output.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
 	}
-	defer s3Mu.Unlock()
-	return C.CString(C.GoString(objectKey))
+	return okResult(tags)
 }
 
-//export checkKeyBucketExist
-func checkKeyBucketExist(objectKey *C.char) C.int {
+// deleteObjectTags removes every tag from an object.
+//
+//export deleteObjectTags
+func deleteObjectTags(handle C.longlong, objectKey *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error deleting object tags", errInvalidHandle)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
 
-	s3Mu.Lock()
-	_, err := s3Bucket.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
-		Bucket: aws.String(s3Bucket.BucketName),
+	_, err := bucket.client.DeleteObjectTagging(ctx, &s3.DeleteObjectTaggingInput{
+		Bucket: aws.String(bucket.BucketName),
 		Key:    aws.String(C.GoString(objectKey)),
 	})
-	defer s3Mu.Unlock()
-	if err == nil {
-		// No error means the HeadObject call succeeded, and the object exists.
-		return C.int(1)
+	if err != nil {
+		return errorResult("Error deleting object tags", err)
 	}
-	return C.int(0)
+	return okResult(nil)
 }
 
-//export list
-func list() *C.char {
-	output, err := s3Bucket.client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
-		Bucket: aws.String(s3Bucket.BucketName),
+// multipartUpload is one pending upload returned by listMultipartUploads.
+type multipartUpload struct {
+	Key       string `json:"key"`
+	UploadID  string `json:"uploadId"`
+	Initiated string `json:"initiated,omitempty"`
+}
+
+// pendingMultipartUploads lists every multipart upload that was started but
+// neither completed nor aborted.
+func (b *S3Bucket) pendingMultipartUploads() ([]types.MultipartUpload, error) {
+	var uploads []types.MultipartUpload
+	paginator := s3.NewListMultipartUploadsPaginator(b.client, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(b.BucketName),
+	})
+	for paginator.HasMorePages() {
+		ctx, cancel := b.operationContext()
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, page.Uploads...)
+	}
+	return uploads, nil
+}
+
+func (b *S3Bucket) abortMultipartUpload(objectKey string, uploadID string) error {
+	ctx, cancel := b.operationContext()
+	defer cancel()
+
+	_, err := b.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(b.BucketName),
+		Key:      aws.String(objectKey),
+		UploadId: aws.String(uploadID),
 	})
+	return err
+}
+
+// listMultipartUploads lists incomplete multipart uploads, which keep
+// accruing storage charges until they are completed or aborted.
+//
+//export listMultipartUploads
+func listMultipartUploads(handle C.longlong) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error listing multipart uploads", errInvalidHandle)
+	}
+
+	uploads, err := bucket.pendingMultipartUploads()
 	if err != nil {
-		log.Fatal(err)
+		return errorResult("Error listing multipart uploads", err)
 	}
 
-	var objectKeys []string
-	for _, object := range output.Contents {
-		objectKeys = append(objectKeys, aws.ToString(object.Key))
+	pending := make([]multipartUpload, 0, len(uploads))
+	for _, upload := range uploads {
+		entry := multipartUpload{
+			Key:      aws.ToString(upload.Key),
+			UploadID: aws.ToString(upload.UploadId),
+		}
+		if upload.Initiated != nil {
+			entry.Initiated = upload.Initiated.UTC().Format(time.RFC3339)
+		}
+		pending = append(pending, entry)
+	}
+	return okResult(pending)
+}
+
+//export abortMultipartUpload
+func abortMultipartUpload(handle C.longlong, objectKey *C.char, uploadId *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error aborting multipart upload", errInvalidHandle)
+	}
+
+	if err := bucket.abortMultipartUpload(C.GoString(objectKey), C.GoString(uploadId)); err != nil {
+		return errorResult("Error aborting multipart upload", err)
+	}
+	return okResult(nil)
+}
+
+// abortStaleMultipartResult is the JSON shape returned by abortStaleMultipartUploads.
+type abortStaleMultipartResult struct {
+	Aborted []multipartUpload `json:"aborted"`
+	Errors  []deleteError     `json:"errors"`
+}
+
+// abortStaleMultipartUploads aborts every incomplete multipart upload
+// initiated more than olderThanSeconds ago, for periodic cleanup.
+// olderThanSeconds must be positive, otherwise uploads still running would be
+// aborted too.
+//
+//export abortStaleMultipartUploads
+func abortStaleMultipartUploads(handle C.longlong, olderThanSeconds C.int) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error listing multipart uploads", errInvalidHandle)
+	}
+	if olderThanSeconds <= 0 {
+		return errorResult("Error aborting multipart uploads", invalidArgument("olderThanSeconds must be positive, got %d", olderThanSeconds))
 	}
 
-	jsonResult, err := json.Marshal(objectKeys)
+	uploads, err := bucket.pendingMultipartUploads()
 	if err != nil {
-		log.Fatal(err)
+		return errorResult("Error listing multipart uploads", err)
 	}
 
-	return C.CString(string(jsonResult))
+	cutoff := time.Now().Add(-time.Duration(olderThanSeconds) * time.Second)
+	summary := abortStaleMultipartResult{
+		Aborted: []multipartUpload{},
+		Errors:  []deleteError{},
+	}
+	for _, upload := range uploads {
+		if upload.Initiated == nil || upload.Initiated.After(cutoff) {
+			continue
+		}
+		entry := multipartUpload{
+			Key:       aws.ToString(upload.Key),
+			UploadID:  aws.ToString(upload.UploadId),
+			Initiated: upload.Initiated.UTC().Format(time.RFC3339),
+		}
+		if err := bucket.abortMultipartUpload(entry.Key, entry.UploadID); err != nil {
+			logger.Error("Error aborting multipart upload", "uploadId", entry.UploadID, "key", entry.Key, "error", describeError(err))
+			summary.Errors = append(summary.Errors, deleteError{Key: entry.Key, Code: errorCode(err), Message: describeError(err)})
+			continue
+		}
+		summary.Aborted = append(summary.Aborted, entry)
+	}
+	return okResult(summary)
 }
 
-//export delete
-func delete(objectKey *C.char) *C.char {
-	_, err := s3Bucket.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-		Bucket: aws.String(s3Bucket.BucketName),
-		Key:    aws.String(C.GoString(objectKey)),
-	})
+//export getPresignedUrl
+func getPresignedUrl(handle C.longlong, objectKey *C.char, expirationSeconds int) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error generating presigned URL", errInvalidHandle)
+	}
+
+	request, err := bucket.presign(http.MethodGet, C.GoString(objectKey), time.Duration(expirationSeconds)*time.Second, presignParams{})
 	if err != nil {
-		errMsg := fmt.Sprintf("Error deleting object: %v", err)
-		log.Println(errMsg)
-		return C.CString(errMsg)
+		return errorResult("Error generating presigned URL", err)
 	}
-	return C.CString("")
+
+	return okResult(request.URL)
 }
 
-//export download
-func download(objectKey *C.char, destinationPath *C.char) *C.char {
-	s3Mu.Lock()
-	defer s3Mu.Unlock()
+// getPresignedPutUrl generates a presigned URL letting a client upload
+// directly to objectKey. A non-empty contentType is part of the signature, so
+// the upload must send that exact Content-Type header.
+//
+//export getPresignedPutUrl
+func getPresignedPutUrl(handle C.longlong, objectKey *C.char, expirationSeconds C.int, contentType *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error generating presigned URL", errInvalidHandle)
+	}
 
-	result, err := s3Bucket.client.GetObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: aws.String(s3Bucket.BucketName),
-		Key:    aws.String(C.GoString(objectKey)),
-	})
+	params := presignParams{ContentType: C.GoString(contentType)}
+	request, err := bucket.presign(http.MethodPut, C.GoString(objectKey), time.Duration(expirationSeconds)*time.Second, params)
 	if err != nil {
-		errMsg := fmt.Sprintf("Error downloading object: %v", err)
-		log.Println(errMsg)
-		return C.CString(errMsg)
+		return errorResult("Error generating presigned URL", err)
 	}
-	defer result.Body.Close()
 
-	file, err := os.Create(C.GoString(destinationPath))
+	return okResult(request.URL)
+}
+
+// getPresignedHeadUrl generates a presigned URL letting a client check that
+// objectKey exists, and read its metadata, with an HTTP HEAD.
+//
+//export getPresignedHeadUrl
+func getPresignedHeadUrl(handle C.longlong, objectKey *C.char, expirationSeconds C.int) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error generating presigned URL", errInvalidHandle)
+	}
+
+	request, err := bucket.presign(http.MethodHead, C.GoString(objectKey), time.Duration(expirationSeconds)*time.Second, presignParams{})
 	if err != nil {
-		errMsg := fmt.Sprintf("Error creating file: %v", err)
-		log.Println(errMsg)
-		return C.CString(errMsg)
+		return errorResult("Error generating presigned URL", err)
+	}
+
+	return okResult(request.URL)
+}
+
+// getPresignedDeleteUrl generates a presigned URL letting a client delete
+// objectKey with an HTTP DELETE.
+//
+//export getPresignedDeleteUrl
+func getPresignedDeleteUrl(handle C.longlong, objectKey *C.char, expirationSeconds C.int) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error generating presigned URL", errInvalidHandle)
 	}
-	defer file.Close()
 
-	_, err = io.Copy(file, result.Body)
+	request, err := bucket.presign(http.MethodDelete, C.GoString(objectKey), time.Duration(expirationSeconds)*time.Second, presignParams{})
 	if err != nil {
-		errMsg := fmt.Sprintf("Error writing file: %v", err)
-		log.Println(errMsg)
-		return C.CString(errMsg)
+		return errorResult("Error generating presigned URL", err)
 	}
 
-	return C.CString("")
+	return okResult(request.URL)
 }
 
-//export getPresignedUrl
-func getPresignedUrl(objectKey *C.char, expirationSeconds int) *C.char {
-	presignClient := s3.NewPresignClient(s3Bucket.client)
+// getObjectUrl returns the unsigned URL of objectKey, addressed the way the
+// client sends its requests: virtual-hosted style, or path style when
+// initBucket enabled it or the bucket name can't be a host name. The URL only
+// serves the object if it is publicly readable, e.g. through a bucket policy
+// or a public-read ACL; providers serving public objects from another domain,
+// like R2's r2.dev, need their own base URL.
+//
+//export getObjectUrl
+func getObjectUrl(handle C.longlong, objectKey *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error building object URL", errInvalidHandle)
+	}
 
-	request, err := presignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: aws.String(s3Bucket.BucketName),
-		Key:    aws.String(C.GoString(objectKey)),
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = time.Duration(expirationSeconds) * time.Second
+	// Resolve the endpoint like the SDK does for each request, so the URL
+	// follows its addressing rules across AWS, R2 and MinIO
+	options := bucket.client.Options()
+	resolver := options.EndpointResolverV2
+	if resolver == nil {
+		resolver = s3.NewDefaultEndpointResolverV2()
+	}
+	endpoint, err := resolver.ResolveEndpoint(context.Background(), s3.EndpointParameters{
+		Bucket:         aws.String(bucket.BucketName),
+		Region:         aws.String(options.Region),
+		Endpoint:       options.BaseEndpoint,
+		ForcePathStyle: aws.Bool(options.UsePathStyle),
+		Accelerate:     aws.Bool(options.UseAccelerate),
+		UseFIPS:        aws.Bool(options.EndpointOptions.UseFIPSEndpoint == aws.FIPSEndpointStateEnabled),
+		UseDualStack:   aws.Bool(options.EndpointOptions.UseDualStackEndpoint == aws.DualStackEndpointStateEnabled),
+	})
+	if err != nil {
+		return errorResult("Error building object URL", err)
+	}
+
+	// S3 decodes a "+" in the path of GET requests as a space
+	key := strings.ReplaceAll(escapeKey(C.GoString(objectKey)), "+", "%2B")
+	base := endpoint.URI
+	base.RawQuery = ""
+	return okResult(strings.TrimSuffix(base.String(), "/") + "/" + key)
+}
+
+// presignParams holds the optional overrides accepted by presign.
+type presignParams struct {
+	ResponseContentDisposition string `json:"responseContentDisposition"`
+	ResponseContentType        string `json:"responseContentType"`
+	// ContentType is signed into PUT URLs; the upload must then send the same Content-Type header.
+	ContentType string `json:"contentType"`
+	headerOptions
+}
+
+// errAnonymousPresign is returned when presigning on a bucket of the anonymous
+// credential source, which has no keys to sign with.
+var errAnonymousPresign = invalidArgument("presigned URLs require credentials, the bucket uses the anonymous credentialSource")
+
+// maxPresignExpiration is the longest validity SigV4 allows a presigned URL.
+const maxPresignExpiration = 7 * 24 * time.Hour
+
+// anonymous reports whether the bucket sends unsigned requests. The client
+// replaces aws.AnonymousCredentials with no credentials at all, which no
+// other credential source leaves it with.
+func (b *S3Bucket) anonymous() bool {
+	return b.client.Options().Credentials == nil
+}
+
+// presign generates a presigned URL for method (GET, PUT, DELETE or HEAD) on
+// objectKey, valid for expires, between a second and maxPresignExpiration.
+func (b *S3Bucket) presign(method string, objectKey string, expires time.Duration, params presignParams) (*v4.PresignedHTTPRequest, error) {
+	if b.anonymous() {
+		return nil, errAnonymousPresign
+	}
+	if expires < time.Second || expires > maxPresignExpiration {
+		return nil, invalidArgument("expirationSeconds must be between 1 and %d, got %d", int(maxPresignExpiration.Seconds()), int(expires.Seconds()))
+	}
+	if err := params.checkHeaders(); err != nil {
+		return nil, err
+	}
+	presignClient := s3.NewPresignClient(b.withHeaders(params.Headers).client, func(opts *s3.PresignOptions) {
+		opts.Expires = expires
 	})
 
+	ctx, cancel := b.operationContext()
+	defer cancel()
+
+	switch strings.ToUpper(method) {
+	case http.MethodGet:
+		input := &s3.GetObjectInput{
+			Bucket: aws.String(b.BucketName),
+			Key:    aws.String(objectKey),
+		}
+		if params.ResponseContentDisposition != "" {
+			input.ResponseContentDisposition = aws.String(params.ResponseContentDisposition)
+		}
+		if params.ResponseContentType != "" {
+			input.ResponseContentType = aws.String(params.ResponseContentType)
+		}
+		return presignClient.PresignGetObject(ctx, input)
+	case http.MethodPut:
+		input := &s3.PutObjectInput{
+			Bucket: aws.String(b.BucketName),
+			Key:    aws.String(objectKey),
+		}
+		if params.ContentType != "" {
+			input.ContentType = aws.String(params.ContentType)
+		}
+		return presignClient.PresignPutObject(ctx, input)
+	case http.MethodDelete:
+		return presignClient.PresignDeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(b.BucketName),
+			Key:    aws.String(objectKey),
+		})
+	case http.MethodHead:
+		return presignClient.PresignHeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(b.BucketName),
+			Key:    aws.String(objectKey),
+		})
+	}
+	return nil, invalidArgument("unsupported presign method %q, expected GET, PUT, DELETE or HEAD", method)
+}
+
+// presign generates a presigned URL for any supported method. responseParamsJson
+// may set responseContentDisposition and responseContentType, applied to GET,
+// contentType, applied to PUT, and headers signed into the URL.
+//
+//export presign
+func presign(handle C.longlong, method *C.char, objectKey *C.char, expirationSeconds C.int, responseParamsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error generating presigned URL", errInvalidHandle)
+	}
+
+	var params presignParams
+	if err := decodeOptions(C.GoString(responseParamsJson), &params); err != nil {
+		return errorResult("Error generating presigned URL", err)
+	}
+
+	request, err := bucket.presign(C.GoString(method), C.GoString(objectKey), time.Duration(expirationSeconds)*time.Second, params)
+	if err != nil {
+		return errorResult("Error generating presigned URL", err)
+	}
+
+	return okResult(request.URL)
+}
+
+// presignedPostOptions are the upload restrictions of getPresignedPost,
+// enforced by S3 since they are signed into the policy.
+type presignedPostOptions struct {
+	// MinSize and MaxSize bound the size of the upload in bytes, no bound
+	// when zero.
+	MinSize int64 `json:"minSize"`
+	MaxSize int64 `json:"maxSize"`
+	// ContentType is the exact Content-Type the upload must declare, or
+	// ContentTypePrefix its required prefix, e.g. "image/".
+	ContentType       string `json:"contentType"`
+	ContentTypePrefix string `json:"contentTypePrefix"`
+}
+
+func parsePresignedPostOptions(optionsJson string) (presignedPostOptions, error) {
+	var options presignedPostOptions
+	if err := decodeOptions(optionsJson, &options); err != nil {
+		return options, err
+	}
+	if options.MinSize < 0 || options.MaxSize < 0 {
+		return options, invalidArgument("minSize and maxSize must not be negative")
+	}
+	if options.MaxSize > 0 && options.MinSize > options.MaxSize {
+		return options, invalidArgument("minSize %d is larger than maxSize %d", options.MinSize, options.MaxSize)
+	}
+	if options.ContentType != "" && options.ContentTypePrefix != "" {
+		return options, invalidArgument("contentType can't be combined with contentTypePrefix")
+	}
+	return options, nil
+}
+
+// conditions returns the policy conditions of the options.
+func (o presignedPostOptions) conditions() []any {
+	var conditions []any
+	if o.MinSize > 0 || o.MaxSize > 0 {
+		maxSize := o.MaxSize
+		if maxSize == 0 {
+			maxSize = math.MaxInt64
+		}
+		conditions = append(conditions, []any{"content-length-range", o.MinSize, maxSize})
+	}
+	switch {
+	case o.ContentType != "":
+		conditions = append(conditions, map[string]string{"Content-Type": o.ContentType})
+	case o.ContentTypePrefix != "":
+		conditions = append(conditions, []any{"starts-with", "$Content-Type", o.ContentTypePrefix})
+	}
+	return conditions
+}
+
+// presignedPost is the JSON shape returned by getPresignedPost.
+type presignedPost struct {
+	URL    string            `json:"url"`
+	Fields map[string]string `json:"fields"`
+}
+
+// getPresignedPost generates a presigned POST letting a browser upload
+// directly to objectKey with an HTML form. optionsJson is an optional JSON
+// object of size and content type restrictions, see presignedPostOptions.
+// expirationSeconds of 0 keeps the SDK's 15 minute default, a negative one is
+// rejected.
+//
+//export getPresignedPost
+func getPresignedPost(handle C.longlong, objectKey *C.char, expirationSeconds C.int, optionsJson *C.char) *C.char {
+	bucket := lookupBucket(handle)
+	if bucket == nil {
+		return errorResult("Error generating presigned POST", errInvalidHandle)
+	}
+	if expirationSeconds < 0 {
+		return errorResult("Error generating presigned POST", invalidArgument("expirationSeconds must not be negative, got %d", expirationSeconds))
+	}
+
+	options, err := parsePresignedPostOptions(C.GoString(optionsJson))
 	if err != nil {
-		errMsg := fmt.Sprintf("Error generating presigned URL: %v", err)
-		log.Println(errMsg)
-		return C.CString("")
+		return errorResult("Error generating presigned POST", err)
 	}
 
-	return C.CString(request.URL)
+	if bucket.anonymous() {
+		return errorResult("Error generating presigned POST", errAnonymousPresign)
+	}
+
+	ctx, cancel := bucket.operationContext()
+	defer cancel()
+
+	key := C.GoString(objectKey)
+	request, err := s3.NewPresignClient(bucket.client).PresignPostObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket.BucketName),
+		Key:    aws.String(key),
+	}, func(o *s3.PresignPostOptions) {
+		o.Expires = time.Duration(expirationSeconds) * time.Second
+		o.Conditions = options.conditions()
+	})
+	if err != nil {
+		return errorResult("Error generating presigned POST", err)
+	}
+
+	// An exact content type is a form field like the signed ones, so the form
+	// can send every field as is
+	if options.ContentType != "" {
+		request.Values["Content-Type"] = options.ContentType
+	}
+	return okResult(presignedPost{URL: request.URL, Fields: request.Values})
 }
 
 func main() {
@@ -0,0 +1,640 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// newTestBucket returns a bucket sending its requests to handler. Tests can't
+// use cgo, so they register it with registerBucket to get a handle.
+func newTestBucket(t *testing.T, handler http.Handler) *S3Bucket {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return &S3Bucket{
+		BucketName: "test-bucket",
+		client: s3.New(s3.Options{
+			Region:       "us-east-1",
+			BaseEndpoint: aws.String(server.URL),
+			UsePathStyle: true,
+			Credentials:  staticCredentials("AKIDTEST", "secret", "", ""),
+		}),
+	}
+}
+
+// decodeResult decodes the result envelope returned by an export. The C
+// string is leaked, test files can't call into cgo to release it.
+func decodeResult[T ~int8 | ~uint8](t *testing.T, envelope *T) result {
+	t.Helper()
+	length := 0
+	for *(*byte)(unsafe.Add(unsafe.Pointer(envelope), length)) != 0 {
+		length++
+	}
+	var decoded result
+	if err := json.Unmarshal(unsafe.Slice((*byte)(unsafe.Pointer(envelope)), length), &decoded); err != nil {
+		t.Fatalf("decoding result envelope: %v", err)
+	}
+	return decoded
+}
+
+// withInts calls an export taking a handle and two C ints, whose types test
+// files can't name.
+func withInts[H any, I ~int32, R any](export func(H, I, I) R, handle H, a int, b int) R {
+	return export(handle, I(a), I(b))
+}
+
+// withStrings calls an export taking a handle and two C strings, whose types
+// test files can't name.
+func withStrings[H any, S ~int8 | ~uint8, R any](export func(H, *S, *S) R, handle H, a string, b string) R {
+	return export(handle, cString[S](a), cString[S](b))
+}
+
+// cString returns a NUL-terminated copy of value for an export taking a C
+// string, whose type test files can't name.
+func cString[S ~int8 | ~uint8](value string) *S {
+	buf := make([]S, len(value)+1)
+	for i := range len(value) {
+		buf[i] = S(value[i])
+	}
+	return &buf[0]
+}
+
+// withRange calls downloadRange, whose C string and long long arguments test
+// files can't name.
+func withRange[H any, S ~int8 | ~uint8, L ~int64, R any](export func(H, *S, *S, L, L, *S) R, handle H, objectKey string, destinationPath string, offset int64, length int64, optionsJson string) R {
+	return export(handle, cString[S](objectKey), cString[S](destinationPath), L(offset), L(length), cString[S](optionsJson))
+}
+
+// withPresignedPost calls getPresignedPost, whose C string and int arguments
+// test files can't name.
+func withPresignedPost[H any, S ~int8 | ~uint8, I ~int32, R any](export func(H, *S, I, *S) R, handle H, objectKey string, expirationSeconds int, optionsJson string) R {
+	return export(handle, cString[S](objectKey), I(expirationSeconds), cString[S](optionsJson))
+}
+
+// withMetadata calls uploadWithMetadata, whose C string arguments test files
+// can't name.
+func withMetadata[H any, S ~int8 | ~uint8, R any](export func(H, *S, *S, *S, *S) R, handle H, filePath string, objectKey string, contentType string, metadataJson string) R {
+	return export(handle, cString[S](filePath), cString[S](objectKey), cString[S](contentType), cString[S](metadataJson))
+}
+
+// withBytes calls uploadBytes with the first length bytes of data, whose C
+// string and long long arguments test files can't name.
+func withBytes[H any, S ~int8 | ~uint8, L ~int64, R any](export func(H, *S, L, *S, *S) R, handle H, data []byte, length int64, objectKey string, contentType string) R {
+	var ptr *S
+	if len(data) > 0 {
+		ptr = (*S)(unsafe.Pointer(&data[0]))
+	}
+	return export(handle, ptr, L(length), cString[S](objectKey), cString[S](contentType))
+}
+
+func TestConfigureRetriesAttempts(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		status      int
+		// retryableErrorCodes is the retry option of initBucket
+		retryableErrorCodes []string
+		want                int64
+	}{
+		{name: "zero disables retries", maxAttempts: 0, status: http.StatusServiceUnavailable, want: 1},
+		{name: "one attempt", maxAttempts: 1, status: http.StatusServiceUnavailable, want: 1},
+		{name: "three attempts", maxAttempts: 3, status: http.StatusServiceUnavailable, want: 3},
+		{name: "code not retried", maxAttempts: 3, status: http.StatusConflict, want: 1},
+		{name: "retryable code kept", maxAttempts: 3, status: http.StatusConflict, retryableErrorCodes: []string{"Conflict"}, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int64
+			bucket := newTestBucket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			bucket.retry = retryOptions{RetryableErrorCodes: tt.retryableErrorCodes}
+			handle := registerBucket(bucket)
+			defer closeBucket(handle)
+
+			// A one second backoff cap keeps the retries quick
+			if envelope := decodeResult(t, withInts(configureRetries, handle, tt.maxAttempts, 1)); !envelope.OK {
+				t.Fatalf("configureRetries: %s", envelope.Message)
+			}
+			_, err := lookupBucket(handle).client.HeadBucket(context.Background(), &s3.HeadBucketInput{Bucket: aws.String(bucket.BucketName)})
+			if err == nil {
+				t.Fatalf("HeadBucket succeeded against a server returning %d", tt.status)
+			}
+			if got := attempts.Load(); got != tt.want {
+				t.Errorf("got %d attempts, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveObjectSourceNotDeleted(t *testing.T) {
+	var deleted bool
+	bucket := newTestBucket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+			w.Write([]byte(`<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`))
+		case r.Method == http.MethodDelete:
+			deleted = true
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	handle := registerBucket(bucket)
+	defer closeBucket(handle)
+
+	envelope := decodeResult(t, withStrings(moveObject, handle, "photos/a.jpg", "archive/a.jpg"))
+	if envelope.OK {
+		t.Fatal("moveObject succeeded though the source couldn't be deleted")
+	}
+	if !deleted {
+		t.Fatal("the source delete was never attempted")
+	}
+	if envelope.Code != "SourceNotDeleted" {
+		t.Errorf("got code %q, want SourceNotDeleted", envelope.Code)
+	}
+	for _, want := range []string{"copied to archive/a.jpg", "photos/a.jpg could not be deleted and still exists", "AccessDenied"} {
+		if !strings.Contains(envelope.Message, want) {
+			t.Errorf("message %q doesn't mention %q", envelope.Message, want)
+		}
+	}
+}
+
+func TestIsChecksumNotSupported(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "not implemented", err: &smithy.GenericAPIError{Code: "NotImplemented", Message: "A header you provided implies functionality that is not implemented"}, want: true},
+		{name: "checksum header rejected", err: &smithy.GenericAPIError{Code: "InvalidRequest", Message: "x-amz-checksum-crc32c is not supported"}, want: true},
+		{name: "bad encryption", err: &smithy.GenericAPIError{Code: "InvalidRequest", Message: "The encryption method specified is not supported"}, want: false},
+		{name: "bad storage class", err: &smithy.GenericAPIError{Code: "InvalidStorageClass", Message: "The storage class you specified is not valid"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isChecksumNotSupported(tt.err); got != tt.want {
+				t.Errorf("isChecksumNotSupported(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadManyConcurrency(t *testing.T) {
+	bucket := newTestBucket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	dir := t.TempDir()
+	keys := `["a.txt", "b.txt"]`
+	paths, _ := json.Marshal([]string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")})
+
+	if envelope := decodeResult(t, bucket.runDownloadMany(keys, string(paths), -1, "")); envelope.OK || envelope.Code != "InvalidArgument" {
+		t.Errorf("negative concurrency: got ok %v and code %q, want code InvalidArgument", envelope.OK, envelope.Code)
+	}
+
+	envelope := decodeResult(t, bucket.runDownloadMany(keys, string(paths), 0, ""))
+	if !envelope.OK {
+		t.Fatalf("downloadMany with the default concurrency: %s", envelope.Message)
+	}
+	downloaded, _ := json.Marshal(envelope.Data)
+	if got := string(downloaded); !strings.Contains(got, `"a.txt"`) || !strings.Contains(got, `"b.txt"`) {
+		t.Errorf("got %s, want both keys downloaded", got)
+	}
+}
+
+func TestDownloadManyOptions(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	bucket := newTestBucket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("x-amz-server-side-encryption-customer-key"); got != key {
+			t.Errorf("%s %s: got SSE-C key %q, want %q", r.Method, r.URL.Path, got, key)
+		}
+		want := ""
+		if r.URL.Path == "/test-bucket/b.txt" {
+			want = "v1"
+		}
+		if got := r.URL.Query().Get("versionId"); got != want {
+			t.Errorf("%s %s: got version %q, want %q", r.Method, r.URL.Path, got, want)
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("content"))
+	}))
+	dir := t.TempDir()
+	keys := `["a.txt", "b.txt"]`
+	paths, _ := json.Marshal([]string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")})
+
+	envelope := decodeResult(t, bucket.runDownloadMany(keys, string(paths), 0, `{"sseCustomerKey": "`+key+`", "versionIds": {"b.txt": "v1"}}`))
+	if !envelope.OK {
+		t.Fatalf("downloadMany: %s", envelope.Message)
+	}
+	if data, _ := json.Marshal(envelope.Data); strings.Contains(string(data), `"code"`) {
+		t.Errorf("got errors in %s", data)
+	}
+
+	envelope = decodeResult(t, bucket.runDownloadMany(keys, string(paths), 0, `{"versionId": "v1"}`))
+	if envelope.OK || envelope.Code != "InvalidArgument" {
+		t.Errorf("a single versionId: got ok %v and code %q, want code InvalidArgument", envelope.OK, envelope.Code)
+	}
+}
+
+func TestDownloadRangeOptions(t *testing.T) {
+	customerKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	bucket := newTestBucket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for header, want := range map[string]string{
+			"Range": "bytes=2-5",
+			"X-Amz-Server-Side-Encryption-Customer-Algorithm": "AES256",
+			"X-Amz-Server-Side-Encryption-Customer-Key":       customerKey,
+			"X-Amz-Request-Payer":                             "requester",
+			"X-Trace-Id":                                      "abc",
+		} {
+			if got := r.Header.Get(header); got != want {
+				t.Errorf("got %s %q, want %q", header, got, want)
+			}
+		}
+		if got := r.URL.Query().Get("versionId"); got != "v1" {
+			t.Errorf("got versionId %q, want v1", got)
+		}
+		w.Write([]byte("vers"))
+	}))
+	handle := registerBucket(bucket)
+	defer closeBucket(handle)
+
+	options := `{"sseCustomerKey": "` + customerKey + `", "versionId": "v1", "requestPayer": "requester", "headers": {"X-Trace-Id": "abc"}}`
+	destinationPath := filepath.Join(t.TempDir(), "part")
+	if envelope := decodeResult(t, withRange(downloadRange, handle, "report.txt", destinationPath, 2, 4, options)); !envelope.OK {
+		t.Fatalf("downloadRange: %s", envelope.Message)
+	}
+	if data, err := os.ReadFile(destinationPath); err != nil || string(data) != "vers" {
+		t.Errorf("got %q (%v), want the served range", data, err)
+	}
+}
+
+func TestParseDownloadOptionsCustomerKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	digest := md5.Sum(key)
+	customerKey := base64.StdEncoding.EncodeToString(key)
+	wantMD5 := base64.StdEncoding.EncodeToString(digest[:])
+
+	parsers := map[string]func(string) (downloadOptions, error){
+		"download": parseDownloadOptions,
+		"downloadPrefix": func(optionsJson string) (downloadOptions, error) {
+			options, err := parseDownloadPrefixOptions(optionsJson)
+			return options.downloadOptions, err
+		},
+		"syncDown": func(optionsJson string) (downloadOptions, error) {
+			options, err := parseSyncDownOptions(optionsJson)
+			return options.downloadOptions, err
+		},
+	}
+	for name, parse := range parsers {
+		t.Run(name, func(t *testing.T) {
+			options, err := parse(`{"sseCustomerKey": "` + customerKey + `"}`)
+			if err != nil {
+				t.Fatalf("parsing options: %v", err)
+			}
+			algorithm, _, keyMD5 := options.customerKeyValues()
+			if algorithm == nil || *algorithm != "AES256" {
+				t.Errorf("got algorithm %v, want AES256", aws.ToString(algorithm))
+			}
+			if keyMD5 == nil || *keyMD5 != wantMD5 {
+				t.Errorf("got key MD5 %v, want %s", aws.ToString(keyMD5), wantMD5)
+			}
+		})
+	}
+}
+
+// writeFile creates the file name under dir with content, last modified at
+// modTime.
+func writeFile(t *testing.T, dir string, name string, content string, modTime time.Time) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("writing %v: %v", path, err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("dating %v: %v", path, err)
+	}
+	return path
+}
+
+// helloETag is the ETag of an object holding "hello" uploaded in one part.
+const helloETag = `"5d41402abc4b2a76b9719d911017c592"`
+
+func TestSyncUpReason(t *testing.T) {
+	modTime := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name      string
+		encrypted bool
+		remote    remoteObject
+		found     bool
+		want      string
+	}{
+		{name: "missing", found: false, want: syncMissing},
+		{name: "size differs", found: true, remote: remoteObject{size: 3, lastModified: modTime.Add(time.Hour)}, want: syncSize},
+		{name: "object newer", found: true, remote: remoteObject{size: 5, lastModified: modTime.Add(time.Hour)}, want: ""},
+		{name: "file newer with the same content", found: true, remote: remoteObject{size: 5, etag: helloETag, lastModified: modTime.Add(-time.Hour)}, want: ""},
+		{name: "file newer with other content", found: true, remote: remoteObject{size: 5, etag: `"00000000000000000000000000000000"`, lastModified: modTime.Add(-time.Hour)}, want: syncModified},
+		{name: "file newer than a multipart object", found: true, remote: remoteObject{size: 5, etag: `"5d41402abc4b2a76b9719d911017c592-2"`, lastModified: modTime.Add(-time.Hour)}, want: syncModified},
+		{name: "encrypted object size ignored", encrypted: true, found: true, remote: remoteObject{size: 33, lastModified: modTime.Add(time.Hour)}, want: ""},
+		{name: "encrypted object ETag ignored", encrypted: true, found: true, remote: remoteObject{size: 33, etag: helloETag, lastModified: modTime.Add(-time.Hour)}, want: syncModified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, t.TempDir(), "hello.txt", "hello", modTime)
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bucket := &S3Bucket{}
+			if tt.encrypted {
+				bucket.masterKey = make([]byte, 32)
+			}
+			got, err := bucket.syncUpReason(path, info, tt.remote, tt.found)
+			if err != nil {
+				t.Fatalf("syncUpReason: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got reason %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncDownReason(t *testing.T) {
+	modTime := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	objectTime := modTime.Add(time.Hour)
+	tests := []struct {
+		name    string
+		missing bool
+		remote  remoteObject
+		want    string
+		// wantModTime is the modification date of the file afterwards
+		wantModTime time.Time
+	}{
+		{name: "missing", missing: true, remote: remoteObject{size: 5, lastModified: objectTime}, want: syncMissing},
+		{name: "same date", remote: remoteObject{size: 3, lastModified: modTime}, want: "", wantModTime: modTime},
+		{name: "size differs", remote: remoteObject{size: 3, lastModified: objectTime}, want: syncSize, wantModTime: modTime},
+		{name: "same content dated", remote: remoteObject{size: 5, etag: helloETag, lastModified: objectTime}, want: "", wantModTime: objectTime},
+		{name: "other content", remote: remoteObject{size: 5, etag: `"00000000000000000000000000000000"`, lastModified: objectTime}, want: syncModified, wantModTime: modTime},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "hello.txt")
+			var info fs.FileInfo
+			if !tt.missing {
+				writeFile(t, dir, "hello.txt", "hello", modTime)
+				var err error
+				if info, err = os.Stat(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := syncDownReason(path, info, tt.remote)
+			if err != nil {
+				t.Fatalf("syncDownReason: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got reason %q, want %q", got, tt.want)
+			}
+			if tt.missing {
+				return
+			}
+			if info, err = os.Stat(path); err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(tt.wantModTime) {
+				t.Errorf("file dated %v, want %v", info.ModTime().UTC(), tt.wantModTime)
+			}
+		})
+	}
+}
+
+func TestKeyPath(t *testing.T) {
+	localDir := filepath.Join("backups", "restore")
+	tests := []struct {
+		name      string
+		keyPrefix string
+		key       string
+		wantPath  string
+		wantOK    bool
+		wantErr   bool
+	}{
+		{name: "file", keyPrefix: "photos/", key: "photos/cat.png", wantPath: filepath.Join(localDir, "cat.png"), wantOK: true},
+		{name: "nested file", keyPrefix: "photos/", key: "photos/2024/cat.png", wantPath: filepath.Join(localDir, "2024", "cat.png"), wantOK: true},
+		{name: "prefix without slash", keyPrefix: "photos", key: "photos/cat.png", wantPath: filepath.Join(localDir, "cat.png"), wantOK: true},
+		{name: "no prefix", key: "cat.png", wantPath: filepath.Join(localDir, "cat.png"), wantOK: true},
+		{name: "prefix marker", keyPrefix: "photos/", key: "photos/"},
+		{name: "folder marker", keyPrefix: "photos/", key: "photos/2024/"},
+		{name: "parent", keyPrefix: "photos/", key: "photos/../cat.png", wantErr: true},
+		{name: "parent of the root", key: "../cat.png", wantErr: true},
+		{name: "escaping subfolder", keyPrefix: "photos/", key: "photos/2024/../../../etc/passwd", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, ok, err := keyPath(localDir, tt.keyPrefix, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && errorCode(err) != "InvalidArgument" {
+				t.Errorf("got code %q, want InvalidArgument", errorCode(err))
+			}
+			if path != tt.wantPath || ok != tt.wantOK {
+				t.Errorf("got %q and ok %v, want %q and ok %v", path, ok, tt.wantPath, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRunSyncDownDelete(t *testing.T) {
+	objectTime := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	bucket := newTestBucket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("list-type") == "2" {
+			w.Write([]byte(`<ListBucketResult><Name>test-bucket</Name><Prefix>docs/</Prefix><KeyCount>1</KeyCount><IsTruncated>false</IsTruncated>` +
+				`<Contents><Key>docs/new.txt</Key><Size>5</Size><ETag>&quot;5d41402abc4b2a76b9719d911017c592&quot;</ETag><LastModified>2025-01-02T15:04:05.000Z</LastModified></Contents>` +
+				`</ListBucketResult>`))
+			return
+		}
+		if r.URL.Path != "/test-bucket/docs/new.txt" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", helloETag)
+		http.ServeContent(w, r, "new.txt", objectTime, strings.NewReader("hello"))
+	}))
+	dir := t.TempDir()
+	extraPath := writeFile(t, dir, "extra.txt", "extra", objectTime)
+	newPath := filepath.Join(dir, "new.txt")
+
+	decodeSummary := func(envelope result) syncResult {
+		t.Helper()
+		if !envelope.OK {
+			t.Fatalf("syncDown: %s", envelope.Message)
+		}
+		data, _ := json.Marshal(envelope.Data)
+		var summary syncResult
+		if err := json.Unmarshal(data, &summary); err != nil {
+			t.Fatalf("decoding summary: %v", err)
+		}
+		return summary
+	}
+
+	summary := decodeSummary(decodeResult(t, bucket.runSyncDown("docs/", dir, `{"delete": true, "dryRun": true}`)))
+	if !summary.DryRun || len(summary.Transferred) != 1 || summary.Transferred[0].Path != newPath || summary.Transferred[0].Reason != syncMissing {
+		t.Errorf("dry run reported transfers %+v, want %v as missing", summary.Transferred, newPath)
+	}
+	if len(summary.Deleted) != 1 || summary.Deleted[0].Path != extraPath {
+		t.Errorf("dry run reported deletions %+v, want %v", summary.Deleted, extraPath)
+	}
+	if _, err := os.Stat(extraPath); err != nil {
+		t.Errorf("dry run deleted %v: %v", extraPath, err)
+	}
+	if _, err := os.Stat(newPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("dry run downloaded %v", newPath)
+	}
+
+	summary = decodeSummary(decodeResult(t, bucket.runSyncDown("docs/", dir, `{"delete": true}`)))
+	if len(summary.Errors) != 0 {
+		t.Fatalf("got errors %+v", summary.Errors)
+	}
+	if _, err := os.Stat(extraPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("%v wasn't deleted", extraPath)
+	}
+	info, err := os.Stat(newPath)
+	if err != nil {
+		t.Fatalf("%v wasn't downloaded: %v", newPath, err)
+	}
+	if !info.ModTime().Equal(objectTime) {
+		t.Errorf("%v dated %v, want the object's date %v", newPath, info.ModTime().UTC(), objectTime)
+	}
+
+	// The files now match the bucket, so nothing is transferred again
+	summary = decodeSummary(decodeResult(t, bucket.runSyncDown("docs/", dir, `{"delete": true}`)))
+	if len(summary.Transferred) != 0 || len(summary.Deleted) != 0 || summary.Skipped != 1 {
+		t.Errorf("got %+v, want the file skipped", summary)
+	}
+}
+
+func TestGetPresignedPostExpiration(t *testing.T) {
+	tests := []struct {
+		name              string
+		expirationSeconds int
+		wantCode          string
+	}{
+		{name: "default", expirationSeconds: 0},
+		{name: "an hour", expirationSeconds: 3600},
+		{name: "negative", expirationSeconds: -1, wantCode: "InvalidArgument"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := newTestBucket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			}))
+			handle := registerBucket(bucket)
+			defer closeBucket(handle)
+
+			envelope := decodeResult(t, withPresignedPost(getPresignedPost, handle, "uploads/a.jpg", tt.expirationSeconds, ""))
+			if tt.wantCode != "" {
+				if envelope.OK || envelope.Code != tt.wantCode {
+					t.Errorf("got ok %v and code %q, want code %v", envelope.OK, envelope.Code, tt.wantCode)
+				}
+				return
+			}
+			if !envelope.OK {
+				t.Fatalf("getPresignedPost: %s", envelope.Message)
+			}
+		})
+	}
+}
+
+func TestUploadWithMetadataPrefix(t *testing.T) {
+	var header http.Header
+	bucket := newTestBucket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		header = r.Header.Clone()
+		io.Copy(io.Discard, r.Body)
+	}))
+	handle := registerBucket(bucket)
+	defer closeBucket(handle)
+
+	path := writeFile(t, t.TempDir(), "notes.txt", "hello", time.Now())
+	envelope := decodeResult(t, withMetadata(uploadWithMetadata, handle, path, "docs/notes.txt", "", `{"X-Amz-Meta-Owner": "123", "team": "core"}`))
+	if !envelope.OK {
+		t.Fatalf("uploadWithMetadata: %s", envelope.Message)
+	}
+
+	want := map[string]string{"X-Amz-Meta-Owner": "123", "X-Amz-Meta-Team": "core"}
+	for name, value := range want {
+		if got := header.Get(name); got != value {
+			t.Errorf("got %v %q, want %q", name, got, value)
+		}
+	}
+	if got := header.Get("X-Amz-Meta-X-Amz-Meta-Owner"); got != "" {
+		t.Errorf("the metadata prefix was doubled: %q", got)
+	}
+	if got := header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("got content type %q, want text/plain from the extension", got)
+	}
+}
+
+func TestUploadBytesLength(t *testing.T) {
+	var body []byte
+	bucket := newTestBucket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	handle := registerBucket(bucket)
+	defer closeBucket(handle)
+
+	data := []byte("a\x00b")
+	tests := []struct {
+		name     string
+		data     []byte
+		length   int64
+		wantCode string
+	}{
+		{name: "buffer with NULs", data: data, length: int64(len(data))},
+		{name: "empty", length: 0},
+		{name: "negative length", data: data, length: -1, wantCode: "InvalidArgument"},
+		{name: "length without buffer", length: 3, wantCode: "InvalidArgument"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body = nil
+			envelope := decodeResult(t, withBytes(uploadBytes, handle, tt.data, tt.length, "blob.bin", ""))
+			if tt.wantCode != "" {
+				if envelope.OK || envelope.Code != tt.wantCode {
+					t.Errorf("got ok %v and code %q, want code %v", envelope.OK, envelope.Code, tt.wantCode)
+				}
+				return
+			}
+			if !envelope.OK {
+				t.Fatalf("uploadBytes: %s", envelope.Message)
+			}
+			if !bytes.Equal(body, tt.data[:tt.length]) {
+				t.Errorf("uploaded %q, want %q", body, tt.data[:tt.length])
+			}
+		})
+	}
+}
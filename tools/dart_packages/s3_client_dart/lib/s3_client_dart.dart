@@ -6,6 +6,18 @@
 /// More dartdocs go here.
 library;
 
-export 'src/s3_client_dart_base.dart' show S3Client, S3Exception;
-export 'src/s3_configuration.dart' show S3Configuration;
+export 'src/s3_client_dart_base.dart'
+    show S3Client, S3Exception, S3LogLevel, S3Operation;
+export 'src/s3_configuration.dart'
+    show
+        S3Configuration,
+        S3RetryPolicy,
+        S3AssumeRole,
+        S3WebIdentity,
+        S3Credentials,
+        S3Proxy,
+        S3TlsConfig,
+        S3Tracing;
+export 'src/s3_upload_options.dart' show UploadOptions;
+export 'src/s3_bucket_rules.dart' show S3LifecycleRule, S3CorsRule;
 export 'src/library_downloader.dart' show LibraryDownloader, PlatformInfo;
@@ -0,0 +1,113 @@
+/// A lifecycle rule of a bucket, see `S3Client.setLifecycleRules`
+///
+/// At least one of [expirationDays] and [abortIncompleteUploadsDays] must be
+/// set.
+class S3LifecycleRule {
+  /// Name of the rule, generated by the service when `null`
+  final String? id;
+
+  /// Only the keys starting with it are affected, every key when empty
+  final String prefix;
+
+  /// Whether the rule is applied
+  final bool enabled;
+
+  /// Delete objects this many days after their creation, or add a delete
+  /// marker on versioned buckets
+  final int? expirationDays;
+
+  /// Abort multipart uploads still pending this many days after they were
+  /// started, freeing their parts
+  final int? abortIncompleteUploadsDays;
+
+  const S3LifecycleRule({
+    this.id,
+    this.prefix = '',
+    this.enabled = true,
+    this.expirationDays,
+    this.abortIncompleteUploadsDays,
+  });
+
+  /// Decode a rule returned by the Go library
+  factory S3LifecycleRule.fromJson(Map<String, dynamic> json) {
+    final id = json['id'] as String;
+    return S3LifecycleRule(
+      id: id.isEmpty ? null : id,
+      prefix: json['prefix'] as String,
+      enabled: json['enabled'] as bool,
+      expirationDays: json['expirationDays'] as int?,
+      abortIncompleteUploadsDays: json['abortIncompleteUploadsDays'] as int?,
+    );
+  }
+
+  /// Encode the rule as the JSON object expected by the Go library
+  Map<String, dynamic> toJson() {
+    return {
+      if (id != null) 'id': id,
+      'prefix': prefix,
+      'enabled': enabled,
+      if (expirationDays != null) 'expirationDays': expirationDays,
+      if (abortIncompleteUploadsDays != null)
+        'abortIncompleteUploadsDays': abortIncompleteUploadsDays,
+    };
+  }
+}
+
+/// A CORS rule of a bucket, see `S3Client.setCorsRules`
+class S3CorsRule {
+  /// Optional name of the rule
+  final String? id;
+
+  /// Origins allowed to make cross-origin requests, e.g.
+  /// `https://app.example.com` or `*`
+  final List<String> allowedOrigins;
+
+  /// Methods allowed, among `GET`, `PUT`, `POST`, `DELETE` and `HEAD`
+  final List<String> allowedMethods;
+
+  /// Request headers allowed in preflight requests, e.g. `*`
+  final List<String> allowedHeaders;
+
+  /// Response headers readable by the browser, such as `ETag` for multipart
+  /// uploads
+  final List<String> exposeHeaders;
+
+  /// How long browsers may cache the preflight response
+  final Duration? maxAge;
+
+  const S3CorsRule({
+    this.id,
+    required this.allowedOrigins,
+    required this.allowedMethods,
+    this.allowedHeaders = const [],
+    this.exposeHeaders = const [],
+    this.maxAge,
+  });
+
+  /// Decode a rule returned by the Go library
+  factory S3CorsRule.fromJson(Map<String, dynamic> json) {
+    final maxAgeSeconds = json['maxAgeSeconds'] as int?;
+    return S3CorsRule(
+      id: json['id'] as String?,
+      allowedOrigins: (json['allowedOrigins'] as List<dynamic>).cast<String>(),
+      allowedMethods: (json['allowedMethods'] as List<dynamic>).cast<String>(),
+      allowedHeaders:
+          (json['allowedHeaders'] as List<dynamic>? ?? []).cast<String>(),
+      exposeHeaders:
+          (json['exposeHeaders'] as List<dynamic>? ?? []).cast<String>(),
+      maxAge: maxAgeSeconds == null ? null : Duration(seconds: maxAgeSeconds),
+    );
+  }
+
+  /// Encode the rule as the JSON object expected by the Go library
+  Map<String, dynamic> toJson() {
+    return {
+      if (id != null) 'id': id,
+      'allowedOrigins': allowedOrigins,
+      'allowedMethods': allowedMethods,
+      if (allowedHeaders.isNotEmpty) 'allowedHeaders': allowedHeaders,
+      if (exposeHeaders.isNotEmpty) 'exposeHeaders': exposeHeaders,
+      if (maxAge != null) 'maxAgeSeconds': maxAge!.inSeconds,
+    };
+  }
+}
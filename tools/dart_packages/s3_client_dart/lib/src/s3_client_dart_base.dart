@@ -1,12 +1,56 @@
+import 'dart:async';
 import 'dart:convert';
-import 'package:s3_client_dart/src/s3_configuration.dart' show S3Configuration;
+import 'dart:ffi';
+import 'dart:isolate';
+import 'dart:typed_data';
+import 'package:ffi/ffi.dart' show Utf8;
+import 'package:s3_client_dart/src/s3_bucket_rules.dart'
+    show S3LifecycleRule, S3CorsRule;
+import 'package:s3_client_dart/src/s3_configuration.dart'
+    show S3Configuration, S3Credentials;
+import 'package:s3_client_dart/src/s3_upload_options.dart' show UploadOptions;
 
 import 's3_ffi_bindings.dart';
 
 /// S3 client for interacting with AWS S3 using Go FFI
 class S3Client {
+  /// Default [S3Configuration.appId], kept in sync with `pubspec.yaml`
+  static const String defaultAppId = 's3_client_dart-0.1.5';
+
   final S3FFIBindings _bindings;
-  bool _initialized = false;
+  int? _handle;
+
+  /// [S3Configuration.refreshCredentials] of every client using it, by handle
+  static final Map<int, Future<S3Credentials> Function()> _credentialRefreshers =
+      {};
+
+  /// Listener registered with the Go layer, shared by every client
+  static NativeCallable<CredentialsCallbackNative>? _credentialsCallback;
+
+  /// Log listener registered with [setLogHandler]
+  static NativeCallable<LogCallbackNative>? _logCallback;
+
+  /// Background operations awaiting their result envelope, by id
+  static final Map<int, Completer<String>> _pendingOperations = {};
+
+  /// Listener completing [_pendingOperations], shared by every client
+  static NativeCallable<CompletionCallbackNative>? _completionCallback;
+
+  /// `onProgress` handlers of the transfers running, see [_withProgress]
+  static final List<void Function(int transferred, int total)>
+  _progressHandlers = [];
+
+  /// Listener forwarding progress to [_progressHandlers], shared by every
+  /// client and never closed since transfers keep it once started
+  static NativeCallable<ProgressCallbackNative>? _progressCallback;
+
+  /// Id of the latest [downloadStream], unique within the process
+  static int _lastStreamId = 0;
+
+  /// Completes once the latest [downloadStream] received its first message,
+  /// which proves the Go layer picked up its callback. Streams start one
+  /// after the other so none of them is handed the callback of another.
+  static Future<void> _streamStarted = Future.value();
 
   /// Create S3Client with optional custom library path
   ///
@@ -25,10 +69,65 @@ class S3Client {
   /// Initialize the S3 client with bucket credentials, region, and endpoint
   ///
   /// [configuration] - S3Configuration object containing credentials, region, and endpoint
+  ///
+  /// Throws [S3Exception] if the client can't be configured
   void initialize({
     required S3Configuration configuration,
   }) {
-    _bindings.initBucket(
+    final timeout = configuration.timeout;
+    final retry = configuration.retry;
+    final assumeRole = configuration.assumeRole;
+    final ssoProfile = configuration.ssoProfile;
+    final webIdentity = configuration.webIdentity;
+    final refreshCredentials = configuration.refreshCredentials;
+    final credentialsExpiration = configuration.credentialsExpiration;
+    final partSizeMB = configuration.partSizeMB;
+    final concurrency = configuration.concurrency;
+    final usePathStyle = configuration.usePathStyle;
+    final proxy = configuration.proxy;
+    final tls = configuration.tls;
+    final tracing = configuration.tracing;
+    final options = {
+      if (timeout != null) 'timeoutSeconds': timeout.inSeconds,
+      if (retry != null) 'retry': retry.toJson(),
+      if (refreshCredentials != null) ...{
+        'credentialSource': 'callback',
+        if (credentialsExpiration != null)
+          'credentialsExpiration': credentialsExpiration
+              .toUtc()
+              .toIso8601String(),
+      } else if (webIdentity != null) ...{
+        'credentialSource': 'webIdentity',
+        'webIdentity': webIdentity.toJson(),
+      } else if (ssoProfile != null) ...{
+        'credentialSource': 'sso',
+        'profile': ssoProfile,
+      } else if (configuration.useDefaultCredentials)
+        'credentialSource': 'default'
+      else if (configuration.anonymous)
+        'credentialSource': 'anonymous',
+      if (assumeRole != null) 'assumeRole': assumeRole.toJson(),
+      if (partSizeMB != null) 'partSizeMB': partSizeMB,
+      if (concurrency != null) 'concurrency': concurrency,
+      'addressingStyle': switch (usePathStyle) {
+        null => 'auto',
+        true => 'path',
+        false => 'virtual',
+      },
+      'appId': configuration.appId ?? defaultAppId,
+      if (proxy != null) 'proxy': proxy.toJson(),
+      if (tls != null) 'tls': tls.toJson(),
+      if (configuration.allowInsecure) 'allowInsecure': true,
+      if (configuration.dualStack) 'dualStack': true,
+      if (configuration.accelerate) 'accelerate': true,
+      if (configuration.requesterPays) 'requestPayer': 'requester',
+      if (configuration.provider != null) 'provider': configuration.provider,
+      if (configuration.jurisdiction != null)
+        'jurisdiction': configuration.jurisdiction,
+      if (configuration.enableDiagnostics) 'enableDiagnostics': true,
+      if (tracing != null) 'tracing': tracing.toJson(),
+    };
+    final result = _bindings.initBucket(
       endpoint: configuration.endpoint,
       bucketName: configuration.bucketName,
       accessKeyId: configuration.accessKeyId,
@@ -36,83 +135,1988 @@ class S3Client {
       sessionToken: configuration.sessionToken,
       region: configuration.region,
       accountId: configuration.accountId,
+      usePathStyle: usePathStyle ?? false,
+      insecureSkipVerify: configuration.insecureSkipVerify,
+      optionsJson: options.isEmpty ? '' : jsonEncode(options),
+    );
+    final handle = _decodeResult(result) as int;
+    if (refreshCredentials != null) {
+      _credentialRefreshers[handle] = refreshCredentials;
+      _listenForCredentialRequests();
+    }
+    _handle = handle;
+  }
+
+  /// Register the listener answering credential requests of the Go layer
+  void _listenForCredentialRequests() {
+    if (_credentialsCallback != null) {
+      return;
+    }
+    final bindings = _bindings;
+    final callback = NativeCallable<CredentialsCallbackNative>.listener((
+      int handle,
+      int requestId,
+    ) async {
+      String answer;
+      try {
+        final refresh = _credentialRefreshers[handle];
+        if (refresh == null) {
+          throw StateError('No credentials refresher for bucket $handle');
+        }
+        answer = jsonEncode((await refresh()).toJson());
+      } catch (e) {
+        answer = jsonEncode({'error': e.toString()});
+      }
+      bindings.provideCredentials(requestId, answer);
+    });
+    _bindings.setCredentialsCallback(callback.nativeFunction);
+    _credentialsCallback = callback;
+  }
+
+  /// Replace the credentials, e.g. with a refreshed STS token
+  ///
+  /// [accessKeyId] - New access key ID
+  /// [secretAccessKey] - New secret access key
+  /// [sessionToken] - New session token, empty if not needed
+  ///
+  /// Unlike calling [initialize] again, the client keeps its settings and
+  /// operations already running are not interrupted.
+  void updateCredentials({
+    required String accessKeyId,
+    required String secretAccessKey,
+    String sessionToken = '',
+  }) {
+    final handle = _ensureInitialized();
+    _decodeResult(
+      _bindings.updateCredentials(
+        handle,
+        accessKeyId,
+        secretAccessKey,
+        sessionToken,
+      ),
+    );
+  }
+
+  /// Change the region requests are signed for and sent to
+  ///
+  /// [region] - Region of the bucket, detected with a `HeadBucket` request
+  /// when `null`
+  ///
+  /// For a bucket living in another region than the configured one, without
+  /// calling [initialize] again. Returns the region now used, throws
+  /// [S3Exception] on failure.
+  Future<String> setRegion(String? region) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(_bindings.setBucketRegion(handle, region ?? ''))
+        as String;
+  }
+
+  /// Change the default timeout of every S3 call
+  ///
+  /// [timeout] - Replaces [S3Configuration.timeout] for the calls started
+  /// from now on, `null` removes it
+  ///
+  /// Calls taking their own timeout, e.g. [UploadOptions.timeout], still
+  /// override it. Throws [S3Exception] if [timeout] is negative.
+  void setTimeout(Duration? timeout) {
+    final handle = _ensureInitialized();
+    _decodeResult(
+      _bindings.setOperationTimeout(handle, timeout?.inSeconds ?? 0),
+    );
+  }
+
+  /// Change the automatic retries of the client's S3 calls
+  ///
+  /// [maxAttempts] - Number of attempts including the first; 0 or 1 make a
+  /// single attempt. Unlike `S3RetryPolicy.maxAttempts`, 0 doesn't keep the
+  /// default of 3 attempts
+  /// [maxBackoff] - Maximum delay between two attempts, 20 seconds when
+  /// `null`
+  ///
+  /// Applies to the calls started from now on, e.g. to stop retrying while
+  /// the device is offline. The mode and extra retryable error codes of
+  /// [S3Configuration.retry] are kept. Throws [S3Exception] if an argument is
+  /// negative.
+  void configureRetries(int maxAttempts, {Duration? maxBackoff}) {
+    final handle = _ensureInitialized();
+    _decodeResult(
+      _bindings.configureRetries(
+        handle,
+        maxAttempts,
+        maxBackoff?.inSeconds ?? 0,
+      ),
     );
-    _initialized = true;
+  }
+
+  /// Enable end-to-end (client-side) encryption
+  ///
+  /// [masterKey] - Base64-encoded 256-bit key, `null` to stop encrypting
+  ///
+  /// Uploads are encrypted with AES-256-GCM before leaving the process and
+  /// encrypted objects are decrypted on download, so the provider never sees
+  /// their content. Objects can't be read without the same key.
+  void setClientEncryptionKey(String? masterKey) {
+    final handle = _ensureInitialized();
+    _decodeResult(_bindings.setClientEncryptionKey(handle, masterKey ?? ''));
   }
 
   /// Upload a file to S3
   ///
   /// [filePath] - Local path to the file to upload
   /// [objectKey] - The key (path) for the object in S3
+  /// [options] - Optional headers and user metadata for the object
+  /// [onProgress] - Called with the bytes sent and the file size, at most
+  /// every 100ms; the upload then runs in the background so the isolate
+  /// stays free to receive them
+  ///
+  /// Returns the object key on success, throws [S3Exception] on failure
+  Future<String> upload(
+    String filePath,
+    String objectKey, {
+    UploadOptions? options,
+    void Function(int transferred, int total)? onProgress,
+  }) async {
+    if (onProgress != null) {
+      return _withProgress(
+        onProgress,
+        () => uploadAsync(filePath, objectKey, options: options).result,
+      );
+    }
+    final handle = _ensureInitialized();
+    return _decodeResult(
+          _bindings.upload(handle, filePath, objectKey, options?.toJson() ?? ''),
+        )
+        as String;
+  }
+
+  /// Upload a file to S3 along with a checksum S3 verifies and stores
+  ///
+  /// [filePath] - Local path to the file to upload
+  /// [objectKey] - The key (path) for the object in S3
+  /// [algorithm] - `CRC32C` (the default), `CRC32`, `SHA1`, `SHA256` or
+  /// `CRC64NVME`
+  ///
+  /// S3 rejects a body corrupted in transit. Returns a map with `key`,
+  /// `algorithm`, the base64 `checksum` S3 stored, `checksumType` and
+  /// `checksumSupported`, false when the backend doesn't support checksums.
+  /// Throws [S3Exception] on failure.
+  Future<Map<String, dynamic>> uploadWithChecksum(
+    String filePath,
+    String objectKey, {
+    String algorithm = 'CRC32C',
+  }) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(
+          _bindings.uploadWithChecksum(handle, filePath, objectKey, algorithm),
+        )
+        as Map<String, dynamic>;
+  }
+
+  /// Upload every file under a local directory to S3
+  ///
+  /// [localDir] - Local directory to upload recursively
+  /// [keyPrefix] - Prefix prepended to each file's relative path, with
+  /// forward slashes, to build its key
+  /// [options] - Upload options applied to every file
+  /// [concurrency] - Number of files uploaded at once, 4 when `null`
+  ///
+  /// Returns a map with the `uploaded` count, the outcome of every file in
+  /// `files` (`path`, `key`, `ok` and, on failure, `code` and `message`) and
+  /// the failures alone in `errors`. Throws [S3Exception] if the directory
+  /// can't be read.
+  Future<Map<String, dynamic>> uploadDirectory(
+    String localDir,
+    String keyPrefix, {
+    UploadOptions? options,
+    int? concurrency,
+  }) async {
+    final handle = _ensureInitialized();
+    final directoryOptions = {
+      if (options != null)
+        ...jsonDecode(options.toJson()) as Map<String, dynamic>,
+      if (concurrency != null) 'concurrency': concurrency,
+    };
+    return _decodeResult(
+          _bindings.uploadDirectory(
+            handle,
+            localDir,
+            keyPrefix,
+            directoryOptions.isEmpty ? '' : jsonEncode(directoryOptions),
+          ),
+        )
+        as Map<String, dynamic>;
+  }
+
+  /// Upload an in-memory buffer to S3
+  ///
+  /// [data] - The bytes to upload, e.g. a camera capture or a JSON blob
+  /// [objectKey] - The key (path) for the object in S3
+  /// [contentType] - MIME type stored on the object (empty for the default)
+  ///
+  /// Returns the object key on success, throws [S3Exception] on failure
+  Future<String> uploadBytes(
+    Uint8List data,
+    String objectKey, {
+    String contentType = '',
+  }) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(
+          _bindings.uploadBytes(handle, data, objectKey, contentType),
+        )
+        as String;
+  }
+
+  /// Check whether the bucket the client was initialized with exists
+  ///
+  /// Returns true if the bucket exists, false if S3 reports it missing.
+  /// Throws [S3Exception] if the check itself failed (network, credentials);
+  /// use [bucketStatus] to tell a missing bucket from one the credentials
+  /// can't access.
+  Future<bool> bucketExists() async {
+    final handle = _ensureInitialized();
+    final result = _bindings.bucketExists(handle);
+    if (result < 0) {
+      throw S3Exception('Failed to check whether the bucket exists');
+    }
+    return result == 1;
+  }
+
+  /// Check the bucket the client was initialized with
+  ///
+  /// Returns a map whose `status` is `accessible`, `forbidden` when the
+  /// bucket exists but the credentials are denied access, or `missing`, with
+  /// the bucket's `region` when accessible, so setup screens can tell a
+  /// mistyped bucket name from missing permissions. Throws [S3Exception] when
+  /// the check itself fails, e.g. without network.
+  Future<Map<String, dynamic>> bucketStatus() async {
+    final handle = _ensureInitialized();
+    return _decodeResult(_bindings.bucketStatus(handle))
+        as Map<String, dynamic>;
+  }
+
+  /// Get the summaries of the latest requests, oldest first
+  ///
+  /// Requires [S3Configuration.enableDiagnostics]. Returns a map whose
+  /// `entries` hold the `operation`, `method`, `host`, `path`, query
+  /// parameter names, `statusCode`, `requestId`, `extendedRequestId`,
+  /// `latencyMs` and `error` of each request, retries included, and whose
+  /// `dropped` counts the entries dropped beyond the latest 200.
+  ///
+  /// [clear] - Forget the returned entries
+  Map<String, dynamic> getDiagnostics({bool clear = false}) {
+    final handle = _ensureInitialized();
+    return _decodeResult(_bindings.getDiagnostics(handle, clear))
+        as Map<String, dynamic>;
+  }
+
+  /// Get the traffic of the client since it was initialized or last reset
+  ///
+  /// Returns a map with the `bytesUploaded` and `bytesDownloaded` over the
+  /// wire, retries included, the number of `requests`, of `errors` (failed
+  /// requests and error responses) and the `averageLatencyMs` to the
+  /// response headers, e.g. to show data-usage statistics.
+  ///
+  /// [reset] - Zero the counters once returned
+  Map<String, dynamic> getMetrics({bool reset = false}) {
+    final handle = _ensureInitialized();
+    return _decodeResult(_bindings.getMetrics(handle, reset))
+        as Map<String, dynamic>;
+  }
+
+  /// Create the bucket the client was initialized with
+  ///
+  /// [region] - Region of the bucket, the configured one when `null`
+  /// [acl] - Canned ACL of the bucket, such as `private` or `public-read`
+  ///
+  /// Succeeds if the bucket already exists and is owned by the credentials.
+  /// Throws [S3Exception] on failure, e.g. with code `BucketAlreadyExists`
+  /// when another account owns the name.
+  Future<void> createBucket({String? region, String? acl}) async {
+    final handle = _ensureInitialized();
+    final options = {
+      if (region != null) 'region': region,
+      if (acl != null) 'acl': acl,
+    };
+    _decodeResult(
+      _bindings.createBucket(
+        handle,
+        options.isEmpty ? '' : jsonEncode(options),
+      ),
+    );
+  }
+
+  /// Delete the bucket the client was initialized with
+  ///
+  /// [force] - Empty the bucket first, deleting every object and object
+  /// version and aborting pending multipart uploads
+  ///
+  /// Throws [S3Exception] on failure, with code `BucketNotEmpty` when the
+  /// bucket still holds objects and [force] is `false`.
+  Future<void> deleteBucket({bool force = false}) async {
+    final handle = _ensureInitialized();
+    _decodeResult(
+      _bindings.deleteBucket(handle, force ? jsonEncode({'force': true}) : ''),
+    );
+  }
+
+  /// Enable or suspend versioning of the bucket
+  ///
+  /// [enabled] - `true` to keep previous versions of overwritten and deleted
+  /// objects, `false` to stop creating new versions (existing ones are kept)
+  ///
+  /// Throws [S3Exception] on failure
+  Future<void> setVersioning(bool enabled) async {
+    final handle = _ensureInitialized();
+    _decodeResult(_bindings.setBucketVersioning(handle, enabled));
+  }
+
+  /// Get the versioning status of the bucket
+  ///
+  /// Returns `Enabled`, `Suspended`, or an empty string when versioning was
+  /// never enabled
+  Future<String> getVersioning() async {
+    final handle = _ensureInitialized();
+    return _decodeResult(_bindings.getBucketVersioning(handle)) as String;
+  }
+
+  /// List every version of the objects under a prefix
+  ///
+  /// [prefix] - Only list keys starting with it, every key when empty
+  ///
+  /// Returns a map per version with its `key`, `versionId`, `isLatest`,
+  /// `isDeleteMarker`, `size`, `lastModified`, `etag` and `storageClass`,
+  /// the versions of a key newest first.
+  Future<List<Map<String, dynamic>>> listObjectVersions({
+    String prefix = '',
+  }) async {
+    final handle = _ensureInitialized();
+    final List<dynamic> decoded = _decodeResult(
+      _bindings.listObjectVersions(handle, prefix),
+    );
+    return decoded.cast<Map<String, dynamic>>();
+  }
+
+  /// Place a WORM retention on an object, on a bucket with Object Lock enabled
+  ///
+  /// [objectKey] - The key of the object
+  /// [mode] - `GOVERNANCE`, which users with the
+  /// `s3:BypassGovernanceRetention` permission can lift, or `COMPLIANCE`,
+  /// which nobody can lift before [retainUntil]
+  /// [retainUntil] - Date until which the version can't be overwritten or
+  /// deleted
+  /// [versionId] - Version to retain, the latest one when `null`
+  /// [bypassGovernance] - Allow shortening or removing a `GOVERNANCE`
+  /// retention
+  ///
+  /// Throws [S3Exception] on failure
+  Future<void> setRetention(
+    String objectKey, {
+    required String mode,
+    required DateTime retainUntil,
+    String? versionId,
+    bool bypassGovernance = false,
+  }) async {
+    final handle = _ensureInitialized();
+    final options = {
+      'mode': mode,
+      'retainUntil': retainUntil.toUtc().toIso8601String(),
+      if (versionId != null) 'versionId': versionId,
+      if (bypassGovernance) 'bypassGovernance': true,
+    };
+    _decodeResult(
+      _bindings.setObjectRetention(handle, objectKey, jsonEncode(options)),
+    );
+  }
+
+  /// Get the retention of an object
   ///
-  /// Returns the object key on success, empty string on failure
-  Future<String> upload(String filePath, String objectKey) async {
-    _ensureInitialized();
-    return _bindings.upload(filePath, objectKey);
+  /// [objectKey] - The key of the object
+  /// [versionId] - Version to describe, the latest one when `null`
+  ///
+  /// Returns a map with the `mode` and `retainUntil` date (ISO 8601), empty
+  /// when the object has no retention. Throws [S3Exception] on failure.
+  Future<Map<String, dynamic>> getRetention(
+    String objectKey, {
+    String? versionId,
+  }) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(
+          _bindings.getObjectRetention(handle, objectKey, versionId ?? ''),
+        )
+        as Map<String, dynamic>;
+  }
+
+  /// Place or lift a legal hold on an object, on a bucket with Object Lock
+  /// enabled
+  ///
+  /// [objectKey] - The key of the object
+  /// [enabled] - `true` to prevent deleting the version until the hold is
+  /// lifted, whatever its retention, `false` to lift it
+  /// [versionId] - Version to hold, the latest one when `null`
+  ///
+  /// Throws [S3Exception] on failure
+  Future<void> setLegalHold(
+    String objectKey,
+    bool enabled, {
+    String? versionId,
+  }) async {
+    final handle = _ensureInitialized();
+    _decodeResult(
+      _bindings.setObjectLegalHold(handle, objectKey, enabled, versionId ?? ''),
+    );
+  }
+
+  /// Get whether an object is under a legal hold
+  ///
+  /// [objectKey] - The key of the object
+  /// [versionId] - Version to check, the latest one when `null`
+  ///
+  /// Throws [S3Exception] on failure
+  Future<bool> getLegalHold(String objectKey, {String? versionId}) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(
+          _bindings.getObjectLegalHold(handle, objectKey, versionId ?? ''),
+        )
+        as bool;
+  }
+
+  /// Replace the lifecycle rules of the bucket
+  ///
+  /// [rules] - The new rules, an empty list removing the configuration
+  ///
+  /// Rules set elsewhere with other actions, such as storage class
+  /// transitions, are replaced too. Throws [S3Exception] on failure.
+  Future<void> setLifecycleRules(List<S3LifecycleRule> rules) async {
+    final handle = _ensureInitialized();
+    _decodeResult(
+      _bindings.setBucketLifecycle(
+        handle,
+        jsonEncode([for (final rule in rules) rule.toJson()]),
+      ),
+    );
+  }
+
+  /// Get the lifecycle rules of the bucket
+  ///
+  /// Returns the rules with their prefix, expiration and abort actions, an
+  /// empty list when the bucket has none. Throws [S3Exception] on failure.
+  Future<List<S3LifecycleRule>> getLifecycleRules() async {
+    final handle = _ensureInitialized();
+    final List<dynamic> decoded = _decodeResult(
+      _bindings.getBucketLifecycle(handle),
+    );
+    return [
+      for (final rule in decoded)
+        S3LifecycleRule.fromJson(rule as Map<String, dynamic>),
+    ];
+  }
+
+  /// Replace the CORS rules of the bucket
+  ///
+  /// [rules] - The new rules, an empty list removing the configuration
+  ///
+  /// Browsers need a rule allowing their origin before they can use presigned
+  /// URLs of the bucket. Throws [S3Exception] on failure.
+  Future<void> setCorsRules(List<S3CorsRule> rules) async {
+    final handle = _ensureInitialized();
+    _decodeResult(
+      _bindings.setBucketCors(
+        handle,
+        jsonEncode([for (final rule in rules) rule.toJson()]),
+      ),
+    );
+  }
+
+  /// Get the CORS rules of the bucket
+  ///
+  /// Returns an empty list when the bucket has none. Throws [S3Exception] on
+  /// failure.
+  Future<List<S3CorsRule>> getCorsRules() async {
+    final handle = _ensureInitialized();
+    final List<dynamic> decoded = _decodeResult(
+      _bindings.getBucketCors(handle),
+    );
+    return [
+      for (final rule in decoded)
+        S3CorsRule.fromJson(rule as Map<String, dynamic>),
+    ];
+  }
+
+  /// Replace the bucket policy
+  ///
+  /// [policy] - The IAM policy document, e.g. allowing `s3:GetObject` on
+  /// `arn:aws:s3:::<bucket>/public/*` to everyone
+  ///
+  /// Throws [S3Exception] on failure
+  Future<void> setPolicy(Map<String, dynamic> policy) async {
+    final handle = _ensureInitialized();
+    _decodeResult(_bindings.setBucketPolicy(handle, jsonEncode(policy)));
+  }
+
+  /// Get the bucket policy
+  ///
+  /// Returns the policy document, `null` when the bucket has none. Throws
+  /// [S3Exception] on failure.
+  Future<Map<String, dynamic>?> getPolicy() async {
+    final handle = _ensureInitialized();
+    return _decodeResult(_bindings.getBucketPolicy(handle))
+        as Map<String, dynamic>?;
+  }
+
+  /// Remove the bucket policy, succeeding if it has none
+  ///
+  /// Throws [S3Exception] on failure
+  Future<void> deletePolicy() async {
+    final handle = _ensureInitialized();
+    _decodeResult(_bindings.deleteBucketPolicy(handle));
+  }
+
+  /// Replace the ACL of an object with a canned ACL
+  ///
+  /// [objectKey] - The key of the object
+  /// [acl] - Canned ACL such as `private` or `public-read`
+  ///
+  /// Throws [S3Exception] on failure, with code `NotImplemented` or
+  /// `AccessControlListNotSupported` on backends without ACL support
+  Future<void> setAcl(String objectKey, String acl) async {
+    final handle = _ensureInitialized();
+    _decodeResult(_bindings.setObjectAcl(handle, objectKey, acl));
+  }
+
+  /// Get the ACL of an object
+  ///
+  /// [objectKey] - The key of the object
+  ///
+  /// Returns a map with the canonical ID of the `owner`, the `grants` (each
+  /// with a `grantee`, `granteeType` and `permission`) and `public`, whether
+  /// anonymous users can read the object. Throws [S3Exception] on failure.
+  Future<Map<String, dynamic>> getAcl(String objectKey) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(_bindings.getObjectAcl(handle, objectKey))
+        as Map<String, dynamic>;
+  }
+
+  /// Replace the tags of an object
+  ///
+  /// [objectKey] - The key of the object
+  /// [tags] - The new tags, e.g. `{'status': 'temporary'}` for a lifecycle
+  /// rule to expire; S3 allows at most 10, with keys up to 128 characters
+  /// and values up to 256
+  ///
+  /// Throws [S3Exception] on failure, with code `InvalidArgument` when the
+  /// tags exceed S3's limits
+  Future<void> setTags(String objectKey, Map<String, String> tags) async {
+    final handle = _ensureInitialized();
+    _decodeResult(_bindings.putObjectTags(handle, objectKey, jsonEncode(tags)));
+  }
+
+  /// Get the tags of an object
+  ///
+  /// [objectKey] - The key of the object
+  ///
+  /// Returns the tag keys and values, empty when the object has none. Throws
+  /// [S3Exception] on failure.
+  Future<Map<String, String>> getTags(String objectKey) async {
+    final handle = _ensureInitialized();
+    final Map<String, dynamic> decoded = _decodeResult(
+      _bindings.getObjectTags(handle, objectKey),
+    );
+    return decoded.cast<String, String>();
+  }
+
+  /// Remove every tag from an object
+  ///
+  /// [objectKey] - The key of the object
+  ///
+  /// To remove a single tag, write the remaining ones back with [setTags].
+  /// Throws [S3Exception] on failure.
+  Future<void> deleteTags(String objectKey) async {
+    final handle = _ensureInitialized();
+    _decodeResult(_bindings.deleteObjectTags(handle, objectKey));
+  }
+
+  /// List every bucket visible to the client's credentials
+  ///
+  /// Returns a map per bucket with its `name`, `creationDate` (ISO 8601) and,
+  /// when the service reports it, `region`, e.g. to offer a bucket picker.
+  Future<List<Map<String, dynamic>>> listBuckets() async {
+    final handle = _ensureInitialized();
+    final List<dynamic> decoded = _decodeResult(_bindings.listBuckets(handle));
+    return decoded.cast<Map<String, dynamic>>();
   }
 
   /// List all objects in the bucket
   ///
   /// Returns a list of object keys
   Future<List<String>> listObjects() async {
-    _ensureInitialized();
-    final jsonResult = _bindings.list();
-    if (jsonResult.isEmpty) {
-      return [];
-    }
-    final List<dynamic> decoded = jsonDecode(jsonResult);
+    final handle = _ensureInitialized();
+    final List<dynamic> decoded = _decodeResult(_bindings.list(handle));
+    return decoded.cast<String>();
+  }
+
+  /// List a single page of the bucket's keys
+  ///
+  /// [continuationToken] - The `nextContinuationToken` of the previous page,
+  /// `null` for the first one
+  /// [maxKeys] - Maximum number of keys of the page, 1000 when `null`
+  ///
+  /// Returns a map with the page's `keys` and, when more keys follow, the
+  /// `nextContinuationToken` to pass for the next page, so large buckets can
+  /// be paged through without holding every key. Throws [S3Exception] on
+  /// failure.
+  Future<Map<String, dynamic>> listPage({
+    String? continuationToken,
+    int? maxKeys,
+  }) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(
+          _bindings.listPage(handle, continuationToken ?? '', maxKeys ?? 0),
+        )
+        as Map<String, dynamic>;
+  }
+
+  /// List one "folder" of the bucket
+  ///
+  /// [prefix] - Folder to list, e.g. `photos/2024/`, the root when empty
+  /// [delimiter] - Separator of the key segments, `/` by default; an empty
+  /// one lists every key under [prefix] without grouping
+  ///
+  /// Returns a map with the `keys` directly under [prefix] and the
+  /// subfolders in `commonPrefixes`, enough to render a folder tree one
+  /// level at a time. Throws [S3Exception] on failure.
+  Future<Map<String, dynamic>> listWithPrefix({
+    String prefix = '',
+    String delimiter = '/',
+  }) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(_bindings.listWithPrefix(handle, prefix, delimiter))
+        as Map<String, dynamic>;
+  }
+
+  /// List the objects under a prefix with their metadata
+  ///
+  /// [prefix] - Only list keys starting with it, every key when empty
+  ///
+  /// Returns a map per object with its `key`, `size`, `lastModified` (ISO
+  /// 8601), `etag` and `storageClass`, enough to render a file listing
+  /// without a [statObject] per entry.
+  Future<List<Map<String, dynamic>>> listObjectsDetailed({
+    String prefix = '',
+  }) async {
+    final handle = _ensureInitialized();
+    final List<dynamic> decoded = _decodeResult(
+      _bindings.listDetailed(handle, prefix),
+    );
+    return decoded.cast<Map<String, dynamic>>();
+  }
+
+  /// List the keys matching a glob pattern
+  ///
+  /// [pattern] - Pattern such as `releases/*/manifest.json`: `*` matches
+  /// within a single path segment, `?` one character, `[...]` a class and a
+  /// `**` segment any number of segments
+  ///
+  /// The keys are filtered natively, so only the matches cross into Dart.
+  /// Throws [S3Exception] with code `InvalidArgument` for a malformed pattern.
+  Future<List<String>> listGlob(String pattern) async {
+    final handle = _ensureInitialized();
+    final List<dynamic> decoded = _decodeResult(
+      _bindings.listGlob(handle, pattern),
+    );
     return decoded.cast<String>();
   }
 
   /// Delete an object from S3
   ///
   /// [objectKey] - The key of the object to delete
+  /// [versionId] - Version to delete permanently on a versioned bucket; when
+  /// `null` a versioned bucket only gets a delete marker
   ///
-  /// Returns empty string on success, error message on failure
-  Future<String> deleteObject(String objectKey) async {
-    _ensureInitialized();
-    return _bindings.delete(objectKey);
+  /// Returns empty string on success, throws [S3Exception] on failure
+  Future<String> deleteObject(String objectKey, {String? versionId}) async {
+    final handle = _ensureInitialized();
+    _decodeResult(
+      versionId == null
+          ? _bindings.delete(handle, objectKey)
+          : _bindings.deleteObjectVersion(handle, objectKey, versionId),
+    );
+    return '';
+  }
+
+  /// Delete several objects at once
+  ///
+  /// [objectKeys] - The keys of the objects to delete
+  ///
+  /// The keys are deleted with one request per 1000 keys instead of one per
+  /// object. Returns a map with the `deleted` keys and the failures in
+  /// `errors` (`key`, `code` and `message`), since S3 can delete part of a
+  /// batch; the keys of a batch that couldn't be sent are all in `errors`.
+  Future<Map<String, dynamic>> deleteObjects(List<String> objectKeys) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(_bindings.deleteMany(handle, jsonEncode(objectKeys)))
+        as Map<String, dynamic>;
+  }
+
+  /// Delete every object under a prefix, e.g. a user's folder
+  ///
+  /// [prefix] - Prefix of the keys to delete, which must not be empty so a
+  /// missing argument can't wipe the whole bucket
+  /// [dryRun] - Only report the keys that would be deleted
+  ///
+  /// Returns the same map as [deleteObjects]; with [dryRun], `deleted` holds
+  /// the keys that would be deleted and `errors` is empty. Throws
+  /// [S3Exception] if the prefix can't be listed, with code
+  /// `InvalidArgument` for an empty [prefix].
+  Future<Map<String, dynamic>> deletePrefix(
+    String prefix, {
+    bool dryRun = false,
+  }) async {
+    final handle = _ensureInitialized();
+    final decoded = _decodeResult(
+      _bindings.deletePrefix(handle, prefix, dryRun),
+    );
+    if (dryRun) {
+      return {'deleted': decoded, 'errors': <dynamic>[]};
+    }
+    return decoded as Map<String, dynamic>;
+  }
+
+  /// Undo the deletion of an object on a versioned bucket
+  ///
+  /// [objectKey] - The key of the deleted object
+  ///
+  /// Removes the object's latest delete marker, so the version underneath it
+  /// becomes current again. Throws [S3Exception] on failure, with code
+  /// `NoDeleteMarker` if the object isn't deleted.
+  Future<void> restoreDeleted(String objectKey) async {
+    final handle = _ensureInitialized();
+    _decodeResult(_bindings.restoreDeleted(handle, objectKey));
+  }
+
+  /// Copy an object to another key of the bucket
+  ///
+  /// [sourceKey] - The key of the object to copy
+  /// [destKey] - The key of the copy, overwritten if it already exists
+  /// [storageClass] - Storage class of the copy, the source's when `null`;
+  /// with it [destKey] may equal [sourceKey] to change the class in place
+  /// [serverSideEncryption] - `AES256` (SSE-S3) or `aws:kms` (SSE-KMS) to
+  /// re-encrypt the copy
+  /// [sseKmsKeyId] - KMS key used with `aws:kms`, the AWS managed key when
+  /// `null`
+  /// [timeout] - Timeout of the copy, overriding the configured default
+  ///
+  /// The object is copied server-side, without going through the device.
+  /// Throws [S3Exception] on failure.
+  Future<void> copyObject(
+    String sourceKey,
+    String destKey, {
+    String? storageClass,
+    String? serverSideEncryption,
+    String? sseKmsKeyId,
+    Duration? timeout,
+  }) async {
+    final handle = _ensureInitialized();
+    final options = {
+      if (storageClass != null) 'storageClass': storageClass,
+      if (serverSideEncryption != null)
+        'serverSideEncryption': serverSideEncryption,
+      if (sseKmsKeyId != null) 'sseKmsKeyId': sseKmsKeyId,
+      if (timeout != null) 'timeoutSeconds': timeout.inSeconds,
+    };
+    _decodeResult(
+      _bindings.copyObject(
+        handle,
+        sourceKey,
+        destKey,
+        options.isEmpty ? '' : jsonEncode(options),
+      ),
+    );
+  }
+
+  /// Move (rename) an object within the bucket
+  ///
+  /// [sourceKey] - The key of the object to move
+  /// [destKey] - The new key of the object, overwritten if it already exists
+  ///
+  /// The object is copied server-side and the source deleted only once the
+  /// copy succeeded. Throws [S3Exception] on failure; a code of
+  /// `SourceNotDeleted` means the object now exists under both keys.
+  Future<void> moveObject(String sourceKey, String destKey) async {
+    final handle = _ensureInitialized();
+    _decodeResult(_bindings.moveObject(handle, sourceKey, destKey));
+  }
+
+  /// Copy every object under a prefix to another prefix of the bucket
+  ///
+  /// [srcPrefix] - Prefix of the keys to copy, e.g. `staging/`
+  /// [dstPrefix] - Prefix replacing [srcPrefix] in the copies' keys, e.g.
+  /// `release/`
+  /// [storageClass] - Storage class of the copies, the source's when `null`
+  /// [concurrency] - Number of objects copied at once, 4 when `null`
+  ///
+  /// The objects are copied server-side, without going through the device.
+  /// Returns a map with the keys of the copies in `copied` and the failures
+  /// in `errors` (`sourceKey`, `destKey`, `code` and `message`).
+  Future<Map<String, dynamic>> copyPrefix(
+    String srcPrefix,
+    String dstPrefix, {
+    String? storageClass,
+    int? concurrency,
+  }) async {
+    final handle = _ensureInitialized();
+    final options = {
+      if (storageClass != null) 'storageClass': storageClass,
+      if (concurrency != null) 'concurrency': concurrency,
+    };
+    return _decodeResult(
+          _bindings.copyPrefix(
+            handle,
+            srcPrefix,
+            dstPrefix,
+            options.isEmpty ? '' : jsonEncode(options),
+          ),
+        )
+        as Map<String, dynamic>;
+  }
+
+  /// Copy the objects of this client's bucket into the bucket of
+  /// [destination], e.g. to migrate from S3 to R2
+  ///
+  /// [destination] - Initialized client of the destination bucket
+  /// [prefix] - Only mirror the keys starting with it, every key when empty
+  /// [concurrency] - Number of objects copied at once, 4 when `null`
+  /// [delete] - Also delete the destination's objects under [prefix] missing
+  /// from this bucket
+  /// [dryRun] - Only report what would be copied and deleted
+  ///
+  /// Objects are copied server-side when both buckets are on the same
+  /// service, and streamed through the device otherwise. Up to date copies
+  /// are skipped, so calling [mirrorTo] again after a failure resumes the
+  /// mirror. Returns a map with the `transferred` and `deleted` keys, the
+  /// number of `skipped` objects and the failures in `errors`.
+  Future<Map<String, dynamic>> mirrorTo(
+    S3Client destination, {
+    String prefix = '',
+    int? concurrency,
+    bool delete = false,
+    bool dryRun = false,
+  }) async {
+    final handle = _ensureInitialized();
+    final options = {
+      if (concurrency != null) 'concurrency': concurrency,
+      if (delete) 'delete': true,
+      if (dryRun) 'dryRun': true,
+    };
+    return _decodeResult(
+          _bindings.mirrorBucket(
+            handle,
+            destination._ensureInitialized(),
+            prefix,
+            options.isEmpty ? '' : jsonEncode(options),
+          ),
+        )
+        as Map<String, dynamic>;
   }
 
   /// Download an object from S3 to a local file
   ///
   /// [objectKey] - The key of the object to download
   /// [destinationPath] - Local path where the file will be saved
+  /// [sseCustomerKey] - Base64 SSE-C key the object was uploaded with, if any
+  /// [resumable] - Download to `<destinationPath>.part`, renamed once
+  /// complete, so calling [download] again after a failure only fetches the
+  /// missing bytes
+  /// [maxBytesPerSecond] - Bandwidth cap of the download, on top of the one
+  /// set with [setBandwidthLimit]
+  /// [versionId] - Version to download on a versioned bucket, the latest one
+  /// when `null`
+  /// [headers] - Extra HTTP headers sent with every request of the download
+  /// [requesterPays] - Accept the charges of a requester pays bucket
+  /// [onProgress] - Called with the bytes received and the object size, -1
+  /// when unknown, at most every 100ms; the download then runs in the
+  /// background so the isolate stays free to receive them
+  ///
+  /// Returns empty string on success, throws [S3Exception] on failure
+  Future<String> download(
+    String objectKey,
+    String destinationPath, {
+    String? sseCustomerKey,
+    bool resumable = false,
+    int? maxBytesPerSecond,
+    String? versionId,
+    Map<String, String>? headers,
+    bool requesterPays = false,
+    void Function(int transferred, int total)? onProgress,
+  }) async {
+    if (onProgress != null) {
+      await _withProgress(
+        onProgress,
+        () => downloadAsync(
+          objectKey,
+          destinationPath,
+          sseCustomerKey: sseCustomerKey,
+          resumable: resumable,
+          maxBytesPerSecond: maxBytesPerSecond,
+          versionId: versionId,
+          headers: headers,
+          requesterPays: requesterPays,
+        ).result,
+      );
+      return '';
+    }
+    final handle = _ensureInitialized();
+    final options = {
+      if (sseCustomerKey != null) 'sseCustomerKey': sseCustomerKey,
+      if (resumable) 'resumable': true,
+      if (maxBytesPerSecond != null) 'maxBytesPerSecond': maxBytesPerSecond,
+      if (versionId != null) 'versionId': versionId,
+      if (headers != null && headers.isNotEmpty) 'headers': headers,
+      if (requesterPays) 'requestPayer': 'requester',
+    };
+    _decodeResult(
+      _bindings.download(
+        handle,
+        objectKey,
+        destinationPath,
+        options.isEmpty ? '' : jsonEncode(options),
+      ),
+    );
+    return '';
+  }
+
+  /// Download a byte range of an object to a local file
+  ///
+  /// [objectKey] - The key of the object to download
+  /// [destinationPath] - Local path where the range will be saved
+  /// [offset] - Position of the first byte to download
+  /// [length] - Number of bytes to download, everything from [offset] on
+  /// when `null`
+  /// [sseCustomerKey], [versionId], [headers], [requesterPays] - As for
+  /// [download]
+  ///
+  /// An [offset] of 0 (re)creates the file and any other appends to it, so
+  /// passing the size of a partial file resumes its download; a media player
+  /// can also fetch just the part it seeks to. Throws [S3Exception] on
+  /// failure, with code `InvalidRange` when [offset] is past the end.
+  Future<void> downloadRange(
+    String objectKey,
+    String destinationPath, {
+    int offset = 0,
+    int? length,
+    String? sseCustomerKey,
+    String? versionId,
+    Map<String, String>? headers,
+    bool requesterPays = false,
+  }) async {
+    final handle = _ensureInitialized();
+    final options = {
+      if (sseCustomerKey != null) 'sseCustomerKey': sseCustomerKey,
+      if (versionId != null) 'versionId': versionId,
+      if (headers != null && headers.isNotEmpty) 'headers': headers,
+      if (requesterPays) 'requestPayer': 'requester',
+    };
+    _decodeResult(
+      _bindings.downloadRange(
+        handle,
+        objectKey,
+        destinationPath,
+        offset,
+        length ?? 0,
+        options.isEmpty ? '' : jsonEncode(options),
+      ),
+    );
+  }
+
+  /// Download several objects at once
+  ///
+  /// [destinationPaths] - Local path each object is saved to, by key, e.g.
+  /// to restore a gallery
+  /// [concurrency] - Number of objects downloaded at once, 4 when `null`
+  /// [sseCustomerKey], [resumable], [maxBytesPerSecond], [headers],
+  /// [requesterPays] - Applied to every object as for [download]; the
+  /// bandwidth cap is shared by all of them
+  /// [versionIds] - Version to download instead of the latest, by key
+  ///
+  /// Returns a map with the `downloaded` keys and the failures in `errors`
+  /// (`path`, `key`, `code` and `message`). Throws [S3Exception] on invalid
+  /// arguments, such as a negative [concurrency].
+  Future<Map<String, dynamic>> downloadMany(
+    Map<String, String> destinationPaths, {
+    int? concurrency,
+    String? sseCustomerKey,
+    bool resumable = false,
+    int? maxBytesPerSecond,
+    Map<String, String>? versionIds,
+    Map<String, String>? headers,
+    bool requesterPays = false,
+  }) async {
+    final handle = _ensureInitialized();
+    final options = {
+      if (sseCustomerKey != null) 'sseCustomerKey': sseCustomerKey,
+      if (resumable) 'resumable': true,
+      if (maxBytesPerSecond != null) 'maxBytesPerSecond': maxBytesPerSecond,
+      if (versionIds != null && versionIds.isNotEmpty) 'versionIds': versionIds,
+      if (headers != null && headers.isNotEmpty) 'headers': headers,
+      if (requesterPays) 'requestPayer': 'requester',
+    };
+    return _decodeResult(
+          _bindings.downloadMany(
+            handle,
+            jsonEncode(destinationPaths.keys.toList()),
+            jsonEncode(destinationPaths.values.toList()),
+            concurrency ?? 0,
+            options.isEmpty ? '' : jsonEncode(options),
+          ),
+        )
+        as Map<String, dynamic>;
+  }
+
+  /// Download every object under a key prefix into a local directory
+  ///
+  /// [keyPrefix] - Prefix of the keys to download
+  /// [localDir] - Directory each object is saved to, under its key with the
+  /// prefix removed; missing folders are created
+  /// [sseCustomerKey], [resumable], [maxBytesPerSecond] - Applied to every
+  /// object as for [download]; the bandwidth cap is shared by all of them
+  /// [concurrency] - Number of objects downloaded at once, 4 when `null`
+  ///
+  /// Returns a map with the `downloaded` count, the outcome of every object
+  /// in `files` (`path`, `key`, `ok` and, on failure, `code` and `message`)
+  /// and the failures alone in `errors`. Throws [S3Exception] if the prefix
+  /// can't be listed.
+  Future<Map<String, dynamic>> downloadPrefix(
+    String keyPrefix,
+    String localDir, {
+    String? sseCustomerKey,
+    bool resumable = false,
+    int? maxBytesPerSecond,
+    int? concurrency,
+  }) async {
+    final handle = _ensureInitialized();
+    final options = {
+      if (sseCustomerKey != null) 'sseCustomerKey': sseCustomerKey,
+      if (resumable) 'resumable': true,
+      if (maxBytesPerSecond != null) 'maxBytesPerSecond': maxBytesPerSecond,
+      if (concurrency != null) 'concurrency': concurrency,
+    };
+    return _decodeResult(
+          _bindings.downloadPrefix(
+            handle,
+            keyPrefix,
+            localDir,
+            options.isEmpty ? '' : jsonEncode(options),
+          ),
+        )
+        as Map<String, dynamic>;
+  }
+
+  /// Upload the files under a local directory that are missing from the
+  /// bucket or differ from their object
+  ///
+  /// [localDir] - Local directory to sync recursively
+  /// [keyPrefix] - Prefix prepended to each file's relative path, as for
+  /// [uploadDirectory]
+  /// [options] - Upload options applied to every file
+  /// [concurrency] - Number of files uploaded at once, 4 when `null`
+  /// [delete] - Also delete the objects under [keyPrefix] without a local file
+  /// [dryRun] - Only report what would be uploaded and deleted
+  ///
+  /// Returns a map with the `transferred` and `deleted` files (`path`, `key`
+  /// and the `reason` of the transfer: `missing`, `size` or `modified`), the
+  /// number of `skipped` files already up to date and the failures in
+  /// `errors`. Throws [S3Exception] if the directory or the bucket can't be
+  /// listed.
+  Future<Map<String, dynamic>> syncUp(
+    String localDir,
+    String keyPrefix, {
+    UploadOptions? options,
+    int? concurrency,
+    bool delete = false,
+    bool dryRun = false,
+  }) async {
+    final handle = _ensureInitialized();
+    final syncOptions = {
+      if (options != null)
+        ...jsonDecode(options.toJson()) as Map<String, dynamic>,
+      if (concurrency != null) 'concurrency': concurrency,
+      if (delete) 'delete': true,
+      if (dryRun) 'dryRun': true,
+    };
+    return _decodeResult(
+          _bindings.syncUp(
+            handle,
+            localDir,
+            keyPrefix,
+            syncOptions.isEmpty ? '' : jsonEncode(syncOptions),
+          ),
+        )
+        as Map<String, dynamic>;
+  }
+
+  /// Download the objects under a key prefix that are missing from a local
+  /// directory or differ from their file
   ///
-  /// Returns empty string on success, error message on failure
-  Future<String> download(String objectKey, String destinationPath) async {
-    _ensureInitialized();
-    return _bindings.download(objectKey, destinationPath);
+  /// [keyPrefix] - Prefix of the keys to sync
+  /// [localDir] - Directory the objects are saved to, as for [downloadPrefix]
+  /// [sseCustomerKey], [resumable], [maxBytesPerSecond] - Applied to every
+  /// object as for [download]
+  /// [concurrency] - Number of objects downloaded at once, 4 when `null`
+  /// [delete] - Also delete the files under [localDir] without an object
+  /// [dryRun] - Only report what would be downloaded and deleted
+  ///
+  /// Returns the same map as [syncUp]. Downloaded files get the modification
+  /// date of their object, which is how later syncs recognize them.
+  Future<Map<String, dynamic>> syncDown(
+    String keyPrefix,
+    String localDir, {
+    String? sseCustomerKey,
+    bool resumable = false,
+    int? maxBytesPerSecond,
+    int? concurrency,
+    bool delete = false,
+    bool dryRun = false,
+  }) async {
+    final handle = _ensureInitialized();
+    final options = {
+      if (sseCustomerKey != null) 'sseCustomerKey': sseCustomerKey,
+      if (resumable) 'resumable': true,
+      if (maxBytesPerSecond != null) 'maxBytesPerSecond': maxBytesPerSecond,
+      if (concurrency != null) 'concurrency': concurrency,
+      if (delete) 'delete': true,
+      if (dryRun) 'dryRun': true,
+    };
+    return _decodeResult(
+          _bindings.syncDown(
+            handle,
+            keyPrefix,
+            localDir,
+            options.isEmpty ? '' : jsonEncode(options),
+          ),
+        )
+        as Map<String, dynamic>;
+  }
+
+  /// Start [upload] in the background
+  ///
+  /// Unlike [upload], which blocks the isolate until the file is uploaded,
+  /// returns at once; the operation's [S3Operation.result] completes with
+  /// the object key.
+  S3Operation<String> uploadAsync(
+    String filePath,
+    String objectKey, {
+    UploadOptions? options,
+  }) {
+    final handle = _ensureInitialized();
+    _listenForCompletions();
+    return _track(
+      _bindings.uploadAsync(
+        handle,
+        filePath,
+        objectKey,
+        options?.toJson() ?? '',
+      ),
+      (data) => data as String,
+    );
+  }
+
+  /// Start [download] in the background
+  ///
+  /// Takes the options of [download]. Returns at once; the operation's
+  /// [S3Operation.result] completes once the file is saved.
+  S3Operation<void> downloadAsync(
+    String objectKey,
+    String destinationPath, {
+    String? sseCustomerKey,
+    bool resumable = false,
+    int? maxBytesPerSecond,
+    String? versionId,
+    Map<String, String>? headers,
+    bool requesterPays = false,
+  }) {
+    final handle = _ensureInitialized();
+    final options = {
+      if (sseCustomerKey != null) 'sseCustomerKey': sseCustomerKey,
+      if (resumable) 'resumable': true,
+      if (maxBytesPerSecond != null) 'maxBytesPerSecond': maxBytesPerSecond,
+      if (versionId != null) 'versionId': versionId,
+      if (headers != null && headers.isNotEmpty) 'headers': headers,
+      if (requesterPays) 'requestPayer': 'requester',
+    };
+    _listenForCompletions();
+    return _track(
+      _bindings.downloadAsync(
+        handle,
+        objectKey,
+        destinationPath,
+        options.isEmpty ? '' : jsonEncode(options),
+      ),
+      (_) {},
+    );
+  }
+
+  /// Start [uploadDirectory] in the background
+  ///
+  /// Takes the options of [uploadDirectory]. Returns at once; the
+  /// operation's [S3Operation.result] completes with the same map.
+  S3Operation<Map<String, dynamic>> uploadDirectoryAsync(
+    String localDir,
+    String keyPrefix, {
+    UploadOptions? options,
+    int? concurrency,
+  }) {
+    final handle = _ensureInitialized();
+    final directoryOptions = {
+      if (options != null)
+        ...jsonDecode(options.toJson()) as Map<String, dynamic>,
+      if (concurrency != null) 'concurrency': concurrency,
+    };
+    _listenForCompletions();
+    return _track(
+      _bindings.uploadDirectoryAsync(
+        handle,
+        localDir,
+        keyPrefix,
+        directoryOptions.isEmpty ? '' : jsonEncode(directoryOptions),
+      ),
+      (data) => data as Map<String, dynamic>,
+    );
+  }
+
+  /// Start [downloadMany] in the background
+  ///
+  /// Takes the options of [downloadMany]. Returns at once; the operation's
+  /// [S3Operation.result] completes with the same map.
+  S3Operation<Map<String, dynamic>> downloadManyAsync(
+    Map<String, String> destinationPaths, {
+    int? concurrency,
+    String? sseCustomerKey,
+    bool resumable = false,
+    int? maxBytesPerSecond,
+    Map<String, String>? versionIds,
+    Map<String, String>? headers,
+    bool requesterPays = false,
+  }) {
+    final handle = _ensureInitialized();
+    final options = {
+      if (sseCustomerKey != null) 'sseCustomerKey': sseCustomerKey,
+      if (resumable) 'resumable': true,
+      if (maxBytesPerSecond != null) 'maxBytesPerSecond': maxBytesPerSecond,
+      if (versionIds != null && versionIds.isNotEmpty) 'versionIds': versionIds,
+      if (headers != null && headers.isNotEmpty) 'headers': headers,
+      if (requesterPays) 'requestPayer': 'requester',
+    };
+    _listenForCompletions();
+    return _track(
+      _bindings.downloadManyAsync(
+        handle,
+        jsonEncode(destinationPaths.keys.toList()),
+        jsonEncode(destinationPaths.values.toList()),
+        concurrency ?? 0,
+        options.isEmpty ? '' : jsonEncode(options),
+      ),
+      (data) => data as Map<String, dynamic>,
+    );
+  }
+
+  /// Start [downloadPrefix] in the background
+  ///
+  /// Takes the options of [downloadPrefix]. Returns at once; the
+  /// operation's [S3Operation.result] completes with the same map.
+  S3Operation<Map<String, dynamic>> downloadPrefixAsync(
+    String keyPrefix,
+    String localDir, {
+    String? sseCustomerKey,
+    bool resumable = false,
+    int? maxBytesPerSecond,
+    int? concurrency,
+  }) {
+    final handle = _ensureInitialized();
+    final options = {
+      if (sseCustomerKey != null) 'sseCustomerKey': sseCustomerKey,
+      if (resumable) 'resumable': true,
+      if (maxBytesPerSecond != null) 'maxBytesPerSecond': maxBytesPerSecond,
+      if (concurrency != null) 'concurrency': concurrency,
+    };
+    _listenForCompletions();
+    return _track(
+      _bindings.downloadPrefixAsync(
+        handle,
+        keyPrefix,
+        localDir,
+        options.isEmpty ? '' : jsonEncode(options),
+      ),
+      (data) => data as Map<String, dynamic>,
+    );
+  }
+
+  /// Start [syncUp] in the background
+  ///
+  /// Takes the options of [syncUp]. Returns at once; the operation's
+  /// [S3Operation.result] completes with the same map.
+  S3Operation<Map<String, dynamic>> syncUpAsync(
+    String localDir,
+    String keyPrefix, {
+    UploadOptions? options,
+    int? concurrency,
+    bool delete = false,
+    bool dryRun = false,
+  }) {
+    final handle = _ensureInitialized();
+    final syncOptions = {
+      if (options != null)
+        ...jsonDecode(options.toJson()) as Map<String, dynamic>,
+      if (concurrency != null) 'concurrency': concurrency,
+      if (delete) 'delete': true,
+      if (dryRun) 'dryRun': true,
+    };
+    _listenForCompletions();
+    return _track(
+      _bindings.syncUpAsync(
+        handle,
+        localDir,
+        keyPrefix,
+        syncOptions.isEmpty ? '' : jsonEncode(syncOptions),
+      ),
+      (data) => data as Map<String, dynamic>,
+    );
+  }
+
+  /// Start [syncDown] in the background
+  ///
+  /// Takes the options of [syncDown]. Returns at once; the operation's
+  /// [S3Operation.result] completes with the same map.
+  S3Operation<Map<String, dynamic>> syncDownAsync(
+    String keyPrefix,
+    String localDir, {
+    String? sseCustomerKey,
+    bool resumable = false,
+    int? maxBytesPerSecond,
+    int? concurrency,
+    bool delete = false,
+    bool dryRun = false,
+  }) {
+    final handle = _ensureInitialized();
+    final options = {
+      if (sseCustomerKey != null) 'sseCustomerKey': sseCustomerKey,
+      if (resumable) 'resumable': true,
+      if (maxBytesPerSecond != null) 'maxBytesPerSecond': maxBytesPerSecond,
+      if (concurrency != null) 'concurrency': concurrency,
+      if (delete) 'delete': true,
+      if (dryRun) 'dryRun': true,
+    };
+    _listenForCompletions();
+    return _track(
+      _bindings.syncDownAsync(
+        handle,
+        keyPrefix,
+        localDir,
+        options.isEmpty ? '' : jsonEncode(options),
+      ),
+      (data) => data as Map<String, dynamic>,
+    );
+  }
+
+  /// Register the listener completing the operations started in the
+  /// background
+  void _listenForCompletions() {
+    if (_completionCallback != null) {
+      return;
+    }
+    final bindings = _bindings;
+    final callback = NativeCallable<CompletionCallbackNative>.listener((
+      int operationId,
+      Pointer<Utf8> result,
+    ) {
+      final envelope = bindings.readCompletionResult(result);
+      _pendingOperations.remove(operationId)?.complete(envelope);
+    });
+    _bindings.setCompletionCallback(callback.nativeFunction);
+    _completionCallback = callback;
+  }
+
+  /// Run [transfer], a background operation, reporting its progress to
+  /// [onProgress]
+  ///
+  /// Progress is delivered while the isolate is free, hence the background
+  /// operation, at most every 100ms plus once on completion. The Go layer
+  /// reports the progress of every transfer to the same callback, so while
+  /// several transfers run at once each `onProgress` also receives the
+  /// others' progress.
+  Future<T> _withProgress<T>(
+    void Function(int transferred, int total) onProgress,
+    Future<T> Function() transfer,
+  ) async {
+    final callback = _progressCallback ??=
+        NativeCallable<ProgressCallbackNative>.listener((
+          int transferred,
+          int total,
+        ) {
+          for (final handler in List.of(_progressHandlers)) {
+            handler(transferred, total);
+          }
+        });
+    if (_progressHandlers.isEmpty) {
+      _bindings.setProgressCallback(callback.nativeFunction);
+    }
+    _progressHandlers.add(onProgress);
+    try {
+      return await transfer();
+    } finally {
+      _progressHandlers.remove(onProgress);
+      if (_progressHandlers.isEmpty) {
+        _bindings.setProgressCallback(nullptr);
+      }
+    }
+  }
+
+  /// Wrap the [operationId] returned by an async export, whose result
+  /// envelope's `data` is converted with [convert]
+  S3Operation<T> _track<T>(int operationId, T Function(dynamic) convert) {
+    if (operationId < 0) {
+      throw S3Exception('The background operation could not be started');
+    }
+    final completer = Completer<String>();
+    _pendingOperations[operationId] = completer;
+    return S3Operation._(
+      operationId,
+      completer.future.then((envelope) => convert(_decodeResult(envelope))),
+      _bindings,
+    );
+  }
+
+  /// Download an object from S3 straight into memory
+  ///
+  /// [objectKey] - The key of the object to download
+  /// [sseCustomerKey] - Base64 SSE-C key the object was uploaded with, if any
+  /// [versionId] - Version to download on a versioned bucket, the latest one
+  /// when `null`
+  /// [headers] - Extra HTTP headers sent with the request
+  /// [requesterPays] - Accept the charges of a requester pays bucket
+  ///
+  /// Returns the object's bytes, throws [S3Exception] on failure.
+  /// Meant for small objects; use [download] for large files.
+  Future<Uint8List> downloadBytes(
+    String objectKey, {
+    String? sseCustomerKey,
+    String? versionId,
+    Map<String, String>? headers,
+    bool requesterPays = false,
+  }) async {
+    final handle = _ensureInitialized();
+    final options = {
+      if (sseCustomerKey != null) 'sseCustomerKey': sseCustomerKey,
+      if (versionId != null) 'versionId': versionId,
+      if (headers != null && headers.isNotEmpty) 'headers': headers,
+      if (requesterPays) 'requestPayer': 'requester',
+    };
+    final result = _bindings.downloadBytes(
+      handle,
+      objectKey,
+      options.isEmpty ? '' : jsonEncode(options),
+    );
+    if (result is String) {
+      _decodeResult(result);
+    }
+    return result as Uint8List;
+  }
+
+  /// Download an object in chunks as they arrive
+  ///
+  /// [objectKey] - The key of the object to download
+  /// [sseCustomerKey], [versionId], [headers], [requesterPays] - As for
+  /// [downloadBytes]
+  ///
+  /// Returns a stream of 64 KiB chunks, e.g. to play audio while it
+  /// downloads, without holding the whole object in memory. The download
+  /// starts when the stream is listened to and cancelling the subscription
+  /// aborts it. The stream fails with [S3Exception], with code `Timeout`
+  /// when no response arrived within [S3Configuration.timeout]; the chunks
+  /// themselves are not bound by it.
+  Stream<Uint8List> downloadStream(
+    String objectKey, {
+    String? sseCustomerKey,
+    String? versionId,
+    Map<String, String>? headers,
+    bool requesterPays = false,
+  }) {
+    final handle = _ensureInitialized();
+    final options = {
+      if (sseCustomerKey != null) 'sseCustomerKey': sseCustomerKey,
+      if (versionId != null) 'versionId': versionId,
+      if (headers != null && headers.isNotEmpty) 'headers': headers,
+      if (requesterPays) 'requestPayer': 'requester',
+    };
+    final optionsJson = options.isEmpty ? '' : jsonEncode(options);
+    final bindings = _bindings;
+    final streamId = ++_lastStreamId;
+    final port = ReceivePort();
+    var canceled = false;
+    late final StreamController<Uint8List> controller;
+    controller = StreamController<Uint8List>(
+      onListen: () async {
+        final previous = _streamStarted;
+        final started = Completer<void>();
+        _streamStarted = started.future;
+        await previous;
+        if (canceled) {
+          port.close();
+          started.complete();
+          return;
+        }
+        port.listen((message) {
+          if (!started.isCompleted) {
+            started.complete();
+          }
+          if (message is TransferableTypedData) {
+            if (canceled) {
+              // Cancelled before the Go layer knew the stream
+              bindings.cancelDownloadStream(streamId);
+              return;
+            }
+            controller.add(message.materialize().asUint8List());
+            return;
+          }
+          port.close();
+          try {
+            _decodeResult(message as String);
+          } catch (e, stackTrace) {
+            controller.addError(e, stackTrace);
+          }
+          controller.close();
+        });
+        try {
+          await Isolate.spawn(_runDownloadStream, (
+            bindings.libraryPath,
+            handle,
+            objectKey,
+            streamId,
+            optionsJson,
+            port.sendPort,
+          ));
+        } catch (e, stackTrace) {
+          port.close();
+          started.complete();
+          controller.addError(e, stackTrace);
+          await controller.close();
+        }
+      },
+      onCancel: () {
+        canceled = true;
+        bindings.cancelDownloadStream(streamId);
+      },
+    );
+    return controller.stream;
   }
 
   /// Get a presigned URL for an object
   ///
   /// [objectKey] - The key of the object
   /// [expirationSeconds] - How long the URL should be valid (in seconds)
+  /// from 1 to 604800 (7 days)
   ///
-  /// Returns the presigned URL, or empty string on failure
+  /// Returns the presigned URL, throws [S3Exception] on failure
   Future<String> getPresignedUrl(
     String objectKey, {
     int expirationSeconds = 3600,
   }) async {
-    _ensureInitialized();
-    return _bindings.getPresignedUrl(objectKey, expirationSeconds);
+    final handle = _ensureInitialized();
+    return _decodeResult(
+          _bindings.getPresignedUrl(handle, objectKey, expirationSeconds),
+        )
+        as String;
+  }
+
+  /// Get a presigned URL uploading an object with an HTTP PUT
+  ///
+  /// [objectKey] - The key the object will be uploaded to
+  /// [expirationSeconds] - How long the URL should be valid (in seconds)
+  /// from 1 to 604800 (7 days)
+  /// [contentType] - `Content-Type` signed into the URL, which the upload
+  /// must send as is; unsigned when `null`
+  ///
+  /// Lets a browser or another device upload straight to the bucket, without
+  /// credentials and without routing the bytes through the app. Returns the
+  /// presigned URL, throws [S3Exception] on failure.
+  Future<String> getPresignedPutUrl(
+    String objectKey, {
+    int expirationSeconds = 3600,
+    String? contentType,
+  }) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(
+          _bindings.getPresignedPutUrl(
+            handle,
+            objectKey,
+            expirationSeconds,
+            contentType ?? '',
+          ),
+        )
+        as String;
+  }
+
+  /// Get a presigned URL checking an object's existence with an HTTP HEAD
+  ///
+  /// [objectKey] - The key of the object
+  /// [expirationSeconds] - How long the URL should be valid (in seconds)
+  /// from 1 to 604800 (7 days)
+  ///
+  /// Returns the presigned URL, throws [S3Exception] on failure
+  Future<String> getPresignedHeadUrl(
+    String objectKey, {
+    int expirationSeconds = 3600,
+  }) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(
+          _bindings.getPresignedHeadUrl(handle, objectKey, expirationSeconds),
+        )
+        as String;
+  }
+
+  /// Get a presigned URL deleting an object with an HTTP DELETE
+  ///
+  /// [objectKey] - The key of the object
+  /// [expirationSeconds] - How long the URL should be valid (in seconds)
+  /// from 1 to 604800 (7 days)
+  ///
+  /// Returns the presigned URL, throws [S3Exception] on failure
+  Future<String> getPresignedDeleteUrl(
+    String objectKey, {
+    int expirationSeconds = 3600,
+  }) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(
+          _bindings.getPresignedDeleteUrl(handle, objectKey, expirationSeconds),
+        )
+        as String;
+  }
+
+  /// Get a presigned URL for `GET`, `PUT`, `DELETE` or `HEAD` on an object
+  ///
+  /// [method] - The HTTP method the URL is signed for
+  /// [objectKey] - The key of the object
+  /// [expirationSeconds] - How long the URL should be valid (in seconds)
+  /// from 1 to 604800 (7 days)
+  /// [headers] - Extra headers signed into the URL; `x-amz-*` ones are moved
+  /// into the query string, the others must be sent by whoever uses the URL
+  /// [contentType] - `Content-Type` a `PUT` must be sent with
+  /// [responseContentType] - `Content-Type` served by a `GET`
+  /// [responseContentDisposition] - `Content-Disposition` served by a `GET`
+  ///
+  /// Returns the presigned URL, throws [S3Exception] on failure
+  Future<String> presign(
+    String method,
+    String objectKey, {
+    int expirationSeconds = 3600,
+    Map<String, String>? headers,
+    String? contentType,
+    String? responseContentType,
+    String? responseContentDisposition,
+  }) async {
+    final handle = _ensureInitialized();
+    final params = {
+      if (headers != null && headers.isNotEmpty) 'headers': headers,
+      if (contentType != null) 'contentType': contentType,
+      if (responseContentType != null)
+        'responseContentType': responseContentType,
+      if (responseContentDisposition != null)
+        'responseContentDisposition': responseContentDisposition,
+    };
+    return _decodeResult(
+          _bindings.presign(
+            handle,
+            method,
+            objectKey,
+            expirationSeconds,
+            params.isEmpty ? '' : jsonEncode(params),
+          ),
+        )
+        as String;
+  }
+
+  /// Get a presigned POST letting a browser upload an object with an HTML form
+  ///
+  /// [objectKey] - The key the object will be uploaded to
+  /// [expirationSeconds] - How long the policy should be valid (in seconds),
+  /// must not be negative
+  /// [minSize], [maxSize] - Bounds of the upload size in bytes, unbounded
+  /// when `null`
+  /// [contentType] - Exact `Content-Type` of the upload, added to the fields
+  /// [contentTypePrefix] - Required prefix of the `Content-Type` field set by
+  /// the form, e.g. `image/`; can't be combined with [contentType]
+  ///
+  /// Unlike [getPresignedPutUrl], the restrictions are signed into a policy
+  /// S3 enforces. Returns a map with the `url` the form posts to and the
+  /// `fields` it must send before the `file` field. Throws [S3Exception] on
+  /// failure; R2 doesn't support POST uploads.
+  Future<Map<String, dynamic>> getPresignedPost(
+    String objectKey, {
+    int expirationSeconds = 3600,
+    int? minSize,
+    int? maxSize,
+    String? contentType,
+    String? contentTypePrefix,
+  }) async {
+    final handle = _ensureInitialized();
+    final options = {
+      if (minSize != null) 'minSize': minSize,
+      if (maxSize != null) 'maxSize': maxSize,
+      if (contentType != null) 'contentType': contentType,
+      if (contentTypePrefix != null) 'contentTypePrefix': contentTypePrefix,
+    };
+    return _decodeResult(
+          _bindings.getPresignedPost(
+            handle,
+            objectKey,
+            expirationSeconds,
+            options.isEmpty ? '' : jsonEncode(options),
+          ),
+        )
+        as Map<String, dynamic>;
+  }
+
+  /// Get the unsigned URL of an object
+  ///
+  /// [objectKey] - The key of the object
+  ///
+  /// The URL is virtual-hosted or path style following the client's
+  /// configuration, as its own requests are, so it is right on AWS, R2 and
+  /// MinIO alike. It only serves publicly readable objects; use
+  /// [getPresignedUrl] for private ones. Throws [S3Exception] on failure.
+  Future<String> getObjectUrl(String objectKey) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(_bindings.getObjectUrl(handle, objectKey)) as String;
+  }
+
+  /// List the multipart uploads that were started but neither completed nor
+  /// aborted, e.g. after the app was killed mid-upload
+  ///
+  /// Their parts keep accruing storage charges. Returns a map per upload
+  /// with its `key`, `uploadId` and `initiated` date (ISO 8601). Throws
+  /// [S3Exception] on failure.
+  Future<List<Map<String, dynamic>>> listMultipartUploads() async {
+    final handle = _ensureInitialized();
+    final List<dynamic> decoded = _decodeResult(
+      _bindings.listMultipartUploads(handle),
+    );
+    return decoded.cast<Map<String, dynamic>>();
+  }
+
+  /// Abort a multipart upload, discarding its uploaded parts
+  ///
+  /// [objectKey], [uploadId] - As returned by [listMultipartUploads]
+  ///
+  /// Throws [S3Exception] on failure
+  Future<void> abortMultipartUpload(String objectKey, String uploadId) async {
+    final handle = _ensureInitialized();
+    _decodeResult(_bindings.abortMultipartUpload(handle, objectKey, uploadId));
+  }
+
+  /// Abort the multipart uploads initiated more than [olderThan] ago, for
+  /// periodic cleanup
+  ///
+  /// [olderThan] - Age past which an upload is abandoned, at least a second;
+  /// keep it well above the duration of the longest upload so running ones
+  /// aren't aborted
+  ///
+  /// Returns a map with the `aborted` uploads, as listed by
+  /// [listMultipartUploads], and the failures in `errors` (`key`, `code` and
+  /// `message`). Throws [S3Exception] on failure, with code
+  /// `InvalidArgument` when [olderThan] is under a second.
+  Future<Map<String, dynamic>> abortStaleMultipartUploads(
+    Duration olderThan,
+  ) async {
+    final handle = _ensureInitialized();
+    return _decodeResult(
+          _bindings.abortStaleMultipartUploads(handle, olderThan.inSeconds),
+        )
+        as Map<String, dynamic>;
   }
 
   /// Check if an object exists in the bucket
   ///
   /// [objectKey] - The key of the object to check
   ///
-  /// Returns true if the object exists, false otherwise
+  /// Returns true if the object exists, false otherwise.
+  /// Throws [S3Exception] if the check itself failed (network, credentials),
+  /// so a missing object is never confused with an unreachable bucket.
   Future<bool> isKeyBucketExist(String objectKey) async {
-    _ensureInitialized();
-    return _bindings.isKeyBucketExist(objectKey);
+    final handle = _ensureInitialized();
+    final result = _bindings.checkKeyBucketExist(handle, objectKey);
+    if (result < 0) {
+      throw S3Exception('Failed to check whether "$objectKey" exists');
+    }
+    return result == 1;
+  }
+
+  /// Get an object's metadata without downloading it
+  ///
+  /// [objectKey] - The key of the object
+  /// [sseCustomerKey] - Base64 SSE-C key the object was uploaded with, if any
+  /// [versionId] - Version to describe on a versioned bucket, the latest one
+  /// when `null`
+  /// [requesterPays] - Accept the charges of a requester pays bucket
+  ///
+  /// Returns a map with `exists` and, for existing objects, `size`,
+  /// `contentType`, `etag`, `lastModified`, `storageClass`, `metadata` and,
+  /// on versioned buckets, `versionId`. Throws [S3Exception] if the request
+  /// failed.
+  Future<Map<String, dynamic>> statObject(
+    String objectKey, {
+    String? sseCustomerKey,
+    String? versionId,
+    bool requesterPays = false,
+  }) async {
+    final handle = _ensureInitialized();
+    final options = {
+      if (sseCustomerKey != null) 'sseCustomerKey': sseCustomerKey,
+      if (versionId != null) 'versionId': versionId,
+      if (requesterPays) 'requestPayer': 'requester',
+    };
+    return _decodeResult(
+          _bindings.statObject(
+            handle,
+            objectKey,
+            options.isEmpty ? '' : jsonEncode(options),
+          ),
+        )
+        as Map<String, dynamic>;
+  }
+
+  /// Release the client's resources
+  ///
+  /// Operations still running fail with code `Canceled` and idle connections
+  /// are closed. The client must be initialized again before further use.
+  void close() {
+    final handle = _ensureInitialized();
+    _handle = null;
+    _credentialRefreshers.remove(handle);
+    _decodeResult(_bindings.closeBucket(handle));
+  }
+
+  /// Cap the combined throughput of the transfers of every client
+  ///
+  /// [bytesPerSecond] - Cap applied to uploads and downloads separately,
+  /// `null` removes it. Keeps background syncs from saturating the user's
+  /// connection.
+  void setBandwidthLimit(int? bytesPerSecond) {
+    _decodeResult(_bindings.setBandwidthLimit(bytesPerSecond ?? 0));
   }
 
-  void _ensureInitialized() {
-    if (!_initialized) {
+  /// Set the minimum level of the records logged by every client
+  ///
+  /// Defaults to [S3LogLevel.info], [S3LogLevel.off] silences the library.
+  void setLogLevel(S3LogLevel level) {
+    _decodeResult(_bindings.setLogLevel(level.name));
+  }
+
+  /// Route the records logged by every client to [handler]
+  ///
+  /// [handler] - Receives the level and the record formatted as a logfmt
+  /// line, e.g. to forward it to the app's logger. `null` restores the
+  /// default output, stderr, which is invisible in Flutter release builds.
+  void setLogHandler(void Function(S3LogLevel level, String message)? handler) {
+    _logCallback?.close();
+    _logCallback = null;
+    if (handler == null) {
+      _bindings.setLogCallback(nullptr);
+      return;
+    }
+    final bindings = _bindings;
+    final callback = NativeCallable<LogCallbackNative>.listener((
+      int level,
+      Pointer<Utf8> message,
+    ) {
+      handler(S3LogLevel._fromNative(level), bindings.readLogMessage(message));
+    });
+    _bindings.setLogCallback(callback.nativeFunction);
+    _logCallback = callback;
+  }
+
+  /// Append the records logged by every client to the file at [path]
+  ///
+  /// [path] - Log file, created if needed. `null` closes the current one.
+  void setLogFile(String? path) {
+    _decodeResult(_bindings.setLogFile(path ?? ''));
+  }
+
+  /// Decode the JSON result envelope returned by the Go library
+  ///
+  /// Returns the `data` value on success, throws [S3Exception] on failure
+  dynamic _decodeResult(String jsonResult) {
+    final Map<String, dynamic> envelope = jsonDecode(jsonResult);
+    if (envelope['ok'] != true) {
+      final code = envelope['code'] as String?;
+      throw S3Exception(
+        envelope['message'] as String? ?? 'Unknown error',
+        code: code == null || code.isEmpty ? null : code,
+      );
+    }
+    return envelope['data'];
+  }
+
+  /// Returns the bucket handle, throws [StateError] before [initialize]
+  int _ensureInitialized() {
+    final handle = _handle;
+    if (handle == null) {
       throw StateError('S3Client not initialized. Call initialize() first.');
     }
+    return handle;
+  }
+}
+
+/// An operation running in the background, started by one of the `*Async`
+/// methods of [S3Client]
+class S3Operation<T> {
+  /// Id of the operation in the Go layer
+  final int id;
+
+  /// Completes with the outcome of the operation, or fails with
+  /// [S3Exception]
+  final Future<T> result;
+
+  final S3FFIBindings _bindings;
+
+  S3Operation._(this.id, this.result, this._bindings);
+
+  /// Abort the operation, e.g. a large download the user navigated away from
+  ///
+  /// The request in flight is canceled and [result] fails with code
+  /// `Canceled`; directory and batch transfers don't start their remaining
+  /// files. Returns false if the operation already finished.
+  bool cancel() => _bindings.cancelOperation(id);
+}
+
+/// Runs a [S3Client.downloadStream] in its own isolate
+///
+/// `downloadStream` blocks until the whole object was read, handing each chunk
+/// to a callback on the calling thread, so it can't run on the listener's
+/// isolate. The chunks are copied out before the callback returns, since Go
+/// reuses their buffer.
+void _runDownloadStream(
+  (String, int, String, int, String, SendPort) arguments,
+) {
+  final (libraryPath, handle, objectKey, streamId, optionsJson, sendPort) =
+      arguments;
+  final bindings = S3FFIBindings(libraryPath: libraryPath, autoDownload: false);
+  final callback = NativeCallable<ChunkCallbackNative>.isolateLocal((
+    int id,
+    Pointer<Uint8> data,
+    int length,
+  ) {
+    if (length > 0) {
+      sendPort.send(
+        TransferableTypedData.fromList([data.asTypedList(length)]),
+      );
+    }
+    return 0;
+  }, exceptionalReturn: 1);
+  bindings.setStreamCallback(callback.nativeFunction);
+  try {
+    sendPort.send(
+      bindings.downloadStream(handle, objectKey, streamId, optionsJson),
+    );
+  } finally {
+    callback.close();
   }
 }
 
@@ -120,8 +2124,31 @@ class S3Client {
 class S3Exception implements Exception {
   final String message;
 
-  S3Exception(this.message);
+  /// S3 error code (e.g. `NoSuchKey`, `AccessDenied`) when available
+  final String? code;
+
+  S3Exception(this.message, {this.code});
 
   @override
-  String toString() => 'S3Exception: $message';
+  String toString() =>
+      code == null ? 'S3Exception: $message' : 'S3Exception($code): $message';
+}
+
+/// Severity of the records logged by the Go layer
+enum S3LogLevel {
+  debug,
+  info,
+  warn,
+  error,
+
+  /// Silences the library, only valid for [S3Client.setLogLevel]
+  off;
+
+  /// Map a Go `slog` level (-4 debug, 0 info, 4 warn, 8 error)
+  static S3LogLevel _fromNative(int level) => switch (level) {
+    < 0 => debug,
+    < 4 => info,
+    < 8 => warn,
+    _ => error,
+  };
 }
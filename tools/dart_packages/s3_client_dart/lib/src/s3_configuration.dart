@@ -7,6 +7,108 @@ class S3Configuration {
   final String accountId;
   final String region;
 
+  /// Use path-style addressing (`endpoint/bucket/key`), required by MinIO,
+  /// rather than virtual-hosted style (`bucket.endpoint/key`). When `null`,
+  /// virtual-hosted style is used for AWS and path style for any other
+  /// endpoint, such as MinIO or R2.
+  final bool? usePathStyle;
+
+  /// Skip TLS certificate verification, for self-signed development endpoints only
+  final bool insecureSkipVerify;
+
+  /// Allow a plain `http://` [endpoint] and skip TLS certificate
+  /// verification, for integration tests against a local MinIO or localstack
+  /// container only. `http://` endpoints are rejected otherwise.
+  final bool allowInsecure;
+
+  /// Use the dual-stack endpoints of AWS, reachable over IPv6, with an empty
+  /// [endpoint]
+  final bool dualStack;
+
+  /// Send requests through S3 Transfer Acceleration, enabled on the bucket,
+  /// for faster long-distance transfers. Requires an empty [endpoint] and
+  /// virtual-hosted addressing.
+  final bool accelerate;
+
+  /// Default timeout of every S3 call, none when `null`, so a dropped
+  /// connection fails instead of blocking forever
+  final Duration? timeout;
+
+  /// Retry policy replacing the SDK default, see [S3RetryPolicy]
+  final S3RetryPolicy? retry;
+
+  /// Ignore the keys above and let the SDK's default chain resolve
+  /// credentials: environment variables, `~/.aws/credentials`, then
+  /// container or instance metadata. Meant for desktop and server use.
+  final bool useDefaultCredentials;
+
+  /// Send unsigned requests, ignoring the keys above, for read-only access
+  /// to public buckets without shipping dummy keys. Presigned URLs can't be
+  /// generated.
+  final bool anonymous;
+
+  /// Accept the charges of every request, listings included, to a requester
+  /// pays bucket, such as one hosting a public dataset
+  final bool requesterPays;
+
+  /// IAM Identity Center (SSO) profile of `~/.aws/config` whose credentials
+  /// are used instead of the keys above, after signing in with
+  /// `aws sso login --profile <name>`
+  final String? ssoProfile;
+
+  /// OIDC token exchanged for role credentials instead of the keys above,
+  /// see [S3WebIdentity]
+  final S3WebIdentity? webIdentity;
+
+  /// Called for fresh credentials shortly before the current ones expire,
+  /// letting the app own the token lifecycle. The keys above, if any, are
+  /// used until [credentialsExpiration].
+  final Future<S3Credentials> Function()? refreshCredentials;
+
+  /// Expiry of the keys above, required with them and [refreshCredentials]
+  final DateTime? credentialsExpiration;
+
+  /// IAM role assumed with the configured credentials, see [S3AssumeRole]
+  final S3AssumeRole? assumeRole;
+
+  /// Part size in MB of multipart uploads and ranged downloads, between 5
+  /// and 5120, 5 when `null`. Larger files are transferred in parts.
+  final int? partSizeMB;
+
+  /// Number of parts of one transfer sent at once, 5 when `null`
+  final int? concurrency;
+
+  /// Application identifier of at most 50 characters appended to the
+  /// User-Agent of every request as `app/<appId>`, so server logs and
+  /// provider dashboards can attribute the traffic. Identifies this package
+  /// and its version when `null`.
+  final String? appId;
+
+  /// Proxy every request goes through, see [S3Proxy]. The `HTTP_PROXY`,
+  /// `HTTPS_PROXY` and `NO_PROXY` environment variables are used when `null`.
+  final S3Proxy? proxy;
+
+  /// Extra certificate authorities and client certificate, see
+  /// [S3TlsConfig]
+  final S3TlsConfig? tls;
+
+  /// Known S3-compatible provider whose settings are applied, `r2` for
+  /// Cloudflare R2, see [S3Configuration.r2]
+  final String? provider;
+
+  /// Data location of R2 buckets, `eu` or `fedramp`, the default location
+  /// when `null`
+  final String? jurisdiction;
+
+  /// Record a summary of every request, with its latency and the request
+  /// IDs providers ask for in support requests, read with
+  /// `S3Client.getDiagnostics`. Credentials and contents are never recorded.
+  final bool enableDiagnostics;
+
+  /// OpenTelemetry collector the spans of every S3 operation are exported
+  /// to, see [S3Tracing]
+  final S3Tracing? tracing;
+
   S3Configuration({
     required this.endpoint,
     required this.bucketName,
@@ -15,5 +117,306 @@ class S3Configuration {
     required this.sessionToken,
     required this.accountId,
     required this.region,
+    this.usePathStyle,
+    this.insecureSkipVerify = false,
+    this.allowInsecure = false,
+    this.dualStack = false,
+    this.accelerate = false,
+    this.timeout,
+    this.retry,
+    this.useDefaultCredentials = false,
+    this.anonymous = false,
+    this.requesterPays = false,
+    this.ssoProfile,
+    this.webIdentity,
+    this.refreshCredentials,
+    this.credentialsExpiration,
+    this.assumeRole,
+    this.partSizeMB,
+    this.concurrency,
+    this.appId,
+    this.proxy,
+    this.tls,
+    this.provider,
+    this.jurisdiction,
+    this.enableDiagnostics = false,
+    this.tracing,
+  });
+
+  /// Configuration of a Cloudflare R2 bucket
+  ///
+  /// The endpoint is built from [accountId], the Cloudflare account ID, and
+  /// [jurisdiction], with the `auto` region, path-style addressing and the
+  /// checksum settings R2 supports.
+  S3Configuration.r2({
+    required String accountId,
+    required String bucketName,
+    required String accessKeyId,
+    required String secretAccessKey,
+    String? jurisdiction,
+    bool? usePathStyle,
+    Duration? timeout,
+    S3RetryPolicy? retry,
+    int? partSizeMB,
+    int? concurrency,
+    String? appId,
+    S3Proxy? proxy,
+    bool enableDiagnostics = false,
+    S3Tracing? tracing,
+  }) : this(
+         endpoint: '',
+         bucketName: bucketName,
+         accessKeyId: accessKeyId,
+         secretAccessKey: secretAccessKey,
+         sessionToken: '',
+         accountId: accountId,
+         region: 'auto',
+         usePathStyle: usePathStyle,
+         timeout: timeout,
+         retry: retry,
+         partSizeMB: partSizeMB,
+         concurrency: concurrency,
+         appId: appId,
+         proxy: proxy,
+         provider: 'r2',
+         jurisdiction: jurisdiction,
+         enableDiagnostics: enableDiagnostics,
+         tracing: tracing,
+       );
+}
+
+/// PEM encoded certificates of the TLS connections, for self-hosted
+/// endpoints such as MinIO behind an internal PKI
+///
+/// Read them with `File(path).readAsStringSync()` or from the app's assets.
+class S3TlsConfig {
+  /// Certificate authorities trusted on top of the system ones
+  final String? caBundle;
+
+  /// Certificate chain presented to endpoints requiring mutual TLS, set
+  /// with [clientKey]
+  final String? clientCertificate;
+
+  /// Private key of [clientCertificate]
+  final String? clientKey;
+
+  const S3TlsConfig({
+    this.caBundle,
+    this.clientCertificate,
+    this.clientKey,
+  });
+
+  /// Encode the certificates as the JSON object expected by the Go library
+  Map<String, dynamic> toJson() {
+    return {
+      if (caBundle != null) 'caBundle': caBundle,
+      if (clientCertificate != null) 'clientCertificate': clientCertificate,
+      if (clientKey != null) 'clientKey': clientKey,
+    };
+  }
+}
+
+/// OTLP/HTTP export of a span per S3 operation, with its request IDs and
+/// retry count, so backend teams can correlate transfers with server traces
+///
+/// Requests carry the W3C `traceparent` header of their span.
+class S3Tracing {
+  /// `http://` or `https://` URL of the collector's traces endpoint, e.g.
+  /// `https://collector.corp:4318/v1/traces`
+  final String endpoint;
+
+  /// Headers sent with every export, e.g. the API key of the tracing backend
+  final Map<String, String>? headers;
+
+  /// `service.name` of the spans, `s3_client_dart` when `null`
+  final String? serviceName;
+
+  /// Fraction of the traces exported, between 0 and 1, all when `null`
+  final double? sampleRatio;
+
+  const S3Tracing({
+    required this.endpoint,
+    this.headers,
+    this.serviceName,
+    this.sampleRatio,
+  });
+
+  /// Encode the settings as the JSON object expected by the Go library
+  Map<String, dynamic> toJson() {
+    return {
+      'endpoint': endpoint,
+      if (headers != null) 'headers': headers,
+      if (serviceName != null) 'serviceName': serviceName,
+      if (sampleRatio != null) 'sampleRatio': sampleRatio,
+    };
+  }
+}
+
+/// HTTP or HTTPS proxy of the S3 requests, for networks that can only reach
+/// S3 through one
+class S3Proxy {
+  /// `http://` or `https://` URL of the proxy, e.g. `http://proxy.corp:3128`
+  final String url;
+
+  /// Basic auth username sent to the proxy, if it requires one
+  final String? username;
+
+  /// Basic auth password sent to the proxy with [username]
+  final String? password;
+
+  const S3Proxy({
+    required this.url,
+    this.username,
+    this.password,
+  });
+
+  /// Encode the proxy as the JSON object expected by the Go library
+  Map<String, dynamic> toJson() {
+    return {
+      'url': url,
+      if (username != null) 'username': username,
+      if (password != null) 'password': password,
+    };
+  }
+}
+
+/// IAM role assumed through STS with the configured credentials
+///
+/// The role's temporary credentials are refreshed automatically before they
+/// expire, for backends handing out role-based access instead of static keys.
+class S3AssumeRole {
+  /// ARN of the role to assume
+  final String roleArn;
+
+  /// External ID required by the role's trust policy, if any
+  final String? externalId;
+
+  /// Role session name shown in CloudTrail, generated when `null`
+  final String? sessionName;
+
+  /// Lifetime of the temporary credentials, 15 minutes when `null`
+  final Duration? duration;
+
+  const S3AssumeRole({
+    required this.roleArn,
+    this.externalId,
+    this.sessionName,
+    this.duration,
+  });
+
+  /// Encode the role as the JSON object expected by the Go library
+  Map<String, dynamic> toJson() {
+    return {
+      'roleArn': roleArn,
+      if (externalId != null) 'externalId': externalId,
+      if (sessionName != null) 'sessionName': sessionName,
+      if (duration != null) 'durationSeconds': duration!.inSeconds,
+    };
+  }
+}
+
+/// Automatic retries of failed S3 calls
+///
+/// Fields left `null` keep the SDK defaults: 3 attempts with a jittered
+/// exponential backoff capped at 20 seconds, retrying throttling, 5xx and
+/// connection errors.
+class S3RetryPolicy {
+  /// Number of attempts including the first, 1 disables retries. Like
+  /// `null`, 0 keeps the default of 3 attempts, unlike the `maxAttempts` of
+  /// `S3Client.configureRetries`
+  final int? maxAttempts;
+
+  /// Maximum delay between two attempts
+  final Duration? maxBackoff;
+
+  /// Also slow down the client while the service is throttling
+  final bool adaptive;
+
+  /// S3 error codes retried on top of the defaults, e.g. `RequestTimeout`
+  final List<String>? retryableErrorCodes;
+
+  const S3RetryPolicy({
+    this.maxAttempts,
+    this.maxBackoff,
+    this.adaptive = false,
+    this.retryableErrorCodes,
   });
+
+  /// Encode the policy as the JSON object expected by the Go library
+  Map<String, dynamic> toJson() {
+    return {
+      if (maxAttempts != null) 'maxAttempts': maxAttempts,
+      if (maxBackoff != null) 'maxBackoffSeconds': maxBackoff!.inSeconds,
+      'mode': adaptive ? 'adaptive' : 'standard',
+      if (retryableErrorCodes != null)
+        'retryableErrorCodes': retryableErrorCodes,
+    };
+  }
+}
+
+/// Role assumed with an OIDC token (JWT), e.g. from Firebase or Cognito
+///
+/// Set exactly one of [token] and [tokenFile].
+class S3WebIdentity {
+  /// ARN of the role to assume
+  final String roleArn;
+
+  /// The OIDC token itself
+  final String? token;
+
+  /// File holding the token, read again on every refresh
+  final String? tokenFile;
+
+  /// Role session name shown in CloudTrail, generated when `null`
+  final String? sessionName;
+
+  /// Lifetime of the temporary credentials, 1 hour when `null`
+  final Duration? duration;
+
+  const S3WebIdentity({
+    required this.roleArn,
+    this.token,
+    this.tokenFile,
+    this.sessionName,
+    this.duration,
+  });
+
+  /// Encode the identity as the JSON object expected by the Go library
+  Map<String, dynamic> toJson() {
+    return {
+      'roleArn': roleArn,
+      if (token != null) 'token': token,
+      if (tokenFile != null) 'tokenFile': tokenFile,
+      if (sessionName != null) 'sessionName': sessionName,
+      if (duration != null) 'durationSeconds': duration!.inSeconds,
+    };
+  }
+}
+
+/// Temporary credentials returned by [S3Configuration.refreshCredentials]
+class S3Credentials {
+  final String accessKeyId;
+  final String secretAccessKey;
+  final String? sessionToken;
+
+  /// When the credentials expire, `null` if they never do
+  final DateTime? expiration;
+
+  const S3Credentials({
+    required this.accessKeyId,
+    required this.secretAccessKey,
+    this.sessionToken,
+    this.expiration,
+  });
+
+  /// Encode the credentials as the JSON object expected by the Go library
+  Map<String, dynamic> toJson() {
+    return {
+      'accessKeyId': accessKeyId,
+      'secretAccessKey': secretAccessKey,
+      if (sessionToken != null) 'sessionToken': sessionToken,
+      if (expiration != null)
+        'expiration': expiration!.toUtc().toIso8601String(),
+    };
+  }
 }
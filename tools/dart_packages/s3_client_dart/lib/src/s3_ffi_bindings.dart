@@ -1,16 +1,49 @@
 import 'dart:ffi';
 import 'dart:io';
+import 'dart:typed_data';
 import 'package:ffi/ffi.dart';
 import 'library_downloader.dart';
 
+/// Mirrors the `bytes_result` struct returned by `downloadBytes`
+final class BytesResult extends Struct {
+  external Pointer<Uint8> data;
+
+  @Int64()
+  external int length;
+
+  external Pointer<Utf8> error;
+}
+
+/// Native signature of the Go `progress_callback`
+typedef ProgressCallbackNative =
+    Void Function(Int64 transferred, Int64 total);
+
+/// Native signature of the Go `credentials_callback`
+typedef CredentialsCallbackNative =
+    Void Function(Int64 handle, Int64 requestId);
+
+/// Native signature of the Go `log_callback`
+typedef LogCallbackNative = Void Function(Int32 level, Pointer<Utf8> message);
+
+/// Native signature of the Go `completion_callback`
+typedef CompletionCallbackNative =
+    Void Function(Int64 operationId, Pointer<Utf8> result);
+
+/// Native signature of the Go `chunk_callback`
+typedef ChunkCallbackNative =
+    Int32 Function(Int64 streamId, Pointer<Uint8> data, Int64 length);
+
 /// FFI bindings for the Go S3 client shared library
 class S3FFIBindings {
   late final DynamicLibrary _dylib;
   final String? _customLibraryPath;
+
+  /// Path the shared library was loaded from
+  late final String libraryPath;
   final bool _autoDownload;
 
   // Function signatures
-  late final void Function(
+  late final Pointer<Utf8> Function(
     Pointer<Utf8>,
     Pointer<Utf8>,
     Pointer<Utf8>,
@@ -18,14 +51,227 @@ class S3FFIBindings {
     Pointer<Utf8>,
     Pointer<Utf8>,
     Pointer<Utf8>,
+    int,
+    int,
+    Pointer<Utf8>,
   )
   _initBucket;
-  late final Pointer<Utf8> Function(Pointer<Utf8>, Pointer<Utf8>) _upload;
-  late final Pointer<Utf8> Function() _list;
-  late final Pointer<Utf8> Function(Pointer<Utf8>) _delete;
-  late final Pointer<Utf8> Function(Pointer<Utf8>, Pointer<Utf8>) _download;
-  late final Pointer<Utf8> Function(Pointer<Utf8>, int) _getPresignedUrl;
-  late final int Function(Pointer<Utf8>) _checkKeyBucketExist;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+  )
+  _upload;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+  )
+  _uploadWithChecksum;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+  )
+  _uploadDirectory;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+  )
+  _downloadPrefix;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+  )
+  _syncUp;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+  )
+  _syncDown;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Uint8>,
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+  )
+  _uploadBytes;
+  late final Pointer<Utf8> Function(int) _list;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, int) _listPage;
+  late final Pointer<Utf8> Function(int) _listBuckets;
+  late final int Function(int) _bucketExists;
+  late final Pointer<Utf8> Function(int) _bucketStatus;
+  late final Pointer<Utf8> Function(int, int) _getDiagnostics;
+  late final Pointer<Utf8> Function(int, int) _getMetrics;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _createBucket;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _deleteBucket;
+  late final Pointer<Utf8> Function(int, int) _setBucketVersioning;
+  late final Pointer<Utf8> Function(int) _getBucketVersioning;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _listObjectVersions;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, Pointer<Utf8>)
+  _setObjectRetention;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, Pointer<Utf8>)
+  _getObjectRetention;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, int, Pointer<Utf8>)
+  _setObjectLegalHold;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, Pointer<Utf8>)
+  _getObjectLegalHold;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _setBucketLifecycle;
+  late final Pointer<Utf8> Function(int) _getBucketLifecycle;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _setBucketCors;
+  late final Pointer<Utf8> Function(int) _getBucketCors;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _setBucketPolicy;
+  late final Pointer<Utf8> Function(int) _getBucketPolicy;
+  late final Pointer<Utf8> Function(int) _deleteBucketPolicy;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, Pointer<Utf8>)
+  _setObjectAcl;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _getObjectAcl;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, Pointer<Utf8>)
+  _putObjectTags;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _getObjectTags;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _deleteObjectTags;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, Pointer<Utf8>)
+  _listWithPrefix;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _listDetailed;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _listGlob;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _delete;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _deleteMany;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, int) _deletePrefix;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, Pointer<Utf8>)
+  _deleteObjectVersion;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _restoreDeleted;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+  )
+  _copyObject;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, Pointer<Utf8>)
+  _moveObject;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+  )
+  _copyPrefix;
+  late final Pointer<Utf8> Function(int, int, Pointer<Utf8>, Pointer<Utf8>)
+  _mirrorBucket;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+  )
+  _download;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    int,
+    int,
+    Pointer<Utf8>,
+  )
+  _downloadRange;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    int,
+    Pointer<Utf8>,
+  )
+  _downloadMany;
+  late final BytesResult Function(int, Pointer<Utf8>, Pointer<Utf8>)
+  _downloadBytes;
+  late final void Function(BytesResult) _freeBytesResult;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, int) _getPresignedUrl;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, int, Pointer<Utf8>)
+  _getPresignedPutUrl;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, int)
+  _getPresignedHeadUrl;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, int)
+  _getPresignedDeleteUrl;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    int,
+    Pointer<Utf8>,
+  )
+  _presign;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, int, Pointer<Utf8>)
+  _getPresignedPost;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _getObjectUrl;
+  late final Pointer<Utf8> Function(int) _listMultipartUploads;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, Pointer<Utf8>)
+  _abortMultipartUpload;
+  late final Pointer<Utf8> Function(int, int) _abortStaleMultipartUploads;
+  late final int Function(int, Pointer<Utf8>) _checkKeyBucketExist;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, Pointer<Utf8>)
+  _statObject;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>)
+  _setClientEncryptionKey;
+  late final Pointer<Utf8> Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+  )
+  _updateCredentials;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>) _setBucketRegion;
+  late final Pointer<Utf8> Function(int, int) _setOperationTimeout;
+  late final Pointer<Utf8> Function(int, int, int) _configureRetries;
+  late final void Function(Pointer<NativeFunction<CredentialsCallbackNative>>)
+  _setCredentialsCallback;
+  late final int Function(int, Pointer<Utf8>) _provideCredentials;
+  late final void Function(Pointer<NativeFunction<ProgressCallbackNative>>)
+  _setProgressCallback;
+  late final void Function(Pointer<NativeFunction<ChunkCallbackNative>>)
+  _setStreamCallback;
+  late final Pointer<Utf8> Function(int, Pointer<Utf8>, int, Pointer<Utf8>)
+  _downloadStream;
+  late final int Function(int) _cancelDownloadStream;
+  late final void Function(Pointer<NativeFunction<CompletionCallbackNative>>)
+  _setCompletionCallback;
+  late final int Function(int, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>)
+  _uploadAsync;
+  late final int Function(int, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>)
+  _downloadAsync;
+  late final int Function(int, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>)
+  _uploadDirectoryAsync;
+  late final int Function(int, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>)
+  _downloadPrefixAsync;
+  late final int Function(int, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>)
+  _syncUpAsync;
+  late final int Function(int, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>)
+  _syncDownAsync;
+  late final int Function(
+    int,
+    Pointer<Utf8>,
+    Pointer<Utf8>,
+    int,
+    Pointer<Utf8>,
+  )
+  _downloadManyAsync;
+  late final int Function(int) _cancelOperation;
+  late final Pointer<Utf8> Function(int) _closeBucket;
+  late final Pointer<Utf8> Function(int) _setBandwidthLimit;
+  late final Pointer<Utf8> Function(Pointer<Utf8>) _setLogLevel;
+  late final void Function(Pointer<NativeFunction<LogCallbackNative>>)
+  _setLogCallback;
+  late final Pointer<Utf8> Function(Pointer<Utf8>) _setLogFile;
+  late final void Function(Pointer<Utf8>) _freeCString;
 
   /// Create S3FFIBindings with optional custom library path
   ///
@@ -41,7 +287,7 @@ class S3FFIBindings {
     _initBucket = _dylib
         .lookup<
           NativeFunction<
-            Void Function(
+            Pointer<Utf8> Function(
               Pointer<Utf8>,
               Pointer<Utf8>,
               Pointer<Utf8>,
@@ -49,243 +295,2337 @@ class S3FFIBindings {
               Pointer<Utf8>,
               Pointer<Utf8>,
               Pointer<Utf8>,
+              Int32,
+              Int32,
+              Pointer<Utf8>,
             )
           >
         >('initBucket')
         .asFunction();
     _upload = _dylib
         .lookup<
-          NativeFunction<Pointer<Utf8> Function(Pointer<Utf8>, Pointer<Utf8>)>
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+            )
+          >
         >('upload')
         .asFunction();
+    _uploadWithChecksum = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+            )
+          >
+        >('uploadWithChecksum')
+        .asFunction();
+    _uploadDirectory = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+            )
+          >
+        >('uploadDirectory')
+        .asFunction();
+    _downloadPrefix = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+            )
+          >
+        >('downloadPrefix')
+        .asFunction();
+    _syncUp = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+            )
+          >
+        >('syncUp')
+        .asFunction();
+    _syncDown = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+            )
+          >
+        >('syncDown')
+        .asFunction();
+    _uploadBytes = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Uint8>,
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+            )
+          >
+        >('uploadBytes')
+        .asFunction();
     _list = _dylib
-        .lookup<NativeFunction<Pointer<Utf8> Function()>>('list')
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64)>>('list')
+        .asFunction();
+    _listPage = _dylib
+        .lookup<
+          NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>, Int32)>
+        >('listPage')
+        .asFunction();
+    _listBuckets = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64)>>('listBuckets')
+        .asFunction();
+    _bucketExists = _dylib
+        .lookup<NativeFunction<Int32 Function(Int64)>>('bucketExists')
+        .asFunction();
+    _bucketStatus = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64)>>('bucketStatus')
+        .asFunction();
+    _getDiagnostics = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Int32)>>(
+          'getDiagnostics',
+        )
+        .asFunction();
+    _getMetrics = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Int32)>>(
+          'getMetrics',
+        )
+        .asFunction();
+    _createBucket = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'createBucket',
+        )
+        .asFunction();
+    _deleteBucket = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'deleteBucket',
+        )
+        .asFunction();
+    _setBucketVersioning = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Int32)>>(
+          'setBucketVersioning',
+        )
+        .asFunction();
+    _getBucketVersioning = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64)>>(
+          'getBucketVersioning',
+        )
+        .asFunction();
+    _listObjectVersions = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'listObjectVersions',
+        )
+        .asFunction();
+    _setObjectRetention = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('setObjectRetention')
+        .asFunction();
+    _getObjectRetention = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('getObjectRetention')
+        .asFunction();
+    _setObjectLegalHold = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Int32, Pointer<Utf8>)
+          >
+        >('setObjectLegalHold')
+        .asFunction();
+    _getObjectLegalHold = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('getObjectLegalHold')
+        .asFunction();
+    _setBucketLifecycle = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'setBucketLifecycle',
+        )
+        .asFunction();
+    _getBucketLifecycle = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64)>>(
+          'getBucketLifecycle',
+        )
+        .asFunction();
+    _setBucketCors = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'setBucketCors',
+        )
+        .asFunction();
+    _getBucketCors = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64)>>('getBucketCors')
+        .asFunction();
+    _setBucketPolicy = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'setBucketPolicy',
+        )
+        .asFunction();
+    _getBucketPolicy = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64)>>(
+          'getBucketPolicy',
+        )
+        .asFunction();
+    _deleteBucketPolicy = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64)>>(
+          'deleteBucketPolicy',
+        )
+        .asFunction();
+    _setObjectAcl = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('setObjectAcl')
+        .asFunction();
+    _getObjectAcl = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'getObjectAcl',
+        )
+        .asFunction();
+    _putObjectTags = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('putObjectTags')
+        .asFunction();
+    _getObjectTags = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'getObjectTags',
+        )
+        .asFunction();
+    _deleteObjectTags = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'deleteObjectTags',
+        )
+        .asFunction();
+    _listWithPrefix = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('listWithPrefix')
+        .asFunction();
+    _listDetailed = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'listDetailed',
+        )
+        .asFunction();
+    _listGlob = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'listGlob',
+        )
         .asFunction();
     _delete = _dylib
-        .lookup<NativeFunction<Pointer<Utf8> Function(Pointer<Utf8>)>>('delete')
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'delete',
+        )
+        .asFunction();
+    _deleteMany = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'deleteMany',
+        )
+        .asFunction();
+    _deletePrefix = _dylib
+        .lookup<
+          NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>, Int32)>
+        >('deletePrefix')
+        .asFunction();
+
+    _deleteObjectVersion = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('deleteObjectVersion')
+        .asFunction();
+
+    _restoreDeleted = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'restoreDeleted',
+        )
+        .asFunction();
+    _copyObject = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+            )
+          >
+        >('copyObject')
+        .asFunction();
+    _moveObject = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('moveObject')
+        .asFunction();
+    _copyPrefix = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+            )
+          >
+        >('copyPrefix')
+        .asFunction();
+    _mirrorBucket = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Int64, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('mirrorBucket')
         .asFunction();
     _download = _dylib
         .lookup<
-          NativeFunction<Pointer<Utf8> Function(Pointer<Utf8>, Pointer<Utf8>)>
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+            )
+          >
         >('download')
         .asFunction();
-    _getPresignedUrl = _dylib
-        .lookup<NativeFunction<Pointer<Utf8> Function(Pointer<Utf8>, Int32)>>(
-          'getPresignedUrl',
-        )
+    _downloadRange = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Int64,
+              Int64,
+              Pointer<Utf8>,
+            )
+          >
+        >('downloadRange')
         .asFunction();
-    _checkKeyBucketExist = _dylib
-        .lookup<NativeFunction<Int32 Function(Pointer<Utf8>)>>(
-          'checkKeyBucketExist',
-        )
+    _downloadMany = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Int32,
+              Pointer<Utf8>,
+            )
+          >
+        >('downloadMany')
         .asFunction();
+    _downloadBytes = _dylib
+        .lookup<
+          NativeFunction<
+            BytesResult Function(Int64, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('downloadBytes')
+        .asFunction();
+    _freeBytesResult = _dylib
+        .lookup<NativeFunction<Void Function(BytesResult)>>('freeBytesResult')
+        .asFunction();
+    _getPresignedUrl = _dylib
+        .lookup<
+          NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>, Int64)>
+        >('getPresignedUrl')
+        .asFunction();
+    _getPresignedPutUrl = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Int32, Pointer<Utf8>)
+          >
+        >('getPresignedPutUrl')
+        .asFunction();
+    _getPresignedHeadUrl = _dylib
+        .lookup<
+          NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>, Int32)>
+        >('getPresignedHeadUrl')
+        .asFunction();
+    _getPresignedDeleteUrl = _dylib
+        .lookup<
+          NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>, Int32)>
+        >('getPresignedDeleteUrl')
+        .asFunction();
+    _presign = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Int32,
+              Pointer<Utf8>,
+            )
+          >
+        >('presign')
+        .asFunction();
+    _getPresignedPost = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Int32, Pointer<Utf8>)
+          >
+        >('getPresignedPost')
+        .asFunction();
+    _getObjectUrl = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'getObjectUrl',
+        )
+        .asFunction();
+    _listMultipartUploads = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64)>>(
+          'listMultipartUploads',
+        )
+        .asFunction();
+    _abortMultipartUpload = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('abortMultipartUpload')
+        .asFunction();
+    _abortStaleMultipartUploads = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Int32)>>(
+          'abortStaleMultipartUploads',
+        )
+        .asFunction();
+    _checkKeyBucketExist = _dylib
+        .lookup<NativeFunction<Int32 Function(Int64, Pointer<Utf8>)>>(
+          'checkKeyBucketExist',
+        )
+        .asFunction();
+    _statObject = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('statObject')
+        .asFunction();
+    _setClientEncryptionKey = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'setClientEncryptionKey',
+        )
+        .asFunction();
+    _updateCredentials = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+            )
+          >
+        >('updateCredentials')
+        .asFunction();
+    _setBucketRegion = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Pointer<Utf8>)>>(
+          'setBucketRegion',
+        )
+        .asFunction();
+    _setOperationTimeout = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Int32)>>(
+          'setOperationTimeout',
+        )
+        .asFunction();
+    _configureRetries = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64, Int32, Int32)>>(
+          'configureRetries',
+        )
+        .asFunction();
+    _setCredentialsCallback = _dylib
+        .lookup<
+          NativeFunction<
+            Void Function(Pointer<NativeFunction<CredentialsCallbackNative>>)
+          >
+        >('setCredentialsCallback')
+        .asFunction();
+    _provideCredentials = _dylib
+        .lookup<NativeFunction<Int32 Function(Int64, Pointer<Utf8>)>>(
+          'provideCredentials',
+        )
+        .asFunction();
+    _setProgressCallback = _dylib
+        .lookup<
+          NativeFunction<
+            Void Function(Pointer<NativeFunction<ProgressCallbackNative>>)
+          >
+        >('setProgressCallback')
+        .asFunction();
+    _setStreamCallback = _dylib
+        .lookup<
+          NativeFunction<
+            Void Function(Pointer<NativeFunction<ChunkCallbackNative>>)
+          >
+        >('setStreamCallback')
+        .asFunction();
+    _downloadStream = _dylib
+        .lookup<
+          NativeFunction<
+            Pointer<Utf8> Function(Int64, Pointer<Utf8>, Int64, Pointer<Utf8>)
+          >
+        >('downloadStream')
+        .asFunction();
+    _cancelDownloadStream = _dylib
+        .lookup<NativeFunction<Int32 Function(Int64)>>('cancelDownloadStream')
+        .asFunction();
+    _setCompletionCallback = _dylib
+        .lookup<
+          NativeFunction<
+            Void Function(Pointer<NativeFunction<CompletionCallbackNative>>)
+          >
+        >('setCompletionCallback')
+        .asFunction();
+    _uploadAsync = _dylib
+        .lookup<
+          NativeFunction<
+            Int64 Function(Int64, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('uploadAsync')
+        .asFunction();
+    _downloadAsync = _dylib
+        .lookup<
+          NativeFunction<
+            Int64 Function(Int64, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('downloadAsync')
+        .asFunction();
+    _uploadDirectoryAsync = _dylib
+        .lookup<
+          NativeFunction<
+            Int64 Function(Int64, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('uploadDirectoryAsync')
+        .asFunction();
+    _downloadPrefixAsync = _dylib
+        .lookup<
+          NativeFunction<
+            Int64 Function(Int64, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('downloadPrefixAsync')
+        .asFunction();
+    _syncUpAsync = _dylib
+        .lookup<
+          NativeFunction<
+            Int64 Function(Int64, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('syncUpAsync')
+        .asFunction();
+    _syncDownAsync = _dylib
+        .lookup<
+          NativeFunction<
+            Int64 Function(Int64, Pointer<Utf8>, Pointer<Utf8>, Pointer<Utf8>)
+          >
+        >('syncDownAsync')
+        .asFunction();
+    _downloadManyAsync = _dylib
+        .lookup<
+          NativeFunction<
+            Int64 Function(
+              Int64,
+              Pointer<Utf8>,
+              Pointer<Utf8>,
+              Int32,
+              Pointer<Utf8>,
+            )
+          >
+        >('downloadManyAsync')
+        .asFunction();
+    _cancelOperation = _dylib
+        .lookup<NativeFunction<Int32 Function(Int64)>>('cancelOperation')
+        .asFunction();
+    _closeBucket = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64)>>('closeBucket')
+        .asFunction();
+    _setBandwidthLimit = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Int64)>>(
+          'setBandwidthLimit',
+        )
+        .asFunction();
+    _setLogLevel = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Pointer<Utf8>)>>(
+          'setLogLevel',
+        )
+        .asFunction();
+    _setLogCallback = _dylib
+        .lookup<
+          NativeFunction<
+            Void Function(Pointer<NativeFunction<LogCallbackNative>>)
+          >
+        >('setLogCallback')
+        .asFunction();
+    _setLogFile = _dylib
+        .lookup<NativeFunction<Pointer<Utf8> Function(Pointer<Utf8>)>>(
+          'setLogFile',
+        )
+        .asFunction();
+    _freeCString = _dylib
+        .lookup<NativeFunction<Void Function(Pointer<Utf8>)>>('freeCString')
+        .asFunction();
+  }
+
+  /// Load the appropriate shared library based on the platform
+  ///
+  /// Uses [_customLibraryPath] if provided, otherwise uses platform-specific defaults.
+  /// If auto-download is enabled and library is not found, downloads from GitHub releases.
+  DynamicLibrary _loadLibrary() {
+    // If custom path is provided, use it directly
+    final customPath = _customLibraryPath;
+    if (customPath != null && customPath.isNotEmpty) {
+      final fileS3Lib = File(customPath);
+      if (fileS3Lib.existsSync()) {
+        ///TODO: note we should do build amd64,arm64
+        libraryPath = fileS3Lib.path;
+        return DynamicLibrary.open(libraryPath);
+      } else if (!_autoDownload) {
+        throw Exception('Library not found at: $customPath');
+      }
+    }
+
+    // Try platform-specific default paths first
+    String defaultPath;
+    if (Platform.isMacOS) {
+      defaultPath = 'go_ffi/darwin/s3_client_dart.dylib';
+    } else if (Platform.isLinux) {
+      defaultPath = 'go_ffi/linux/s3_client_dart.so';
+    } else if (Platform.isWindows) {
+      defaultPath = 'go_ffi/windows/s3_client_dart.dll';
+    } else {
+      throw UnsupportedError(
+        'Unsupported platform: ${Platform.operatingSystem}',
+      );
+    }
+
+    // Try to load from default path
+    if (File(defaultPath).existsSync()) {
+      libraryPath = defaultPath;
+      return DynamicLibrary.open(libraryPath);
+    }
+
+    // If auto-download is disabled, throw error
+    if (!_autoDownload) {
+      throw Exception(
+        'Library not found at: $defaultPath\n'
+        'Set autoDownload: true to automatically download from GitHub releases.',
+      );
+    }
+
+    // Auto-download from GitHub releases
+    print('Library not found locally, downloading from GitHub releases...');
+    try {
+      // This is synchronous for simplicity - in production you might want async initialization
+      final downloadedPath = _downloadLibrarySync();
+      libraryPath = downloadedPath;
+      return DynamicLibrary.open(libraryPath);
+    } catch (e) {
+      throw Exception(
+        'Failed to download library: $e\n'
+        'You can manually download from: '
+        'https://github.com/liodali/ContainerPub/releases',
+      );
+    }
+  }
+
+  /// Synchronous wrapper for library download
+  String _downloadLibrarySync() {
+    // Use a simple synchronous approach
+    String? downloadedPath;
+    Exception? error;
+
+    LibraryDownloader.downloadLibrary()
+        .then((path) {
+          downloadedPath = path;
+        })
+        .catchError((e) {
+          error = e as Exception;
+        });
+
+    // Wait for download to complete (simple polling)
+    final startTime = DateTime.now();
+    while (downloadedPath == null && error == null) {
+      if (DateTime.now().difference(startTime).inSeconds > 60) {
+        throw Exception('Download timeout after 60 seconds');
+      }
+      sleep(Duration(milliseconds: 100));
+    }
+
+    if (error != null) {
+      throw error!;
+    }
+
+    return downloadedPath!;
+  }
+
+  /// Initialize the S3 bucket with credentials, region, and endpoint
+  ///
+  /// [optionsJson] - JSON object of bucket options, empty for none
+  ///
+  /// Returns the JSON result envelope carrying the bucket handle to pass to
+  /// every other call
+  String initBucket({
+    required String endpoint,
+    required String bucketName,
+    required String accessKeyId,
+    required String secretAccessKey,
+    required String sessionToken,
+    required String region,
+    required String accountId,
+    bool usePathStyle = true,
+    bool insecureSkipVerify = false,
+    String optionsJson = '',
+  }) {
+    final endpointPtr = endpoint.toNativeUtf8();
+    final bucketNamePtr = bucketName.toNativeUtf8();
+    final accessKeyIdPtr = accessKeyId.toNativeUtf8();
+    final secretAccessKeyPtr = secretAccessKey.toNativeUtf8();
+    final sessionTokenPtr = sessionToken.toNativeUtf8();
+    final regionPtr = region.toNativeUtf8();
+    final accountIdPtr = accountId.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _initBucket(
+        endpointPtr,
+        bucketNamePtr,
+        accessKeyIdPtr,
+        secretAccessKeyPtr,
+        sessionTokenPtr,
+        regionPtr,
+        accountIdPtr,
+        usePathStyle ? 1 : 0,
+        insecureSkipVerify ? 1 : 0,
+        optionsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(endpointPtr);
+      malloc.free(bucketNamePtr);
+      malloc.free(accessKeyIdPtr);
+      malloc.free(secretAccessKeyPtr);
+      malloc.free(sessionTokenPtr);
+      malloc.free(regionPtr);
+      malloc.free(accountIdPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Upload a file to S3
+  ///
+  /// [optionsJson] - JSON object of upload options, empty for none
+  String upload(
+    int handle,
+    String filePath,
+    String objectKey,
+    String optionsJson,
+  ) {
+    final filePathPtr = filePath.toNativeUtf8();
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _upload(
+        handle,
+        filePathPtr,
+        objectKeyPtr,
+        optionsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(filePathPtr);
+      malloc.free(objectKeyPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Upload a file to S3 along with a checksum S3 verifies and stores
+  ///
+  /// [algorithm] - `CRC32`, `CRC32C`, `SHA1`, `SHA256` or `CRC64NVME`
+  String uploadWithChecksum(
+    int handle,
+    String filePath,
+    String objectKey,
+    String algorithm,
+  ) {
+    final filePathPtr = filePath.toNativeUtf8();
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final algorithmPtr = algorithm.toNativeUtf8();
+
+    try {
+      final resultPtr = _uploadWithChecksum(
+        handle,
+        filePathPtr,
+        objectKeyPtr,
+        algorithmPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(filePathPtr);
+      malloc.free(objectKeyPtr);
+      malloc.free(algorithmPtr);
+    }
+  }
+
+  /// Upload every file under a local directory
+  ///
+  /// [optionsJson] - JSON object of upload options and concurrency, empty
+  /// for none
+  String uploadDirectory(
+    int handle,
+    String localDir,
+    String keyPrefix,
+    String optionsJson,
+  ) {
+    final localDirPtr = localDir.toNativeUtf8();
+    final keyPrefixPtr = keyPrefix.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _uploadDirectory(
+        handle,
+        localDirPtr,
+        keyPrefixPtr,
+        optionsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(localDirPtr);
+      malloc.free(keyPrefixPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Download every object under a key prefix
+  ///
+  /// [optionsJson] - JSON object of download options and concurrency, empty
+  /// for none
+  String downloadPrefix(
+    int handle,
+    String keyPrefix,
+    String localDir,
+    String optionsJson,
+  ) {
+    final keyPrefixPtr = keyPrefix.toNativeUtf8();
+    final localDirPtr = localDir.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _downloadPrefix(
+        handle,
+        keyPrefixPtr,
+        localDirPtr,
+        optionsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(keyPrefixPtr);
+      malloc.free(localDirPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Upload the files of a local directory that differ from the bucket
+  ///
+  /// [optionsJson] - JSON object of upload and sync options, empty for
+  /// none
+  String syncUp(
+    int handle,
+    String localDir,
+    String keyPrefix,
+    String optionsJson,
+  ) {
+    final localDirPtr = localDir.toNativeUtf8();
+    final keyPrefixPtr = keyPrefix.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _syncUp(
+        handle,
+        localDirPtr,
+        keyPrefixPtr,
+        optionsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(localDirPtr);
+      malloc.free(keyPrefixPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Download the objects under a key prefix that differ from a local directory
+  ///
+  /// [optionsJson] - JSON object of download and sync options, empty for
+  /// none
+  String syncDown(
+    int handle,
+    String keyPrefix,
+    String localDir,
+    String optionsJson,
+  ) {
+    final keyPrefixPtr = keyPrefix.toNativeUtf8();
+    final localDirPtr = localDir.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _syncDown(
+        handle,
+        keyPrefixPtr,
+        localDirPtr,
+        optionsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(keyPrefixPtr);
+      malloc.free(localDirPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Upload an in-memory buffer to S3
+  String uploadBytes(
+    int handle,
+    Uint8List data,
+    String objectKey,
+    String contentType,
+  ) {
+    // Allocate at least one byte so an empty upload still passes a valid pointer
+    final dataPtr = malloc<Uint8>(data.isEmpty ? 1 : data.length);
+    dataPtr.asTypedList(data.length).setAll(0, data);
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final contentTypePtr = contentType.toNativeUtf8();
+
+    try {
+      final resultPtr = _uploadBytes(
+        handle,
+        dataPtr,
+        data.length,
+        objectKeyPtr,
+        contentTypePtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(dataPtr);
+      malloc.free(objectKeyPtr);
+      malloc.free(contentTypePtr);
+    }
+  }
+
+  /// List all objects in the bucket
+  String list(int handle) {
+    final resultPtr = _list(handle);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// List a single page of keys
+  ///
+  /// [continuationToken] - Token of the page to list, empty for the first one
+  /// [maxKeys] - Maximum number of keys of the page, 0 for the default of 1000
+  String listPage(int handle, String continuationToken, int maxKeys) {
+    final continuationTokenPtr = continuationToken.toNativeUtf8();
+
+    try {
+      final resultPtr = _listPage(handle, continuationTokenPtr, maxKeys);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(continuationTokenPtr);
+    }
+  }
+
+  /// List the buckets visible to the credentials
+  String listBuckets(int handle) {
+    final resultPtr = _listBuckets(handle);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// Check whether the configured bucket exists
+  ///
+  /// Returns 1 if the bucket exists, 0 if it does not, -1 if the check failed
+  int bucketExists(int handle) {
+    return _bucketExists(handle);
+  }
+
+  /// Check whether the configured bucket exists and is accessible
+  String bucketStatus(int handle) {
+    final resultPtr = _bucketStatus(handle);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// Get the summaries of the bucket's latest requests
+  String getDiagnostics(int handle, bool clear) {
+    final resultPtr = _getDiagnostics(handle, clear ? 1 : 0);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// Get the traffic counters of the bucket
+  String getMetrics(int handle, bool reset) {
+    final resultPtr = _getMetrics(handle, reset ? 1 : 0);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// Create the configured bucket
+  ///
+  /// [optionsJson] - JSON object of creation options, empty for none
+  String createBucket(int handle, String optionsJson) {
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _createBucket(handle, optionsJsonPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Delete the configured bucket
+  ///
+  /// [optionsJson] - JSON object of deletion options, empty for none
+  String deleteBucket(int handle, String optionsJson) {
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _deleteBucket(handle, optionsJsonPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Enable or suspend versioning of the configured bucket
+  String setBucketVersioning(int handle, bool enabled) {
+    final resultPtr = _setBucketVersioning(handle, enabled ? 1 : 0);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// Get the versioning status of the configured bucket
+  String getBucketVersioning(int handle) {
+    final resultPtr = _getBucketVersioning(handle);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// List the versions and delete markers of objects under a prefix
+  String listObjectVersions(int handle, String prefix) {
+    final prefixPtr = prefix.toNativeUtf8();
+
+    try {
+      final resultPtr = _listObjectVersions(handle, prefixPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(prefixPtr);
+    }
+  }
+
+  /// Place a WORM retention on an object
+  String setObjectRetention(int handle, String objectKey, String optionsJson) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _setObjectRetention(
+        handle,
+        objectKeyPtr,
+        optionsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Get the retention of an object
+  String getObjectRetention(int handle, String objectKey, String versionId) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final versionIdPtr = versionId.toNativeUtf8();
+
+    try {
+      final resultPtr = _getObjectRetention(handle, objectKeyPtr, versionIdPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(versionIdPtr);
+    }
+  }
+
+  /// Place or lift a legal hold on an object
+  String setObjectLegalHold(
+    int handle,
+    String objectKey,
+    bool enabled,
+    String versionId,
+  ) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final versionIdPtr = versionId.toNativeUtf8();
+
+    try {
+      final resultPtr = _setObjectLegalHold(
+        handle,
+        objectKeyPtr,
+        enabled ? 1 : 0,
+        versionIdPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(versionIdPtr);
+    }
+  }
+
+  /// Get whether an object is under a legal hold
+  String getObjectLegalHold(int handle, String objectKey, String versionId) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final versionIdPtr = versionId.toNativeUtf8();
+
+    try {
+      final resultPtr = _getObjectLegalHold(handle, objectKeyPtr, versionIdPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(versionIdPtr);
+    }
+  }
+
+  /// Replace the lifecycle rules of the bucket
+  String setBucketLifecycle(int handle, String rulesJson) {
+    final rulesJsonPtr = rulesJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _setBucketLifecycle(handle, rulesJsonPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(rulesJsonPtr);
+    }
+  }
+
+  /// Get the lifecycle rules of the bucket
+  String getBucketLifecycle(int handle) {
+    final resultPtr = _getBucketLifecycle(handle);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// Replace the CORS rules of the bucket
+  String setBucketCors(int handle, String rulesJson) {
+    final rulesJsonPtr = rulesJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _setBucketCors(handle, rulesJsonPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(rulesJsonPtr);
+    }
+  }
+
+  /// Get the CORS rules of the bucket
+  String getBucketCors(int handle) {
+    final resultPtr = _getBucketCors(handle);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// Replace the bucket policy
+  String setBucketPolicy(int handle, String policyJson) {
+    final policyJsonPtr = policyJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _setBucketPolicy(handle, policyJsonPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(policyJsonPtr);
+    }
+  }
+
+  /// Get the bucket policy
+  String getBucketPolicy(int handle) {
+    final resultPtr = _getBucketPolicy(handle);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// Remove the bucket policy
+  String deleteBucketPolicy(int handle) {
+    final resultPtr = _deleteBucketPolicy(handle);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// Replace the ACL of an object with a canned ACL
+  String setObjectAcl(int handle, String objectKey, String acl) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final aclPtr = acl.toNativeUtf8();
+
+    try {
+      final resultPtr = _setObjectAcl(handle, objectKeyPtr, aclPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(aclPtr);
+    }
+  }
+
+  /// Get the ACL of an object
+  String getObjectAcl(int handle, String objectKey) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+
+    try {
+      final resultPtr = _getObjectAcl(handle, objectKeyPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+    }
+  }
+
+  /// Replace the tags of an object
+  ///
+  /// [tagsJson] - JSON object of tag keys to string values
+  String putObjectTags(int handle, String objectKey, String tagsJson) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final tagsJsonPtr = tagsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _putObjectTags(handle, objectKeyPtr, tagsJsonPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(tagsJsonPtr);
+    }
+  }
+
+  /// Get the tags of an object
+  String getObjectTags(int handle, String objectKey) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+
+    try {
+      final resultPtr = _getObjectTags(handle, objectKeyPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+    }
+  }
+
+  /// Remove every tag from an object
+  String deleteObjectTags(int handle, String objectKey) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+
+    try {
+      final resultPtr = _deleteObjectTags(handle, objectKeyPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+    }
+  }
+
+  /// List the keys and common prefixes directly under a prefix
+  ///
+  /// [delimiter] - Groups the keys into common prefixes, empty for a flat
+  /// listing
+  String listWithPrefix(int handle, String prefix, String delimiter) {
+    final prefixPtr = prefix.toNativeUtf8();
+    final delimiterPtr = delimiter.toNativeUtf8();
+
+    try {
+      final resultPtr = _listWithPrefix(handle, prefixPtr, delimiterPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(prefixPtr);
+      malloc.free(delimiterPtr);
+    }
+  }
+
+  /// List objects under a prefix with their metadata
+  String listDetailed(int handle, String prefix) {
+    final prefixPtr = prefix.toNativeUtf8();
+
+    try {
+      final resultPtr = _listDetailed(handle, prefixPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(prefixPtr);
+    }
+  }
+
+  /// List the keys matching a glob pattern
+  String listGlob(int handle, String pattern) {
+    final patternPtr = pattern.toNativeUtf8();
+
+    try {
+      final resultPtr = _listGlob(handle, patternPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(patternPtr);
+    }
+  }
+
+  /// Delete an object from S3
+  String delete(int handle, String objectKey) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+
+    try {
+      final resultPtr = _delete(handle, objectKeyPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+    }
+  }
+
+  /// Delete a JSON array of keys in batches of up to 1000
+  String deleteMany(int handle, String objectKeysJson) {
+    final objectKeysJsonPtr = objectKeysJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _deleteMany(handle, objectKeysJsonPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeysJsonPtr);
+    }
+  }
+
+  /// Delete every object under a non-empty prefix
+  ///
+  /// [dryRun] - Only return the keys that would be deleted
+  String deletePrefix(int handle, String prefix, bool dryRun) {
+    final prefixPtr = prefix.toNativeUtf8();
+
+    try {
+      final resultPtr = _deletePrefix(handle, prefixPtr, dryRun ? 1 : 0);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(prefixPtr);
+    }
+  }
+
+  /// Permanently delete one version of an object
+  String deleteObjectVersion(int handle, String objectKey, String versionId) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final versionIdPtr = versionId.toNativeUtf8();
+
+    try {
+      final resultPtr = _deleteObjectVersion(
+        handle,
+        objectKeyPtr,
+        versionIdPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(versionIdPtr);
+    }
+  }
+
+  /// Remove the latest delete marker of an object
+  String restoreDeleted(int handle, String objectKey) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+
+    try {
+      final resultPtr = _restoreDeleted(handle, objectKeyPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+    }
+  }
+
+  /// Copy an object to another key of the bucket server-side
+  ///
+  /// [optionsJson] - JSON object of copy options, empty for none
+  String copyObject(
+    int handle,
+    String sourceKey,
+    String destKey,
+    String optionsJson,
+  ) {
+    final sourceKeyPtr = sourceKey.toNativeUtf8();
+    final destKeyPtr = destKey.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _copyObject(
+        handle,
+        sourceKeyPtr,
+        destKeyPtr,
+        optionsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(sourceKeyPtr);
+      malloc.free(destKeyPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Move (rename) an object within the bucket
+  String moveObject(int handle, String sourceKey, String destKey) {
+    final sourceKeyPtr = sourceKey.toNativeUtf8();
+    final destKeyPtr = destKey.toNativeUtf8();
+
+    try {
+      final resultPtr = _moveObject(handle, sourceKeyPtr, destKeyPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(sourceKeyPtr);
+      malloc.free(destKeyPtr);
+    }
+  }
+
+  /// Copy every object under a prefix to another prefix server-side
+  ///
+  /// [optionsJson] - JSON object of copy options and concurrency, empty for
+  /// none
+  String copyPrefix(
+    int handle,
+    String srcPrefix,
+    String dstPrefix,
+    String optionsJson,
+  ) {
+    final srcPrefixPtr = srcPrefix.toNativeUtf8();
+    final dstPrefixPtr = dstPrefix.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _copyPrefix(
+        handle,
+        srcPrefixPtr,
+        dstPrefixPtr,
+        optionsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(srcPrefixPtr);
+      malloc.free(dstPrefixPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Mirror the objects of one bucket into another
+  ///
+  /// [optionsJson] - JSON object of mirror options, empty for none
+  String mirrorBucket(
+    int sourceHandle,
+    int destHandle,
+    String prefix,
+    String optionsJson,
+  ) {
+    final prefixPtr = prefix.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _mirrorBucket(
+        sourceHandle,
+        destHandle,
+        prefixPtr,
+        optionsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(prefixPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Download an object from S3 to a local file
+  ///
+  /// [optionsJson] - JSON object of download options, empty for none
+  String download(
+    int handle,
+    String objectKey,
+    String destinationPath,
+    String optionsJson,
+  ) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final destinationPathPtr = destinationPath.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _download(
+        handle,
+        objectKeyPtr,
+        destinationPathPtr,
+        optionsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(destinationPathPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Download [length] bytes of an object starting at [offset], everything
+  /// from [offset] on when [length] is 0
+  ///
+  /// An [offset] of 0 (re)creates the destination file, any other appends to
+  /// it
+  ///
+  /// [optionsJson] - JSON object of read options and headers, empty for none
+  String downloadRange(
+    int handle,
+    String objectKey,
+    String destinationPath,
+    int offset,
+    int length,
+    String optionsJson,
+  ) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final destinationPathPtr = destinationPath.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _downloadRange(
+        handle,
+        objectKeyPtr,
+        destinationPathPtr,
+        offset,
+        length,
+        optionsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(destinationPathPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Download keysJson[i] to destPathsJson[i] for two JSON arrays
+  ///
+  /// [concurrency] - Number of objects downloaded at once, 0 for the default
+  /// [optionsJson] - JSON object of download options applied to every object
+  /// and of `versionIds`, or empty
+  String downloadMany(
+    int handle,
+    String keysJson,
+    String destPathsJson,
+    int concurrency,
+    String optionsJson,
+  ) {
+    final keysJsonPtr = keysJson.toNativeUtf8();
+    final destPathsJsonPtr = destPathsJson.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _downloadMany(
+        handle,
+        keysJsonPtr,
+        destPathsJsonPtr,
+        concurrency,
+        optionsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(keysJsonPtr);
+      malloc.free(destPathsJsonPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Download an object from S3 into memory
+  ///
+  /// Returns the object's bytes, or the JSON error envelope as a [String]
+  Object downloadBytes(int handle, String objectKey, String optionsJson) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final result = _downloadBytes(handle, objectKeyPtr, optionsJsonPtr);
+      try {
+        if (result.error != nullptr) {
+          return result.error.toDartString();
+        }
+        // Copy out of the Go buffer before it is released
+        return Uint8List.fromList(result.data.asTypedList(result.length));
+      } finally {
+        _freeBytesResult(result);
+      }
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Get a presigned URL for an object
+  String getPresignedUrl(
+    int handle,
+    String objectKey,
+    int expirationSeconds,
+  ) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+
+    try {
+      final resultPtr = _getPresignedUrl(
+        handle,
+        objectKeyPtr,
+        expirationSeconds,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+    }
+  }
+
+  /// Get a presigned URL for an HTTP PUT uploading an object
+  ///
+  /// [contentType] - `Content-Type` the upload must send, empty to leave it
+  /// unsigned
+  String getPresignedPutUrl(
+    int handle,
+    String objectKey,
+    int expirationSeconds,
+    String contentType,
+  ) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final contentTypePtr = contentType.toNativeUtf8();
+
+    try {
+      final resultPtr = _getPresignedPutUrl(
+        handle,
+        objectKeyPtr,
+        expirationSeconds,
+        contentTypePtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(contentTypePtr);
+    }
+  }
+
+  /// Get a presigned URL for an HTTP HEAD on an object
+  String getPresignedHeadUrl(
+    int handle,
+    String objectKey,
+    int expirationSeconds,
+  ) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+
+    try {
+      final resultPtr = _getPresignedHeadUrl(
+        handle,
+        objectKeyPtr,
+        expirationSeconds,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+    }
+  }
+
+  /// Get a presigned URL for an HTTP DELETE on an object
+  String getPresignedDeleteUrl(
+    int handle,
+    String objectKey,
+    int expirationSeconds,
+  ) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+
+    try {
+      final resultPtr = _getPresignedDeleteUrl(
+        handle,
+        objectKeyPtr,
+        expirationSeconds,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+    }
+  }
+
+  /// Get a presigned URL for any supported HTTP method on an object
+  String presign(
+    int handle,
+    String method,
+    String objectKey,
+    int expirationSeconds,
+    String paramsJson,
+  ) {
+    final methodPtr = method.toNativeUtf8();
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final paramsJsonPtr = paramsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _presign(
+        handle,
+        methodPtr,
+        objectKeyPtr,
+        expirationSeconds,
+        paramsJsonPtr,
+      );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(methodPtr);
+      malloc.free(objectKeyPtr);
+      malloc.free(paramsJsonPtr);
+    }
   }
 
-  /// Load the appropriate shared library based on the platform
+  /// Get a presigned POST uploading an object with an HTML form
   ///
-  /// Uses [_customLibraryPath] if provided, otherwise uses platform-specific defaults.
-  /// If auto-download is enabled and library is not found, downloads from GitHub releases.
-  DynamicLibrary _loadLibrary() {
-    // If custom path is provided, use it directly
-    final customPath = _customLibraryPath;
-    if (customPath != null && customPath.isNotEmpty) {
-      final fileS3Lib = File(customPath);
-      if (fileS3Lib.existsSync()) {
-        ///TODO: note we should do build amd64,arm64
-        return DynamicLibrary.open(fileS3Lib.path);
-      } else if (!_autoDownload) {
-        throw Exception('Library not found at: $customPath');
-      }
-    }
+  /// [optionsJson] - JSON object of size and content type restrictions,
+  /// empty for none
+  String getPresignedPost(
+    int handle,
+    String objectKey,
+    int expirationSeconds,
+    String optionsJson,
+  ) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
 
-    // Try platform-specific default paths first
-    String defaultPath;
-    if (Platform.isMacOS) {
-      defaultPath = 'go_ffi/darwin/s3_client_dart.dylib';
-    } else if (Platform.isLinux) {
-      defaultPath = 'go_ffi/linux/s3_client_dart.so';
-    } else if (Platform.isWindows) {
-      defaultPath = 'go_ffi/windows/s3_client_dart.dll';
-    } else {
-      throw UnsupportedError(
-        'Unsupported platform: ${Platform.operatingSystem}',
+    try {
+      final resultPtr = _getPresignedPost(
+        handle,
+        objectKeyPtr,
+        expirationSeconds,
+        optionsJsonPtr,
       );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(optionsJsonPtr);
     }
+  }
 
-    // Try to load from default path
-    if (File(defaultPath).existsSync()) {
-      return DynamicLibrary.open(defaultPath);
-    }
+  /// Build the unsigned URL of an object
+  String getObjectUrl(int handle, String objectKey) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
 
-    // If auto-download is disabled, throw error
-    if (!_autoDownload) {
-      throw Exception(
-        'Library not found at: $defaultPath\n'
-        'Set autoDownload: true to automatically download from GitHub releases.',
-      );
+    try {
+      final resultPtr = _getObjectUrl(handle, objectKeyPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
     }
+  }
+
+  /// List the multipart uploads that were neither completed nor aborted
+  String listMultipartUploads(int handle) {
+    final resultPtr = _listMultipartUploads(handle);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// Abort a multipart upload, discarding its uploaded parts
+  String abortMultipartUpload(int handle, String objectKey, String uploadId) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final uploadIdPtr = uploadId.toNativeUtf8();
 
-    // Auto-download from GitHub releases
-    print('Library not found locally, downloading from GitHub releases...');
     try {
-      // This is synchronous for simplicity - in production you might want async initialization
-      final downloadedPath = _downloadLibrarySync();
-      return DynamicLibrary.open(downloadedPath);
-    } catch (e) {
-      throw Exception(
-        'Failed to download library: $e\n'
-        'You can manually download from: '
-        'https://github.com/liodali/ContainerPub/releases',
+      final resultPtr = _abortMultipartUpload(
+        handle,
+        objectKeyPtr,
+        uploadIdPtr,
       );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(uploadIdPtr);
     }
   }
 
-  /// Synchronous wrapper for library download
-  String _downloadLibrarySync() {
-    // Use a simple synchronous approach
-    String? downloadedPath;
-    Exception? error;
+  /// Abort the multipart uploads initiated more than [olderThanSeconds] ago
+  String abortStaleMultipartUploads(int handle, int olderThanSeconds) {
+    final resultPtr = _abortStaleMultipartUploads(handle, olderThanSeconds);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
 
-    LibraryDownloader.downloadLibrary()
-        .then((path) {
-          downloadedPath = path;
-        })
-        .catchError((e) {
-          error = e as Exception;
-        });
+  /// Check if an object exists in the bucket
+  ///
+  /// Returns 1 if the object exists, 0 if it does not, -1 if the check failed
+  int checkKeyBucketExist(int handle, String objectKey) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
 
-    // Wait for download to complete (simple polling)
-    final startTime = DateTime.now();
-    while (downloadedPath == null && error == null) {
-      if (DateTime.now().difference(startTime).inSeconds > 60) {
-        throw Exception('Download timeout after 60 seconds');
-      }
-      sleep(Duration(milliseconds: 100));
+    try {
+      return _checkKeyBucketExist(handle, objectKeyPtr);
+    } finally {
+      malloc.free(objectKeyPtr);
     }
+  }
 
-    if (error != null) {
-      throw error!;
+  /// Get an object's metadata without downloading it
+  ///
+  /// [optionsJson] - JSON object of options, empty for none
+  String statObject(int handle, String objectKey, String optionsJson) {
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      final resultPtr = _statObject(handle, objectKeyPtr, optionsJsonPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(objectKeyPtr);
+      malloc.free(optionsJsonPtr);
     }
+  }
 
-    return downloadedPath!;
+  /// Enable client-side encryption with a base64 master key, empty disables it
+  String setClientEncryptionKey(int handle, String masterKeyBase64) {
+    final masterKeyPtr = masterKeyBase64.toNativeUtf8();
+
+    try {
+      final resultPtr = _setClientEncryptionKey(handle, masterKeyPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
+    } finally {
+      malloc.free(masterKeyPtr);
+    }
   }
 
-  /// Initialize the S3 bucket with credentials, region, and endpoint
-  void initBucket({
-    required String endpoint,
-    required String bucketName,
-    required String accessKeyId,
-    required String secretAccessKey,
-    required String sessionToken,
-    required String region,
-    required String accountId,
-  }) {
-    final endpointPtr = endpoint.toNativeUtf8();
-    final bucketNamePtr = bucketName.toNativeUtf8();
+  /// Replace the bucket's credentials, keeping the handle
+  String updateCredentials(
+    int handle,
+    String accessKeyId,
+    String secretAccessKey,
+    String sessionToken,
+  ) {
     final accessKeyIdPtr = accessKeyId.toNativeUtf8();
     final secretAccessKeyPtr = secretAccessKey.toNativeUtf8();
     final sessionTokenPtr = sessionToken.toNativeUtf8();
-    final regionPtr = region.toNativeUtf8();
-    final accountIdPtr = accountId.toNativeUtf8();
 
     try {
-      _initBucket(
-        endpointPtr,
-        bucketNamePtr,
+      final resultPtr = _updateCredentials(
+        handle,
         accessKeyIdPtr,
         secretAccessKeyPtr,
         sessionTokenPtr,
-        regionPtr,
-        accountIdPtr,
       );
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
     } finally {
-      malloc.free(endpointPtr);
-      malloc.free(bucketNamePtr);
       malloc.free(accessKeyIdPtr);
       malloc.free(secretAccessKeyPtr);
       malloc.free(sessionTokenPtr);
-      malloc.free(regionPtr);
-      malloc.free(accountIdPtr);
     }
   }
 
-  /// Upload a file to S3
-  String upload(String filePath, String objectKey) {
-    final filePathPtr = filePath.toNativeUtf8();
-    final objectKeyPtr = objectKey.toNativeUtf8();
+  /// Change the region of the bucket's requests, keeping the handle
+  String setBucketRegion(int handle, String region) {
+    final regionPtr = region.toNativeUtf8();
 
     try {
-      final resultPtr = _upload(filePathPtr, objectKeyPtr);
+      final resultPtr = _setBucketRegion(handle, regionPtr);
       final result = resultPtr.toDartString();
-      malloc.free(resultPtr);
+      _freeCString(resultPtr);
       return result;
     } finally {
-      malloc.free(filePathPtr);
-      malloc.free(objectKeyPtr);
+      malloc.free(regionPtr);
     }
   }
 
-  /// List all objects in the bucket
-  String list() {
-    final resultPtr = _list();
+  /// Bound every subsequent call on the bucket, 0 disables the timeout
+  String setOperationTimeout(int handle, int timeoutSeconds) {
+    final resultPtr = _setOperationTimeout(handle, timeoutSeconds);
     final result = resultPtr.toDartString();
-    malloc.free(resultPtr);
+    _freeCString(resultPtr);
     return result;
   }
 
-  /// Delete an object from S3
-  String delete(String objectKey) {
+  /// Replace the bucket's retry behaviour
+  ///
+  /// [maxAttempts] - Attempts including the first, 0 or 1 for a single one
+  /// [maxBackoffSeconds] - Cap of the delay between attempts, 0 for the default
+  String configureRetries(int handle, int maxAttempts, int maxBackoffSeconds) {
+    final resultPtr = _configureRetries(handle, maxAttempts, maxBackoffSeconds);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// Register the function the Go layer asks for fresh credentials
+  ///
+  /// It is called from a Go thread, so [callback] must come from a
+  /// `NativeCallable.listener`
+  void setCredentialsCallback(
+    Pointer<NativeFunction<CredentialsCallbackNative>> callback,
+  ) {
+    _setCredentialsCallback(callback);
+  }
+
+  /// Answer a credentials request
+  ///
+  /// Returns false if the request is no longer pending
+  bool provideCredentials(int requestId, String credentialsJson) {
+    final credentialsJsonPtr = credentialsJson.toNativeUtf8();
+
+    try {
+      return _provideCredentials(requestId, credentialsJsonPtr) == 1;
+    } finally {
+      malloc.free(credentialsJsonPtr);
+    }
+  }
+
+  /// Register the function called with the bytes transferred and the total
+  /// bytes, -1 when unknown, while uploads and downloads run, `nullptr`
+  /// unregisters it
+  ///
+  /// It is called from Go threads, so [callback] must come from a
+  /// `NativeCallable.listener`. Transfers keep the callback registered when
+  /// they started, so it must stay open until they finish.
+  void setProgressCallback(
+    Pointer<NativeFunction<ProgressCallbackNative>> callback,
+  ) {
+    _setProgressCallback(callback);
+  }
+
+  /// Register the function `downloadStream` hands chunks to
+  ///
+  /// It is called synchronously on the thread calling `downloadStream`, so
+  /// [callback] can be a `NativeCallable.isolateLocal` of the calling isolate.
+  /// The chunk is only valid during the call.
+  void setStreamCallback(
+    Pointer<NativeFunction<ChunkCallbackNative>> callback,
+  ) {
+    _setStreamCallback(callback);
+  }
+
+  /// Read an object in chunks handed to the stream callback, blocking until
+  /// the whole object was read
+  ///
+  /// [streamId] - Id greater than 0, unique among running streams
+  /// [optionsJson] - JSON object of options as for `downloadRange`, or empty
+  String downloadStream(
+    int handle,
+    String objectKey,
+    int streamId,
+    String optionsJson,
+  ) {
     final objectKeyPtr = objectKey.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
 
     try {
-      final resultPtr = _delete(objectKeyPtr);
+      final resultPtr = _downloadStream(
+        handle,
+        objectKeyPtr,
+        streamId,
+        optionsJsonPtr,
+      );
       final result = resultPtr.toDartString();
-      malloc.free(resultPtr);
+      _freeCString(resultPtr);
       return result;
     } finally {
       malloc.free(objectKeyPtr);
+      malloc.free(optionsJsonPtr);
     }
   }
 
-  /// Download an object from S3 to a local file
-  String download(String objectKey, String destinationPath) {
+  /// Abort the `downloadStream` running under [streamId]
+  ///
+  /// Returns false if the stream is unknown or already finished
+  bool cancelDownloadStream(int streamId) {
+    return _cancelDownloadStream(streamId) == 1;
+  }
+
+  /// Register the function the async exports deliver their result to
+  ///
+  /// It is called from a Go thread, so [callback] must come from a
+  /// `NativeCallable.listener`, which releases each result with
+  /// [readCompletionResult]
+  void setCompletionCallback(
+    Pointer<NativeFunction<CompletionCallbackNative>> callback,
+  ) {
+    _setCompletionCallback(callback);
+  }
+
+  /// Read and release a result passed to the completion callback
+  String readCompletionResult(Pointer<Utf8> result) {
+    final json = result.toDartString();
+    _freeCString(result);
+    return json;
+  }
+
+  /// Start uploading a file, see `upload`
+  ///
+  /// Returns the operation id, -1 without a completion callback
+  int uploadAsync(
+    int handle,
+    String filePath,
+    String objectKey,
+    String optionsJson,
+  ) {
+    final filePathPtr = filePath.toNativeUtf8();
+    final objectKeyPtr = objectKey.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      return _uploadAsync(handle, filePathPtr, objectKeyPtr, optionsJsonPtr);
+    } finally {
+      malloc.free(filePathPtr);
+      malloc.free(objectKeyPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Start downloading an object to a local file, see `download`
+  ///
+  /// Returns the operation id, -1 without a completion callback
+  int downloadAsync(
+    int handle,
+    String objectKey,
+    String destinationPath,
+    String optionsJson,
+  ) {
     final objectKeyPtr = objectKey.toNativeUtf8();
     final destinationPathPtr = destinationPath.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
 
     try {
-      final resultPtr = _download(objectKeyPtr, destinationPathPtr);
-      final result = resultPtr.toDartString();
-      malloc.free(resultPtr);
-      return result;
+      return _downloadAsync(
+        handle,
+        objectKeyPtr,
+        destinationPathPtr,
+        optionsJsonPtr,
+      );
     } finally {
       malloc.free(objectKeyPtr);
       malloc.free(destinationPathPtr);
+      malloc.free(optionsJsonPtr);
     }
   }
 
-  /// Get a presigned URL for an object
-  String getPresignedUrl(String objectKey, int expirationSeconds) {
-    final objectKeyPtr = objectKey.toNativeUtf8();
+  /// Start uploading a local directory, see `uploadDirectory`
+  ///
+  /// Returns the operation id, -1 without a completion callback
+  int uploadDirectoryAsync(
+    int handle,
+    String localDir,
+    String keyPrefix,
+    String optionsJson,
+  ) {
+    final localDirPtr = localDir.toNativeUtf8();
+    final keyPrefixPtr = keyPrefix.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      return _uploadDirectoryAsync(
+        handle,
+        localDirPtr,
+        keyPrefixPtr,
+        optionsJsonPtr,
+      );
+    } finally {
+      malloc.free(localDirPtr);
+      malloc.free(keyPrefixPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Start downloading a key prefix, see `downloadPrefix`
+  ///
+  /// Returns the operation id, -1 without a completion callback
+  int downloadPrefixAsync(
+    int handle,
+    String keyPrefix,
+    String localDir,
+    String optionsJson,
+  ) {
+    final keyPrefixPtr = keyPrefix.toNativeUtf8();
+    final localDirPtr = localDir.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      return _downloadPrefixAsync(
+        handle,
+        keyPrefixPtr,
+        localDirPtr,
+        optionsJsonPtr,
+      );
+    } finally {
+      malloc.free(keyPrefixPtr);
+      malloc.free(localDirPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Start syncing a local directory up, see `syncUp`
+  ///
+  /// Returns the operation id, -1 without a completion callback
+  int syncUpAsync(
+    int handle,
+    String localDir,
+    String keyPrefix,
+    String optionsJson,
+  ) {
+    final localDirPtr = localDir.toNativeUtf8();
+    final keyPrefixPtr = keyPrefix.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      return _syncUpAsync(handle, localDirPtr, keyPrefixPtr, optionsJsonPtr);
+    } finally {
+      malloc.free(localDirPtr);
+      malloc.free(keyPrefixPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Start syncing a key prefix down, see `syncDown`
+  ///
+  /// Returns the operation id, -1 without a completion callback
+  int syncDownAsync(
+    int handle,
+    String keyPrefix,
+    String localDir,
+    String optionsJson,
+  ) {
+    final keyPrefixPtr = keyPrefix.toNativeUtf8();
+    final localDirPtr = localDir.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      return _syncDownAsync(handle, keyPrefixPtr, localDirPtr, optionsJsonPtr);
+    } finally {
+      malloc.free(keyPrefixPtr);
+      malloc.free(localDirPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Start downloading several objects, see `downloadMany`
+  ///
+  /// Returns the operation id, -1 without a completion callback
+  int downloadManyAsync(
+    int handle,
+    String keysJson,
+    String destPathsJson,
+    int concurrency,
+    String optionsJson,
+  ) {
+    final keysJsonPtr = keysJson.toNativeUtf8();
+    final destPathsJsonPtr = destPathsJson.toNativeUtf8();
+    final optionsJsonPtr = optionsJson.toNativeUtf8();
+
+    try {
+      return _downloadManyAsync(
+        handle,
+        keysJsonPtr,
+        destPathsJsonPtr,
+        concurrency,
+        optionsJsonPtr,
+      );
+    } finally {
+      malloc.free(keysJsonPtr);
+      malloc.free(destPathsJsonPtr);
+      malloc.free(optionsJsonPtr);
+    }
+  }
+
+  /// Abort a running async operation
+  ///
+  /// Returns false if the operation is unknown or already finished
+  bool cancelOperation(int operationId) {
+    return _cancelOperation(operationId) == 1;
+  }
+
+  /// Cancel the bucket's operations and invalidate its handle
+  String closeBucket(int handle) {
+    final resultPtr = _closeBucket(handle);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// Cap the combined throughput of all transfers, 0 removes the cap
+  String setBandwidthLimit(int bytesPerSecond) {
+    final resultPtr = _setBandwidthLimit(bytesPerSecond);
+    final result = resultPtr.toDartString();
+    _freeCString(resultPtr);
+    return result;
+  }
+
+  /// Set the minimum level of logged records: debug, info, warn, error or off
+  String setLogLevel(String level) {
+    final levelPtr = level.toNativeUtf8();
 
     try {
-      final resultPtr = _getPresignedUrl(objectKeyPtr, expirationSeconds);
+      final resultPtr = _setLogLevel(levelPtr);
       final result = resultPtr.toDartString();
-      malloc.free(resultPtr);
+      _freeCString(resultPtr);
       return result;
     } finally {
-      malloc.free(objectKeyPtr);
+      malloc.free(levelPtr);
     }
   }
 
-  /// Check if an object exists in the bucket
-  bool isKeyBucketExist(String objectKey) {
-    final objectKeyPtr = objectKey.toNativeUtf8();
+  /// Register the function log records are delivered to, `nullptr`
+  /// unregisters it
+  ///
+  /// It is called from Go threads, so [callback] must come from a
+  /// `NativeCallable.listener`, which releases each message with
+  /// [readLogMessage]
+  void setLogCallback(Pointer<NativeFunction<LogCallbackNative>> callback) {
+    _setLogCallback(callback);
+  }
+
+  /// Read and release a message passed to the log callback
+  String readLogMessage(Pointer<Utf8> message) {
+    final result = message.toDartString();
+    _freeCString(message);
+    return result;
+  }
+
+  /// Append log records to the file at [path], empty closes the log file
+  String setLogFile(String path) {
+    final pathPtr = path.toNativeUtf8();
 
     try {
-      final result = _checkKeyBucketExist(objectKeyPtr);
-      return result == 1;
+      final resultPtr = _setLogFile(pathPtr);
+      final result = resultPtr.toDartString();
+      _freeCString(resultPtr);
+      return result;
     } finally {
-      malloc.free(objectKeyPtr);
+      malloc.free(pathPtr);
     }
   }
 }
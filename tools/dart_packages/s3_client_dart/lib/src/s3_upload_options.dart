@@ -0,0 +1,92 @@
+import 'dart:convert';
+
+/// Optional settings for an uploaded object
+///
+/// Fields left `null` are not sent, so S3 applies its defaults.
+class UploadOptions {
+  /// MIME type of the object, guessed from the file extension when `null`
+  final String? contentType;
+
+  /// `Cache-Control` header served with the object
+  final String? cacheControl;
+
+  /// `Content-Disposition` header served with the object
+  final String? contentDisposition;
+
+  /// `Content-Encoding` header served with the object
+  final String? contentEncoding;
+
+  /// User metadata, stored as `x-amz-meta-*` headers
+  final Map<String, String>? metadata;
+
+  /// Storage class such as `STANDARD_IA` or `GLACIER`, `STANDARD` when `null`
+  final String? storageClass;
+
+  /// Canned ACL such as `public-read`, for providers relying on ACLs for
+  /// public file hosting
+  final String? acl;
+
+  /// Server-side encryption, `AES256` (SSE-S3) or `aws:kms` (SSE-KMS)
+  final String? serverSideEncryption;
+
+  /// KMS key used with `aws:kms`, the AWS managed key when `null`
+  final String? sseKmsKeyId;
+
+  /// Base64-encoded 256-bit SSE-C key, managed by the caller and never
+  /// stored by the provider; the same key is needed to download the object
+  final String? sseCustomerKey;
+
+  /// Timeout of the upload, overriding the configured default
+  final Duration? timeout;
+
+  /// `gzip` or `zstd` to compress the file while it is uploaded, decompressed
+  /// transparently on download. Sets the `Content-Encoding` header, so it
+  /// can't be combined with [contentEncoding].
+  final String? compression;
+
+  /// Bandwidth cap of the upload in bytes per second, on top of the one set
+  /// with `S3Client.setBandwidthLimit`
+  final int? maxBytesPerSecond;
+
+  /// Extra HTTP headers sent with every request of the upload, such as
+  /// `x-amz-expected-bucket-owner`
+  final Map<String, String>? headers;
+
+  const UploadOptions({
+    this.contentType,
+    this.cacheControl,
+    this.contentDisposition,
+    this.contentEncoding,
+    this.metadata,
+    this.storageClass,
+    this.acl,
+    this.serverSideEncryption,
+    this.sseKmsKeyId,
+    this.sseCustomerKey,
+    this.compression,
+    this.timeout,
+    this.maxBytesPerSecond,
+    this.headers,
+  });
+
+  /// Encode the options as the JSON object expected by the Go library
+  String toJson() {
+    return jsonEncode({
+      if (contentType != null) 'contentType': contentType,
+      if (cacheControl != null) 'cacheControl': cacheControl,
+      if (contentDisposition != null) 'contentDisposition': contentDisposition,
+      if (contentEncoding != null) 'contentEncoding': contentEncoding,
+      if (metadata != null) 'metadata': metadata,
+      if (storageClass != null) 'storageClass': storageClass,
+      if (acl != null) 'acl': acl,
+      if (serverSideEncryption != null)
+        'serverSideEncryption': serverSideEncryption,
+      if (sseKmsKeyId != null) 'sseKmsKeyId': sseKmsKeyId,
+      if (sseCustomerKey != null) 'sseCustomerKey': sseCustomerKey,
+      if (compression != null) 'compression': compression,
+      if (timeout != null) 'timeoutSeconds': timeout!.inSeconds,
+      if (maxBytesPerSecond != null) 'maxBytesPerSecond': maxBytesPerSecond,
+      if (headers != null) 'headers': headers,
+    });
+  }
+}